@@ -0,0 +1,56 @@
+// Command reconcile reconciles the gateway's payments of a date range once,
+// for example to backfill days the scheduled job missed.
+//
+//	go run ./cmd/reconcile -from 2025-03-01 -to 2025-03-08
+package main
+
+import (
+	"context"
+	"flag"
+	"invitified-go/config"
+	"invitified-go/gateways"
+	"invitified-go/jobs"
+	"invitified-go/repositories"
+	"log"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	fromFlag := flag.String("from", "", "start date (YYYY-MM-DD), inclusive")
+	toFlag := flag.String("to", "", "end date (YYYY-MM-DD), exclusive, defaults to today")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		log.Fatalf("Invalid -from %q, expected YYYY-MM-DD", *fromFlag)
+	}
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if *toFlag != "" {
+		if to, err = time.Parse("2006-01-02", *toFlag); err != nil {
+			log.Fatalf("Invalid -to %q, expected YYYY-MM-DD", *toFlag)
+		}
+	}
+	if !from.Before(to) {
+		log.Fatalf("-from must be before -to")
+	}
+
+	config.InitDB()
+
+	job := jobs.NewReconciliationJobFromEnv(
+		repositories.NewPaymentRepository(config.DB),
+		repositories.NewRentalRepository(config.DB),
+		repositories.NewUserRepository(config.DB),
+		gateways.NewXenditGateway(gateways.XenditConfigFromEnv()),
+	)
+	path, err := job.RunRange(context.Background(), from, to)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+	log.Printf("Report written to %s", path)
+}
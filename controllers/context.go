@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"invitified-go/repositories"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// currentUserID returns the ID of the user authenticated by the JWT middleware
+func currentUserID(c echo.Context) (uuid.UUID, bool) {
+	userIDStr, ok := c.Get("userID").(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// isAdmin reports whether the user has the ADMIN role
+func isAdmin(userRepo repositories.UserRepository, userID uuid.UUID) bool {
+	user, err := userRepo.FindByID(userID)
+	if err != nil {
+		return false
+	}
+	role, err := userRepo.FindRoleByID(user.RoleID)
+	if err != nil {
+		return false
+	}
+	return role.Name == "ADMIN"
+}
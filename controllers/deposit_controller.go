@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"errors"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// depositReleasedReason is recorded when a deposit is released without damage
+const depositReleasedReason = "Released after return inspection"
+
+// DepositController handles the security deposits of rentals
+type DepositController struct {
+	repo        repositories.DepositRepository
+	rentalRepo  repositories.RentalRepository
+	paymentRepo repositories.PaymentRepository
+	userRepo    repositories.UserRepository
+	refunds     *services.RefundService
+}
+
+// SettleDepositRequest represents the outcome of a return inspection
+type SettleDepositRequest struct {
+	// RetainedAmount is kept for damage, in the settlement currency. The
+	// rest of the deposit is released.
+	RetainedAmount models.Money `json:"retained_amount"`
+	// Reason is required when part of the deposit is retained
+	Reason string `json:"reason"`
+}
+
+// SettleDepositResponse is returned when a deposit is settled
+type SettleDepositResponse struct {
+	Deposit models.DepositSummary `json:"deposit"`
+	// Refund pays out the released part of the deposit
+	Refund  *models.Refund `json:"refund,omitempty"`
+	Message string         `json:"message"`
+}
+
+// NewDepositController creates a new DepositController
+func NewDepositController(repo repositories.DepositRepository, rentalRepo repositories.RentalRepository, paymentRepo repositories.PaymentRepository, refundRepo repositories.RefundRepository, userRepo repositories.UserRepository, gateway gateways.PaymentGateway) *DepositController {
+	return &DepositController{
+		repo:        repo,
+		rentalRepo:  rentalRepo,
+		paymentRepo: paymentRepo,
+		userRepo:    userRepo,
+		refunds:     services.NewRefundService(refundRepo, userRepo, gateway),
+	}
+}
+
+// GetRentalDeposit godoc
+// @Summary Get the deposit of a rental
+// @Description Get the status of a rental's security deposit and its ledger entries
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {object} models.DepositSummary
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/deposit [get]
+func (ctrl *DepositController) GetRentalDeposit(c echo.Context) error {
+	rental, errResponse := ctrl.findRental(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	userID, ok := currentUserID(c)
+	if !ok || (rental.UserID != userID && !isAdmin(ctrl.userRepo, userID)) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to view this rental"})
+	}
+
+	entries, err := ctrl.repo.FindByRentalID(rental.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load deposit"})
+	}
+	return c.JSON(http.StatusOK, models.NewDepositSummary(rental, entries))
+}
+
+// SettleDeposit godoc
+// @Summary Settle the deposit of a rental
+// @Description Release the security deposit of a RETURNED or COMPLETED rental after the return inspection, or of a CANCELLED rental whose deposit refund did not go through. A retained_amount is kept for damage and needs a reason, the rest is refunded through the payment provider and released once the refund succeeds.
+// @Tags rentals
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Param request body SettleDepositRequest true "Inspection outcome"
+// @Success 200 {object} SettleDepositResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/deposit/settle [post]
+func (ctrl *DepositController) SettleDeposit(c echo.Context) error {
+	rental, errResponse := ctrl.findRental(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	var req SettleDepositRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	if req.RetainedAmount < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Retained amount cannot be negative"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		if req.RetainedAmount > 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"message": "A reason is required to retain part of the deposit"})
+		}
+		req.Reason = depositReleasedReason
+	}
+
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+	if rental.Status != models.RentalStatusReturned && rental.Status != models.RentalStatusComplete && rental.Status != models.RentalStatusCancelled {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Deposits are settled after the equipment is returned"})
+	}
+
+	settlement, err := ctrl.repo.Settle(rental.ID, req.RetainedAmount, req.Reason, adminID)
+	switch {
+	case err == nil:
+	case errors.Is(err, repositories.ErrDepositNotHeld):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Rental holds no deposit"})
+	case errors.Is(err, repositories.ErrDepositRefundPending):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "A refund of the deposit is still pending"})
+	case errors.Is(err, repositories.ErrDepositRetainExceedsHeld):
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Retained amount exceeds the deposit held"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to settle deposit"})
+	}
+
+	response := SettleDepositResponse{Message: "Deposit settled"}
+	if settlement.Release > 0 {
+		response.Refund, response.Message = ctrl.refundDeposit(c, settlement, req.Reason, adminID)
+	}
+
+	entries, err := ctrl.repo.FindByRentalID(rental.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load deposit"})
+	}
+	response.Deposit = models.NewDepositSummary(rental, entries)
+	return c.JSON(http.StatusOK, response)
+}
+
+// refundDeposit pays the released deposit back through the payment that
+// collected it. The release is recorded when the refund succeeds, until then
+// the deposit stays held. Virtual account payments cannot be refunded through
+// the gateway, their release is recorded right away and the message tells the
+// admin to return the money by bank transfer.
+func (ctrl *DepositController) refundDeposit(c echo.Context, settlement *repositories.DepositSettlement, reason string, adminID uuid.UUID) (*models.Refund, string) {
+	payment, err := ctrl.paymentRepo.FindByID(settlement.PaymentID)
+	if err != nil {
+		log.Printf("Failed to load payment %s to refund deposit: %v", settlement.PaymentID, err)
+		return nil, "Deposit not refunded, the rest of it is still held"
+	}
+
+	refund := &models.Refund{
+		Amount:      settlement.Release,
+		Reason:      "Security deposit released",
+		RequestedBy: adminID,
+		Deposit:     true,
+	}
+	err = ctrl.refunds.Refund(c.Request().Context(), payment, refund)
+	switch {
+	case err == nil && refund.Status == models.RefundStatusSucceeded:
+		return refund, "Deposit settled and refunded"
+	case err == nil:
+		return refund, "Deposit settled, the refund is waiting for the payment provider"
+	case errors.Is(err, services.ErrRefundNotSupported):
+		if _, err := ctrl.repo.Release(settlement.RentalID, settlement.Release, reason, adminID); err != nil {
+			log.Printf("Failed to release deposit of rental %s: %v", settlement.RentalID, err)
+			return nil, "Deposit not released, the rest of it is still held"
+		}
+		return nil, "Deposit settled, return it by bank transfer as virtual account payments cannot be refunded through the payment provider"
+	default:
+		log.Printf("Failed to refund deposit of payment %s: %v", payment.ID, err)
+		if refund.ID == uuid.Nil || refund.Status == models.RefundStatusFailed {
+			return nil, "The payment provider did not accept the refund, the rest of the deposit is still held"
+		}
+		return refund, "Deposit settled, the refund is waiting for the payment provider"
+	}
+}
+
+func (ctrl *DepositController) findRental(c echo.Context) (*models.Rental, *echo.HTTPError) {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid rental ID format")
+	}
+	rental, err := ctrl.rentalRepo.FindByID(rentalID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Rental not found")
+	}
+	return rental, nil
+}
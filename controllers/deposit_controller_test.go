@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDepositController_SettleDeposit(t *testing.T) {
+	e := echo.New()
+	mockDepositRepo := new(repositories.MockDepositRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRefundRepo := new(repositories.MockRefundRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+
+	adminID := uuid.New()
+	customerID := uuid.New()
+	payment := &models.Payment{
+		ID:               uuid.New(),
+		UserID:           customerID,
+		Amount:           models.NewMoney(600000),
+		XenditPaidAmount: models.NewMoney(600000),
+		DepositAmount:    models.NewMoney(500000),
+		PaymentMethod:    models.PaymentMethodEWallet,
+		PaymentStatus:    models.PaymentStatusCompleted,
+		XenditInvoiceID:  "ewc-1",
+	}
+	hold := models.DepositEntry{
+		ID:           uuid.New(),
+		PaymentID:    payment.ID,
+		UserID:       customerID,
+		Type:         models.DepositEntryHold,
+		Amount:       models.NewMoney(500000),
+		BalanceAfter: models.NewMoney(500000),
+	}
+	retain := func(rentalID uuid.UUID) models.DepositEntry {
+		return models.DepositEntry{RentalID: rentalID, PaymentID: payment.ID, Type: models.DepositEntryRetain, Amount: models.NewMoney(-150000)}
+	}
+	release := func(rentalID uuid.UUID) models.DepositEntry {
+		return models.DepositEntry{RentalID: rentalID, PaymentID: payment.ID, Type: models.DepositEntryRelease, Amount: models.NewMoney(-350000)}
+	}
+	settle := func(rental *models.Rental) {
+		retained := retain(rental.ID)
+		mockDepositRepo.On("Settle", rental.ID, models.NewMoney(150000), "Scratched lens", adminID).Return(&repositories.DepositSettlement{
+			RentalID:  rental.ID,
+			PaymentID: payment.ID,
+			Retained:  &retained,
+			Release:   models.NewMoney(350000),
+		}, nil)
+	}
+	createRefund := func() {
+		mockRefundRepo.On("Create", mock.MatchedBy(func(refund *models.Refund) bool {
+			return refund.Deposit && refund.Amount == models.NewMoney(350000)
+		})).Run(func(args mock.Arguments) {
+			refund := args.Get(0).(*models.Refund)
+			refund.ID = uuid.New()
+			refund.UserID = customerID
+			refund.Status = models.RefundStatusPending
+		}).Return(nil)
+	}
+
+	tests := []struct {
+		name          string
+		status        string
+		body          string
+		refundStatus  string
+		paymentMethod string
+		setupMocks    func(rental *models.Rental)
+		wantCode      int
+		wantMessage   string
+		wantStatus    string
+		wantRefunded  float64
+	}{
+		{
+			name:   "part kept for damage, the rest refunded",
+			status: models.RentalStatusReturned,
+			body:   `{"retained_amount": 150000, "reason": "Scratched lens"}`,
+			setupMocks: func(rental *models.Rental) {
+				settle(rental)
+				mockDepositRepo.On("FindByRentalID", rental.ID).Return([]models.DepositEntry{hold, retain(rental.ID), release(rental.ID)}, nil)
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				createRefund()
+				// The repository records the release with the refund
+				mockRefundRepo.On("MarkSucceeded", mock.AnythingOfType("*models.Refund"), payment).Run(func(args mock.Arguments) {
+					args.Get(0).(*models.Refund).Status = models.RefundStatusSucceeded
+				}).Return(nil)
+				mockUserRepo.On("FindByID", customerID).Return(&models.User{ID: customerID, Email: "customer@example.com"}, nil)
+			},
+			wantCode:     http.StatusOK,
+			wantMessage:  "Deposit settled and refunded",
+			wantStatus:   models.DepositStatusPartiallyRetained,
+			wantRefunded: 350000,
+		},
+		{
+			name:         "release waits for the refund",
+			status:       models.RentalStatusReturned,
+			body:         `{"retained_amount": 150000, "reason": "Scratched lens"}`,
+			refundStatus: gateways.RefundStatusPending,
+			setupMocks: func(rental *models.Rental) {
+				settle(rental)
+				mockDepositRepo.On("FindByRentalID", rental.ID).Return([]models.DepositEntry{hold, retain(rental.ID)}, nil)
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				createRefund()
+				mockRefundRepo.On("SetXenditRefundID", mock.AnythingOfType("*models.Refund")).Return(nil)
+			},
+			wantCode:     http.StatusOK,
+			wantMessage:  "Deposit settled, the refund is waiting for the payment provider",
+			wantStatus:   models.DepositStatusHeld,
+			wantRefunded: 350000,
+		},
+		{
+			name:          "virtual account deposit returned by bank transfer",
+			status:        models.RentalStatusReturned,
+			body:          `{"retained_amount": 150000, "reason": "Scratched lens"}`,
+			paymentMethod: models.PaymentMethodVirtualAccount,
+			setupMocks: func(rental *models.Rental) {
+				settle(rental)
+				mockDepositRepo.On("FindByRentalID", rental.ID).Return([]models.DepositEntry{hold, retain(rental.ID), release(rental.ID)}, nil)
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockDepositRepo.On("Release", rental.ID, models.NewMoney(350000), "Scratched lens", adminID).Return(&models.DepositEntry{}, nil)
+			},
+			wantCode:    http.StatusOK,
+			wantMessage: "Deposit settled, return it by bank transfer as virtual account payments cannot be refunded through the payment provider",
+			wantStatus:  models.DepositStatusPartiallyRetained,
+		},
+		{
+			name:   "refund of the deposit still pending",
+			status: models.RentalStatusComplete,
+			body:   `{}`,
+			setupMocks: func(rental *models.Rental) {
+				mockDepositRepo.On("Settle", rental.ID, models.Money(0), "Released after return inspection", adminID).Return(nil, repositories.ErrDepositRefundPending)
+			},
+			wantCode:    http.StatusConflict,
+			wantMessage: "A refund of the deposit is still pending",
+		},
+		{
+			name:        "reason required to retain",
+			status:      models.RentalStatusReturned,
+			body:        `{"retained_amount": 150000}`,
+			setupMocks:  func(rental *models.Rental) {},
+			wantCode:    http.StatusBadRequest,
+			wantMessage: "A reason is required to retain part of the deposit",
+		},
+		{
+			name:        "equipment not returned yet",
+			status:      models.RentalStatusPickedUp,
+			body:        `{}`,
+			setupMocks:  func(rental *models.Rental) {},
+			wantCode:    http.StatusConflict,
+			wantMessage: "Deposits are settled after the equipment is returned",
+		},
+		{
+			name:   "retaining more than is held",
+			status: models.RentalStatusComplete,
+			body:   `{"retained_amount": 600000, "reason": "Lost"}`,
+			setupMocks: func(rental *models.Rental) {
+				mockDepositRepo.On("Settle", rental.ID, models.NewMoney(600000), "Lost", adminID).Return(nil, repositories.ErrDepositRetainExceedsHeld)
+			},
+			wantCode:    http.StatusBadRequest,
+			wantMessage: "Retained amount exceeds the deposit held",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDepositRepo.ExpectedCalls = nil
+			mockRentalRepo.ExpectedCalls = nil
+			mockPaymentRepo.ExpectedCalls = nil
+			mockRefundRepo.ExpectedCalls = nil
+			mockUserRepo.ExpectedCalls = nil
+
+			gateway := gateways.NewFakeGateway()
+			if tt.refundStatus != "" {
+				gateway.RefundStatus = tt.refundStatus
+			}
+			payment.PaymentMethod = models.PaymentMethodEWallet
+			if tt.paymentMethod != "" {
+				payment.PaymentMethod = tt.paymentMethod
+			}
+			ctrl := NewDepositController(mockDepositRepo, mockRentalRepo, mockPaymentRepo, mockRefundRepo, mockUserRepo, gateway)
+			rental := &models.Rental{ID: uuid.New(), UserID: customerID, Status: tt.status, DepositAmount: models.NewMoney(500000)}
+			mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+			tt.setupMocks(rental)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/rentals/:id/deposit/settle")
+			c.SetParamNames("id")
+			c.SetParamValues(rental.ID.String())
+			c.Set("userID", adminID.String())
+
+			assert.NoError(t, ctrl.SettleDeposit(c))
+			assert.Equal(t, tt.wantCode, rec.Code)
+
+			var response SettleDepositResponse
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			assert.Equal(t, tt.wantMessage, response.Message)
+			if tt.wantStatus != "" {
+				assert.Equal(t, tt.wantStatus, response.Deposit.Status)
+			}
+			if tt.wantRefunded > 0 {
+				assert.Len(t, gateway.RefundRequests, 1)
+				assert.Equal(t, tt.wantRefunded, gateway.RefundRequests[0].Amount)
+			} else {
+				assert.Empty(t, gateway.RefundRequests)
+			}
+			mockDepositRepo.AssertExpectations(t)
+			mockRefundRepo.AssertExpectations(t)
+		})
+	}
+}
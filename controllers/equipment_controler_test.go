@@ -3,6 +3,7 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
+	"invitified-go/gateways"
 	"invitified-go/models"
 	"invitified-go/repositories"
 	"net/http"
@@ -20,16 +21,24 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 	mockPaymentRepo := new(repositories.MockPaymentRepository)
 	mockRentalRepo := new(repositories.MockRentalRepository)
 	mockUserRepo := new(repositories.MockUserRepository)
+	mockLoyaltyRepo := new(repositories.MockLoyaltyRepository)
 
-	ctrl := NewPaymentController(mockPaymentRepo, mockRentalRepo, mockUserRepo)
+	gateway := gateways.NewFakeGateway()
+
+	ctrl := NewPaymentController(mockPaymentRepo, mockRentalRepo, mockUserRepo, mockLoyaltyRepo, new(repositories.MockLateFeeRepository), gateway)
+
+	ownerID := uuid.New()
 
 	tests := []struct {
 		name       string
 		payload    PaymentRequest
+		simulate   bool
 		setupAuth  func(c echo.Context)
 		setupMocks func()
 		wantCode   int
 		wantMsg    string
+		wantStatus string
+		check      func(t *testing.T, response PaymentResponse)
 	}{
 		{
 			name: "successful payment",
@@ -39,13 +48,152 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 				ChannelCode:   "BCA",
 			},
 			setupAuth: func(c echo.Context) {
-				c.Set("userID", uuid.New().String())
+				c.Set("userID", ownerID.String())
 			},
 			setupMocks: func() {
 				rental := &models.Rental{
 					ID:        uuid.MustParse(uuid.New().String()),
-					UserID:    uuid.MustParse(uuid.New().String()),
-					TotalCost: 100000,
+					UserID:    ownerID,
+					TotalCost: models.NewMoney(100000),
+					Status:    models.RentalStatusPending,
+				}
+
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{
+					ID:    rental.UserID,
+					Email: "test@example.com",
+				}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.Payment")).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantStatus: models.PaymentStatusPending,
+			check: func(t *testing.T, response PaymentResponse) {
+				assert.NotEmpty(t, response.Instructions.AccountNumber)
+			},
+		},
+		{
+			name: "qr code payment",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "QR_CODE",
+				ChannelCode:   "QRIS",
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.Payment")).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantStatus: models.PaymentStatusPending,
+			check: func(t *testing.T, response PaymentResponse) {
+				assert.Equal(t, "QR_CODE", response.Instructions.Method)
+				assert.NotEmpty(t, response.Instructions.QRString)
+				assert.Equal(t, response.Instructions.QRString, response.Payment.QRString)
+				assert.Equal(t, float64(100000), gateway.QRCodeRequests[len(gateway.QRCodeRequests)-1].Amount)
+			},
+		},
+		{
+			name: "dana e-wallet payment",
+			payload: PaymentRequest{
+				RentalID:           uuid.New().String(),
+				PaymentMethod:      "EWALLET",
+				ChannelCode:        "dana",
+				SuccessRedirectURL: "https://invitified.example/paid",
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.Payment")).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantStatus: models.PaymentStatusPending,
+			check: func(t *testing.T, response PaymentResponse) {
+				assert.Equal(t, "DANA", response.Instructions.ChannelCode)
+				assert.NotEmpty(t, response.Instructions.CheckoutURL)
+				assert.NotEmpty(t, response.Instructions.DeeplinkURL)
+				assert.Equal(t, gateways.EWalletDANA, gateway.EWalletRequests[len(gateway.EWalletRequests)-1].ChannelCode)
+			},
+		},
+		{
+			name: "rental already has a pending payment",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "VIRTUAL_ACCOUNT",
+				ChannelCode:   "BCA",
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{
+					{ID: uuid.New(), RentalID: rental.ID, PaymentStatus: models.PaymentStatusPending},
+				}, nil)
+			},
+			wantCode: http.StatusConflict,
+			wantMsg:  "This rental already has a pending payment",
+		},
+		{
+			name: "rental already paid",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "VIRTUAL_ACCOUNT",
+				ChannelCode:   "BCA",
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPaid}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+			},
+			wantCode: http.StatusConflict,
+			wantMsg:  "Only pending rentals can be paid",
+		},
+		{
+			name: "ovo without mobile number",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "EWALLET",
+				ChannelCode:   "OVO",
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {},
+			wantCode:   http.StatusBadRequest,
+			wantMsg:    "Mobile number is required for OVO payments",
+		},
+		{
+			name: "simulated payment marks rental paid",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "VIRTUAL_ACCOUNT",
+				ChannelCode:   "BCA",
+			},
+			simulate: true,
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{
+					ID:        uuid.New(),
+					UserID:    ownerID,
+					TotalCost: models.NewMoney(100000),
 					Status:    models.RentalStatusPending,
 				}
 
@@ -54,10 +202,64 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 					ID:    rental.UserID,
 					Email: "test@example.com",
 				}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
 				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.Payment")).Return(nil)
-				mockRentalRepo.On("UpdateStatus", rental.ID, models.RentalStatusComplete).Return(nil)
+				mockPaymentRepo.On("MarkPaid", mock.AnythingOfType("*models.Payment")).Return(nil).Run(func(args mock.Arguments) {
+					args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusCompleted
+				})
+				mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPending, mock.Anything).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantStatus: models.PaymentStatusCompleted,
+		},
+		{
+			name: "redeem points",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "VIRTUAL_ACCOUNT",
+				ChannelCode:   "BCA",
+				Points:        200,
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
+				mockLoyaltyRepo.On("FindBalance", ownerID).Return(&models.LoyaltyPoints{UserID: ownerID, Points: 500}, nil)
+				mockPaymentRepo.On("Create", mock.MatchedBy(func(payment *models.Payment) bool {
+					return payment.PointsUsed == 200 && payment.Amount == models.NewMoney(80000)
+				})).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantStatus: models.PaymentStatusPending,
+			check: func(t *testing.T, response PaymentResponse) {
+				assert.Equal(t, models.NewMoney(80000), response.Instructions.Amount)
+				assert.Equal(t, float64(80000), gateway.Requests[len(gateway.Requests)-1].ExpectedAmount)
+			},
+		},
+		{
+			name: "not enough points",
+			payload: PaymentRequest{
+				RentalID:      uuid.New().String(),
+				PaymentMethod: "VIRTUAL_ACCOUNT",
+				ChannelCode:   "BCA",
+				Points:        200,
+			},
+			setupAuth: func(c echo.Context) {
+				c.Set("userID", ownerID.String())
+			},
+			setupMocks: func() {
+				rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
+				mockUserRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(&models.User{ID: ownerID}, nil)
+				mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{}, nil)
+				mockLoyaltyRepo.On("FindBalance", ownerID).Return(&models.LoyaltyPoints{UserID: ownerID, Points: 50}, nil)
 			},
-			wantCode: http.StatusCreated,
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "Not enough points",
 		},
 		{
 			name: "invalid rental id",
@@ -87,7 +289,7 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 				rental := &models.Rental{
 					ID:        uuid.MustParse(uuid.New().String()),
 					UserID:    uuid.New(), // Different user ID
-					TotalCost: 100000,
+					TotalCost: models.NewMoney(100000),
 					Status:    models.RentalStatusPending,
 				}
 				mockRentalRepo.On("FindByID", mock.AnythingOfType("uuid.UUID")).Return(rental, nil)
@@ -104,7 +306,11 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 			mockPaymentRepo.ExpectedCalls = nil
 			mockRentalRepo.ExpectedCalls = nil
 			mockUserRepo.ExpectedCalls = nil
+			mockLoyaltyRepo.ExpectedCalls = nil
 
+			if tt.simulate {
+				t.Setenv("XENDIT_SIMULATE_PAYMENTS", "true")
+			}
 			tt.setupMocks()
 
 			jsonBytes, _ := json.Marshal(tt.payload)
@@ -128,6 +334,15 @@ func TestPaymentController_CreatePayment(t *testing.T) {
 
 			assert.Equal(t, tt.wantCode, rec.Code)
 
+			if tt.wantStatus != "" {
+				var response PaymentResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.Equal(t, tt.wantStatus, response.Payment.PaymentStatus)
+				if tt.check != nil {
+					tt.check(t, response)
+				}
+			}
+
 			// Verify mock expectations
 			mockPaymentRepo.AssertExpectations(t)
 			mockRentalRepo.AssertExpectations(t)
@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	"fmt"
 	"invitified-go/models"
 	"invitified-go/repositories"
+	"invitified-go/services"
 	"invitified-go/utils"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -12,12 +15,16 @@ import (
 
 // EquipmentController handles equipment-related requests
 type EquipmentController struct {
-	repo repositories.EquipmentRepository
+	repo         repositories.EquipmentRepository
+	availability *services.AvailabilityService
 }
 
+// maxCalendarDays limits how many days a single availability request may span
+const maxCalendarDays = 62
+
 // NewEquipmentController creates a new EquipmentController
-func NewEquipmentController(repo repositories.EquipmentRepository) *EquipmentController {
-	return &EquipmentController{repo}
+func NewEquipmentController(repo repositories.EquipmentRepository, rentalRepo repositories.RentalRepository) *EquipmentController {
+	return &EquipmentController{repo, services.NewAvailabilityService(rentalRepo)}
 }
 
 // CreateCategory godoc
@@ -154,6 +161,7 @@ func (ctrl *EquipmentController) CreateEquipment(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: err.Error()})
 	}
 	equipment.Slug = utils.ConvertToSlug(equipment.Name)
+	equipment.Currency = equipment.Currency.OrDefault()
 
 	userIDStr, ok := c.Get("userID").(string)
 	if !ok {
@@ -192,6 +200,61 @@ func (ctrl *EquipmentController) GetEquipmentBySlug(c echo.Context) error {
 	return c.JSON(http.StatusOK, equipment)
 }
 
+// GetEquipmentAvailability godoc
+// @Summary Get equipment availability calendar
+// @Description Get the number of free units for each day in a date range
+// @Tags equipment
+// @Produce json
+// @Param slug path string true "Equipment Slug"
+// @Param from query string false "First day (YYYY-MM-DD), defaults to today"
+// @Param to query string false "Last day (YYYY-MM-DD), defaults to 30 days from the first day"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /equipment/{slug}/availability [get]
+func (ctrl *EquipmentController) GetEquipmentAvailability(c echo.Context) error {
+	slug := c.Param("slug")
+	equipment, err := ctrl.repo.FindEquipmentBySlug(slug)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, models.ErrorResponse{Message: err.Error()})
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today
+	if param := c.QueryParam("from"); param != "" {
+		if from, err = time.Parse(services.DateLayout, param); err != nil {
+			return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: "Invalid from date, expected YYYY-MM-DD"})
+		}
+	}
+	to := from.AddDate(0, 0, 29)
+	if param := c.QueryParam("to"); param != "" {
+		if to, err = time.Parse(services.DateLayout, param); err != nil {
+			return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: "Invalid to date, expected YYYY-MM-DD"})
+		}
+	}
+	if to.Before(from) {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: "The to date must not be before the from date"})
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: fmt.Sprintf("Date range must not exceed %d days", maxCalendarDays)})
+	}
+
+	days, err := ctrl.availability.Calendar(equipment, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"equipment_id":   equipment.ID,
+		"slug":           equipment.Slug,
+		"stock_quantity": equipment.StockQuantity,
+		"from":           from.Format(services.DateLayout),
+		"to":             to.Format(services.DateLayout),
+		"days":           days,
+	})
+}
+
 // GetAllEquipment godoc
 // @Summary Get all equipment
 // @Description Get all equipment
@@ -252,6 +315,7 @@ func (ctrl *EquipmentController) UpdateEquipment(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.ErrorResponse{Message: err.Error()})
 	}
 	equipment.Slug = utils.ConvertToSlug(equipment.Name)
+	equipment.Currency = equipment.Currency.OrDefault()
 	if err := ctrl.repo.UpdateEquipment(equipment); err != nil {
 		return c.JSON(http.StatusInternalServerError, models.ErrorResponse{Message: err.Error()})
 	}
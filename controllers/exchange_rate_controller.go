@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ExchangeRateController handles the admin management of exchange rates
+type ExchangeRateController struct {
+	repo repositories.ExchangeRateRepository
+	now  func() time.Time
+}
+
+// NewExchangeRateController creates a new ExchangeRateController
+func NewExchangeRateController(repo repositories.ExchangeRateRepository) *ExchangeRateController {
+	return &ExchangeRateController{repo: repo, now: time.Now}
+}
+
+// CreateExchangeRate godoc
+// @Summary Create an exchange rate
+// @Description Set the value of one unit of a currency in IDR from effective_from on, which defaults to now. Rentals booked before keep the rate they were booked at.
+// @Tags exchange-rates
+// @Accept json
+// @Produce json
+// @Param rate body models.ExchangeRate true "Exchange rate"
+// @Success 201 {object} models.ExchangeRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /exchange-rates [post]
+func (ctrl *ExchangeRateController) CreateExchangeRate(c echo.Context) error {
+	rate := new(models.ExchangeRate)
+	if err := c.Bind(rate); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	rate.ID = uuid.Nil
+	rate.Currency = models.Currency(strings.ToUpper(strings.TrimSpace(string(rate.Currency))))
+	rate.CreatedBy = userID
+	if rate.EffectiveFrom.IsZero() {
+		rate.EffectiveFrom = ctrl.now()
+	}
+	if message := validateExchangeRate(rate); message != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": message})
+	}
+
+	if err := ctrl.repo.Create(rate); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to create exchange rate"})
+	}
+	return c.JSON(http.StatusCreated, rate)
+}
+
+// GetAllExchangeRates godoc
+// @Summary List exchange rates
+// @Description List exchange rates, latest effective date first
+// @Tags exchange-rates
+// @Produce json
+// @Param currency query string false "Currency code"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /exchange-rates [get]
+func (ctrl *ExchangeRateController) GetAllExchangeRates(c echo.Context) error {
+	currency := models.Currency(strings.ToUpper(c.QueryParam("currency")))
+
+	pagination := utils.GetPagination(c)
+	rates, total, err := ctrl.repo.FindAll(currency, pagination.Limit, pagination.Offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load exchange rates"})
+	}
+	utils.SetPagination(&pagination, total)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       rates,
+		"pagination": pagination,
+	})
+}
+
+// GetExchangeRateByID godoc
+// @Summary Get an exchange rate
+// @Description Get an exchange rate by ID
+// @Tags exchange-rates
+// @Produce json
+// @Param id path string true "Exchange rate ID"
+// @Success 200 {object} models.ExchangeRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /exchange-rates/{id} [get]
+func (ctrl *ExchangeRateController) GetExchangeRateByID(c echo.Context) error {
+	rate, errResponse := ctrl.findExchangeRate(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	return c.JSON(http.StatusOK, rate)
+}
+
+// DeleteExchangeRate godoc
+// @Summary Delete an exchange rate
+// @Description Delete an exchange rate entered by mistake. Rentals keep the rate they were booked at.
+// @Tags exchange-rates
+// @Param id path string true "Exchange rate ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /exchange-rates/{id} [delete]
+func (ctrl *ExchangeRateController) DeleteExchangeRate(c echo.Context) error {
+	rate, errResponse := ctrl.findExchangeRate(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	if err := ctrl.repo.Delete(rate.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to delete exchange rate"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ctrl *ExchangeRateController) findExchangeRate(c echo.Context) (*models.ExchangeRate, *echo.HTTPError) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid exchange rate ID format")
+	}
+	rate, err := ctrl.repo.FindByID(id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Exchange rate not found")
+	}
+	return rate, nil
+}
+
+// validateExchangeRate returns why the rate cannot be saved, or an empty
+// string when it is valid
+func validateExchangeRate(rate *models.ExchangeRate) string {
+	switch {
+	case !isCurrencyCode(rate.Currency):
+		return "Currency must be a three letter ISO 4217 code"
+	case rate.Currency == models.DefaultCurrency:
+		return "Prices in " + string(models.DefaultCurrency) + " need no exchange rate"
+	case rate.Rate <= 0:
+		return "Rate must be greater than 0"
+	}
+	return ""
+}
+
+func isCurrencyCode(currency models.Currency) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExchangeRateController(t *testing.T) {
+	e := echo.New()
+	mockExchangeRateRepo := new(repositories.MockExchangeRateRepository)
+	ctrl := NewExchangeRateController(mockExchangeRateRepo)
+
+	now := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	ctrl.now = func() time.Time { return now }
+	adminID := uuid.New()
+
+	t.Run("CreateExchangeRate", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			payload     map[string]interface{}
+			setupMocks  func()
+			wantCode    int
+			wantMessage string
+		}{
+			{
+				name:    "effective now by default",
+				payload: map[string]interface{}{"currency": "usd", "rate": 15500.5},
+				setupMocks: func() {
+					mockExchangeRateRepo.On("Create", mock.MatchedBy(func(rate *models.ExchangeRate) bool {
+						return rate.Currency == models.CurrencyUSD && rate.Rate == 15500.5 &&
+							rate.EffectiveFrom.Equal(now) && rate.CreatedBy == adminID
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+			},
+			{
+				name:    "future effective date",
+				payload: map[string]interface{}{"currency": "SGD", "rate": 11600, "effective_from": "2025-04-01T00:00:00Z"},
+				setupMocks: func() {
+					mockExchangeRateRepo.On("Create", mock.MatchedBy(func(rate *models.ExchangeRate) bool {
+						return rate.EffectiveFrom.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+			},
+			{
+				name:        "settlement currency",
+				payload:     map[string]interface{}{"currency": "IDR", "rate": 1},
+				setupMocks:  func() {},
+				wantCode:    http.StatusBadRequest,
+				wantMessage: "Prices in IDR need no exchange rate",
+			},
+			{
+				name:        "invalid currency code",
+				payload:     map[string]interface{}{"currency": "US$", "rate": 15500},
+				setupMocks:  func() {},
+				wantCode:    http.StatusBadRequest,
+				wantMessage: "Currency must be a three letter ISO 4217 code",
+			},
+			{
+				name:        "rate not positive",
+				payload:     map[string]interface{}{"currency": "USD", "rate": 0},
+				setupMocks:  func() {},
+				wantCode:    http.StatusBadRequest,
+				wantMessage: "Rate must be greater than 0",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockExchangeRateRepo.ExpectedCalls = nil
+				tt.setupMocks()
+
+				body, _ := json.Marshal(tt.payload)
+				req := httptest.NewRequest(http.MethodPost, "/exchange-rates", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.Set("userID", adminID.String())
+
+				assert.NoError(t, ctrl.CreateExchangeRate(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+				if tt.wantMessage != "" {
+					var response map[string]string
+					json.Unmarshal(rec.Body.Bytes(), &response)
+					assert.Equal(t, tt.wantMessage, response["message"])
+				}
+				mockExchangeRateRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("GetAllExchangeRates filters by currency", func(t *testing.T) {
+		mockExchangeRateRepo.ExpectedCalls = nil
+		rates := []models.ExchangeRate{{ID: uuid.New(), Currency: models.CurrencyUSD, Rate: 15500}}
+		mockExchangeRateRepo.On("FindAll", models.CurrencyUSD, 10, 0).Return(rates, int64(1), nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/exchange-rates?currency=usd", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		assert.NoError(t, ctrl.GetAllExchangeRates(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockExchangeRateRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// LateFeeController handles the late fees of overdue rentals
+type LateFeeController struct {
+	repo       repositories.LateFeeRepository
+	rentalRepo repositories.RentalRepository
+	userRepo   repositories.UserRepository
+}
+
+// WaiveLateFeeRequest represents a request to waive a late fee
+type WaiveLateFeeRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// NewLateFeeController creates a new LateFeeController
+func NewLateFeeController(repo repositories.LateFeeRepository, rentalRepo repositories.RentalRepository, userRepo repositories.UserRepository) *LateFeeController {
+	return &LateFeeController{repo, rentalRepo, userRepo}
+}
+
+// GetRentalLateFee godoc
+// @Summary Get the late fee of a rental
+// @Description Get the late fee charged for returning a rental after its end date. The fee is paid by creating a payment with late_fee set.
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {object} models.LateFee
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/late-fee [get]
+func (ctrl *LateFeeController) GetRentalLateFee(c echo.Context) error {
+	rental, errResponse := ctrl.findRental(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	userID, ok := currentUserID(c)
+	if !ok || (rental.UserID != userID && !isAdmin(ctrl.userRepo, userID)) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to view this rental"})
+	}
+
+	fee, err := ctrl.repo.FindByRentalID(rental.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental has no late fee"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load late fee"})
+	}
+	return c.JSON(http.StatusOK, fee)
+}
+
+// WaiveLateFee godoc
+// @Summary Waive the late fee of a rental
+// @Description Write off what is left to pay of a rental's late fee. The reason and the admin who waived it are recorded and the fee stops growing.
+// @Tags rentals
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Param request body WaiveLateFeeRequest true "Waiver"
+// @Success 200 {object} models.LateFee
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/late-fee/waive [post]
+func (ctrl *LateFeeController) WaiveLateFee(c echo.Context) error {
+	rental, errResponse := ctrl.findRental(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	var req WaiveLateFeeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "A reason is required to waive a late fee"})
+	}
+
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	fee, err := ctrl.repo.Waive(rental.ID, req.Reason, adminID)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, fee)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental has no late fee"})
+	case errors.Is(err, repositories.ErrLateFeeSettled):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Late fee has nothing left to waive"})
+	case errors.Is(err, repositories.ErrLateFeePaymentPending):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Late fee is being paid, wait for the payment to finish or expire"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to waive late fee"})
+	}
+}
+
+func (ctrl *LateFeeController) findRental(c echo.Context) (*models.Rental, *echo.HTTPError) {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid rental ID format")
+	}
+	rental, err := ctrl.rentalRepo.FindByID(rentalID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Rental not found")
+	}
+	return rental, nil
+}
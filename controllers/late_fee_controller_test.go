@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestLateFeeController_WaiveLateFee(t *testing.T) {
+	e := echo.New()
+	mockLateFeeRepo := new(repositories.MockLateFeeRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+
+	adminID := uuid.New()
+	rental := &models.Rental{ID: uuid.New(), UserID: uuid.New(), Status: models.RentalStatusReturned}
+	mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+
+	tests := []struct {
+		name        string
+		body        string
+		setupMocks  func()
+		wantCode    int
+		wantMessage string
+	}{
+		{
+			name: "waived with the reason recorded",
+			body: `{"reason": "Customer was stuck in a flood"}`,
+			setupMocks: func() {
+				mockLateFeeRepo.On("Waive", rental.ID, "Customer was stuck in a flood", adminID).Return(&models.LateFee{
+					RentalID:     rental.ID,
+					Status:       models.LateFeeStatusWaived,
+					Amount:       models.NewMoney(200000),
+					WaivedAmount: models.NewMoney(200000),
+					WaivedBy:     &adminID,
+					WaiveReason:  "Customer was stuck in a flood",
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "reason required",
+			body:        `{"reason": "  "}`,
+			setupMocks:  func() {},
+			wantCode:    http.StatusBadRequest,
+			wantMessage: "A reason is required to waive a late fee",
+		},
+		{
+			name: "no late fee",
+			body: `{"reason": "Goodwill"}`,
+			setupMocks: func() {
+				mockLateFeeRepo.On("Waive", rental.ID, "Goodwill", adminID).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantCode:    http.StatusNotFound,
+			wantMessage: "Rental has no late fee",
+		},
+		{
+			name: "already paid",
+			body: `{"reason": "Goodwill"}`,
+			setupMocks: func() {
+				mockLateFeeRepo.On("Waive", rental.ID, "Goodwill", adminID).Return(nil, repositories.ErrLateFeeSettled)
+			},
+			wantCode:    http.StatusConflict,
+			wantMessage: "Late fee has nothing left to waive",
+		},
+		{
+			name: "payment in progress",
+			body: `{"reason": "Goodwill"}`,
+			setupMocks: func() {
+				mockLateFeeRepo.On("Waive", rental.ID, "Goodwill", adminID).Return(nil, repositories.ErrLateFeePaymentPending)
+			},
+			wantCode:    http.StatusConflict,
+			wantMessage: "Late fee is being paid, wait for the payment to finish or expire",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLateFeeRepo.ExpectedCalls = nil
+			tt.setupMocks()
+			ctrl := NewLateFeeController(mockLateFeeRepo, mockRentalRepo, mockUserRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/rentals/:id/late-fee/waive")
+			c.SetParamNames("id")
+			c.SetParamValues(rental.ID.String())
+			c.Set("userID", adminID.String())
+
+			assert.NoError(t, ctrl.WaiveLateFee(c))
+			assert.Equal(t, tt.wantCode, rec.Code)
+
+			if tt.wantMessage != "" {
+				var response map[string]string
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.Equal(t, tt.wantMessage, response["message"])
+				return
+			}
+			var fee models.LateFee
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fee))
+			assert.Equal(t, models.LateFeeStatusWaived, fee.Status)
+			assert.Equal(t, models.Money(0), fee.Outstanding())
+			mockLateFeeRepo.AssertExpectations(t)
+		})
+	}
+}
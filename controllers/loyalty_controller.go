@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LoyaltyController handles loyalty point requests
+type LoyaltyController struct {
+	repo repositories.LoyaltyRepository
+}
+
+// PointsResponse is a user's points balance with a page of its history
+type PointsResponse struct {
+	Balance    int                        `json:"balance"`
+	Data       []models.PointsTransaction `json:"data"`
+	Pagination utils.Pagination           `json:"pagination"`
+}
+
+// NewLoyaltyController creates a new LoyaltyController
+func NewLoyaltyController(repo repositories.LoyaltyRepository) *LoyaltyController {
+	return &LoyaltyController{repo}
+}
+
+// GetMyPoints godoc
+// @Summary Get my loyalty points
+// @Description Get the current user's points balance and the history of points earned, redeemed, returned and taken back, newest first
+// @Tags users
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PointsResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /users/me/points [get]
+func (ctrl *LoyaltyController) GetMyPoints(c echo.Context) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	balance, err := ctrl.repo.FindBalance(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load points balance"})
+	}
+
+	pagination := utils.GetPagination(c)
+	transactions, total, err := ctrl.repo.FindTransactions(userID, pagination.Limit, pagination.Offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load points history"})
+	}
+	utils.SetPagination(&pagination, total)
+
+	return c.JSON(http.StatusOK, PointsResponse{
+		Balance:    balance.Points,
+		Data:       transactions,
+		Pagination: pagination,
+	})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoyaltyController_GetMyPoints(t *testing.T) {
+	e := echo.New()
+	mockRepo := new(repositories.MockLoyaltyRepository)
+	ctrl := NewLoyaltyController(mockRepo)
+	userID := uuid.New()
+	paymentID := uuid.New()
+
+	tests := []struct {
+		name         string
+		setupMocks   func()
+		expectedCode int
+		check        func(t *testing.T, response PointsResponse)
+	}{
+		{
+			name: "balance with history",
+			setupMocks: func() {
+				mockRepo.On("FindBalance", userID).Return(&models.LoyaltyPoints{UserID: userID, Points: 30}, nil)
+				mockRepo.On("FindTransactions", userID, 10, 0).Return([]models.PointsTransaction{
+					{ID: uuid.New(), UserID: userID, Type: models.PointsTypeRedeem, Points: -20, BalanceAfter: 30, PaymentID: &paymentID},
+					{ID: uuid.New(), UserID: userID, Type: models.PointsTypeEarn, Points: 50, BalanceAfter: 50, PaymentID: &paymentID},
+				}, int64(2), nil)
+			},
+			expectedCode: http.StatusOK,
+			check: func(t *testing.T, response PointsResponse) {
+				assert.Equal(t, 30, response.Balance)
+				assert.Len(t, response.Data, 2)
+				assert.Equal(t, models.PointsTypeRedeem, response.Data[0].Type)
+				assert.Equal(t, int64(2), response.Pagination.Total)
+			},
+		},
+		{
+			name: "balance fails to load",
+			setupMocks: func() {
+				mockRepo.On("FindBalance", userID).Return(nil, errors.New("db error"))
+			},
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			tt.setupMocks()
+
+			req := httptest.NewRequest(http.MethodGet, "/users/me/points", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", userID.String())
+
+			err := ctrl.GetMyPoints(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.check != nil {
+				var response PointsResponse
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				tt.check(t, response)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -1,15 +1,17 @@
 package controllers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"invitified-go/gateways"
 	"invitified-go/models"
 	"invitified-go/repositories"
-	"invitified-go/utils"
+	"invitified-go/services"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +23,11 @@ type PaymentController struct {
 	paymentRepo repositories.PaymentRepository
 	rentalRepo  repositories.RentalRepository
 	userRepo    repositories.UserRepository
+	loyaltyRepo repositories.LoyaltyRepository
+	lateFeeRepo repositories.LateFeeRepository
+	gateway     gateways.PaymentGateway
+	settlement  *services.PaymentSettlement
+	loyalty     services.LoyaltyRates
 }
 
 // PaymentRequest represents a request to create a payment
@@ -28,21 +35,56 @@ type PaymentRequest struct {
 	RentalID      string `json:"rental_id" validate:"required"`
 	PaymentMethod string `json:"payment_method" validate:"required,oneof=QR_CODE VIRTUAL_ACCOUNT EWALLET"`
 	ChannelCode   string `json:"channel_code" validate:"required"`
+	ExtensionID   string `json:"extension_id,omitempty"`
+	// LateFee pays what is outstanding of the rental's late fee
+	LateFee bool `json:"late_fee,omitempty"`
+	// MobileNumber is required for OVO, which asks the customer in its app
+	MobileNumber string `json:"mobile_number,omitempty"`
+	// SuccessRedirectURL is where DANA and ShopeePay send the customer after
+	// paying. It defaults to PAYMENT_SUCCESS_REDIRECT_URL.
+	SuccessRedirectURL string `json:"success_redirect_url,omitempty"`
+	// Points to redeem against the rental's total cost
+	Points int `json:"points,omitempty"`
+}
+
+// PaymentResponse is returned when a payment is started
+type PaymentResponse struct {
+	Payment      *models.Payment            `json:"payment"`
+	Rental       *models.Rental             `json:"rental"`
+	Extension    *models.RentalExtension    `json:"extension,omitempty"`
+	LateFee      *models.LateFee            `json:"late_fee,omitempty"`
+	Instructions models.PaymentInstructions `json:"instructions"`
+}
+
+// eWalletChannels maps the supported e-wallet channel codes to Xendit's codes
+var eWalletChannels = map[string]string{
+	"OVO":       gateways.EWalletOVO,
+	"DANA":      gateways.EWalletDANA,
+	"SHOPEEPAY": gateways.EWalletShopeePay,
 }
 
 // NewPaymentController creates a new PaymentController
-func NewPaymentController(pr repositories.PaymentRepository, rr repositories.RentalRepository, ur repositories.UserRepository) *PaymentController {
-	return &PaymentController{pr, rr, ur}
+func NewPaymentController(pr repositories.PaymentRepository, rr repositories.RentalRepository, ur repositories.UserRepository, lr repositories.LoyaltyRepository, lfr repositories.LateFeeRepository, gateway gateways.PaymentGateway) *PaymentController {
+	return &PaymentController{
+		paymentRepo: pr,
+		rentalRepo:  rr,
+		userRepo:    ur,
+		loyaltyRepo: lr,
+		lateFeeRepo: lfr,
+		gateway:     gateway,
+		settlement:  services.NewPaymentSettlement(pr, rr, ur),
+		loyalty:     services.LoyaltyRatesFromEnv(),
+	}
 }
 
 // CreatePayment godoc
 // @Summary Create a new payment
-// @Description Create a new payment for a rental
+// @Description Create a new payment for a rental. Loyalty points can be redeemed against the rental's total cost. The rental's security deposit is collected with the payment. Set late_fee to pay the outstanding late fee of a returned or overdue rental instead.
 // @Tags payments
 // @Accept json
 // @Produce json
 // @Param payment body PaymentRequest true "Payment Request"
-// @Success 201 {object} map[string]interface{}
+// @Success 201 {object} PaymentResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 403 {object} models.ErrorResponse
@@ -58,6 +100,12 @@ func (ctrl *PaymentController) CreatePayment(c echo.Context) error {
 		})
 	}
 
+	if msg := validatePaymentMethod(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": msg,
+		})
+	}
+
 	// Parse rental ID
 	rentalID, err := uuid.Parse(req.RentalID)
 	if err != nil {
@@ -103,154 +151,335 @@ func (ctrl *PaymentController) CreatePayment(c echo.Context) error {
 		})
 	}
 
-	// Create virtual account
-	vaRequest := map[string]interface{}{
-		"external_id": "VA_fixed-" + time.Now().Format("20060102150405"),
-		"bank_code":   req.ChannelCode,
-		"name":        "Customer Payment",
+	// Amounts are charged in the settlement currency at the exchange rate
+	// the rental was booked at. Extensions are paid through the pending
+	// payment created with them.
+	amount := rental.SettlementAmount(rental.TotalCost)
+	var extension *models.RentalExtension
+	var extensionPayment *models.Payment
+	if req.ExtensionID != "" {
+		extension, extensionPayment, err = ctrl.pendingExtensionPayment(rental, req.ExtensionID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+		amount = extensionPayment.Amount
 	}
-
-	vaResponse, err := createVirtualAccount(vaRequest)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Failed to create virtual account",
-		})
+	var lateFee *models.LateFee
+	if req.LateFee {
+		if extension != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": "A payment cannot pay for an extension and a late fee",
+			})
+		}
+		lateFee, err = ctrl.payableLateFee(rental)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+		amount = lateFee.Outstanding()
 	}
 
-	// Log the entire response for debugging
-	log.Println("Virtual Account Response:", vaResponse)
+	// Only one payment per rental may be waiting or completed at a time
+	if extension == nil && lateFee == nil {
+		msg, err := ctrl.activePaymentConflict(rental)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"message": "Failed to load payments",
+			})
+		}
+		if msg != "" {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"message": msg,
+			})
+		}
+	}
 
-	externalID, ok := vaResponse["external_id"].(string)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Invalid response from virtual account creation: missing external_id",
-		})
+	if req.Points != 0 {
+		var msg string
+		amount, msg, err = ctrl.redeemPoints(userID, req.Points, amount, extension == nil && lateFee == nil)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"message": "Failed to load points balance",
+			})
+		}
+		if msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"message": msg,
+			})
+		}
 	}
 
-	accountNumber, ok := vaResponse["account_number"].(string)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Invalid response from virtual account creation: missing account_number",
-		})
+	// The security deposit is collected on top of the rental's price. It is
+	// not taxed and points cannot pay for it. Late fees are charged as they
+	// are, in the settlement currency.
+	deposit := rental.SettlementAmount(rental.DepositAmount)
+	tax := rental.TaxOn(amount)
+	if lateFee != nil {
+		deposit, tax = 0, 0
+	}
+	payment := &models.Payment{
+		ID:               uuid.New(),
+		RentalID:         rental.ID,
+		UserID:           userID,
+		Amount:           amount + deposit,
+		TaxAmount:        tax,
+		DepositAmount:    deposit,
+		Currency:         models.DefaultCurrency,
+		OriginalAmount:   rental.OriginalAmount(amount + deposit),
+		OriginalCurrency: rental.Currency.OrDefault(),
+		PointsUsed:       req.Points,
+	}
+	payment.Subtotal = amount - payment.TaxAmount
+	if lateFee != nil {
+		payment.LateFeeID = &lateFee.ID
+	}
+	if extensionPayment != nil {
+		payment = extensionPayment
 	}
 
-	// Simulate payment
-	paymentResponse, err := simulatePayment(externalID, rental.TotalCost)
-	if err != nil {
+	// The external ID ties Xendit's callback back to this payment
+	payment.PaymentMethod = req.PaymentMethod
+	payment.PaymentStatus = models.PaymentStatusPending
+	payment.XenditExternalID = "payment-" + payment.ID.String()
+	payment.XenditPaymentChannel = req.ChannelCode
+	if err := ctrl.startCharge(c.Request().Context(), &req, payment, user); err != nil {
+		log.Printf("Failed to create %s charge: %v", req.PaymentMethod, err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Failed to simulate payment",
+			"message": "Failed to create payment with the payment provider",
 		})
 	}
 
-	status, ok := paymentResponse["status"].(string)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"message": "Invalid response from payment simulation: missing status",
+	if extensionPayment != nil {
+		err = ctrl.paymentRepo.Update(payment)
+	} else {
+		err = ctrl.paymentRepo.Create(payment)
+	}
+	if errors.Is(err, repositories.ErrInsufficientPoints) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Not enough points",
 		})
 	}
-
-	// Create payment record
-	payment := &models.Payment{
-		ID:                   uuid.New(),
-		RentalID:             rental.ID,
-		UserID:               userID,
-		Amount:               rental.TotalCost,
-		PaymentMethod:        req.PaymentMethod,
-		PaymentStatus:        status,
-		XenditInvoiceID:      vaResponse["id"].(string),
-		XenditPaymentURL:     accountNumber,
-		XenditPaymentChannel: req.ChannelCode,
-	}
-
-	if err := ctrl.paymentRepo.Create(payment); err != nil {
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
 			"message": "Failed to save payment",
 		})
 	}
 
-	// Update rental status to COMPLETED if payment is successful
-	if status == "COMPLETED" {
-		if err := ctrl.rentalRepo.UpdateStatus(rental.ID, models.RentalStatusComplete); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"message": "Failed to update rental status",
-			})
-		}
-		rental.Status = models.RentalStatusComplete
-		subject := "Payment Completed"
-		htmlBody := utils.GetOrderConfirmationEmail(rental.ID.String(), fmt.Sprintf("%.2f", rental.TotalCost))
-		if err := utils.SendHTMLEmail(user.Email, subject, htmlBody); err != nil {
-			log.Println("Failed to send email:", err)
+	response := PaymentResponse{
+		Payment:      payment,
+		Rental:       rental,
+		Extension:    extension,
+		LateFee:      lateFee,
+		Instructions: payment.Instructions(),
+	}
+
+	// In Xendit test mode a virtual account can be paid right away. The
+	// callback for the simulated payment is then handled as a duplicate.
+	if os.Getenv("XENDIT_SIMULATE_PAYMENTS") == "true" && payment.PaymentMethod == models.PaymentMethodVirtualAccount {
+		simulated, err := ctrl.gateway.SimulateVirtualAccountPayment(c.Request().Context(), payment.XenditExternalID, payment.Amount.Float64())
+		if err != nil {
+			log.Println("Failed to simulate payment:", err)
+		} else if simulated.Status == models.PaymentStatusCompleted {
+			paidAt := time.Now()
+			payment.XenditPaidAmount = payment.Amount
+			payment.PaidAt = &paidAt
+			settlement, err := ctrl.settlement.MarkPaid(payment)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"message": "Failed to record payment",
+				})
+			}
+			response.Payment = settlement.Payment
+			response.Rental = settlement.Rental
+			if settlement.Extension != nil {
+				response.Extension = settlement.Extension
+			}
 		}
 	}
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"payment": payment,
-		"rental":  rental,
-	})
+	return c.JSON(http.StatusCreated, response)
 }
 
-func createVirtualAccount(request map[string]interface{}) (map[string]interface{}, error) {
-	url := "https://api.xendit.co/callback_virtual_accounts"
-	apiKey := os.Getenv("XENDIT_SECRET_KEY")
-
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
+// redeemPoints checks that the user can spend the points on the payment and
+// returns the amount left to pay, or a message explaining why the points
+// cannot be used. The balance is checked again when the payment is stored.
+func (ctrl *PaymentController) redeemPoints(userID uuid.UUID, points int, amount models.Money, rentalPayment bool) (models.Money, string, error) {
+	if points < 0 {
+		return 0, "Points must be positive", nil
 	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if !rentalPayment {
+		return 0, "Points can only be redeemed on rental payments", nil
 	}
-	req.SetBasicAuth(apiKey, "")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	balance, err := ctrl.loyaltyRepo.FindBalance(userID)
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	if balance.Points < points {
+		return 0, "Not enough points", nil
 	}
-
-	return result, nil
+	discount := ctrl.loyalty.Value(points)
+	if discount >= amount {
+		return 0, "Points cannot cover the whole amount due", nil
+	}
+	return amount - discount, "", nil
 }
 
-func simulatePayment(externalID string, amount float64) (map[string]interface{}, error) {
-	url := fmt.Sprintf("https://api.xendit.co/callback_virtual_accounts/external_id=%s/simulate_payment", externalID)
-	apiKey := os.Getenv("XENDIT_SECRET_KEY")
+// validatePaymentMethod checks the method specific fields of the request and
+// normalizes the channel code. It returns an error message or "".
+func validatePaymentMethod(req *PaymentRequest) string {
+	req.ChannelCode = strings.ToUpper(req.ChannelCode)
+	switch req.PaymentMethod {
+	case models.PaymentMethodVirtualAccount:
+		if req.ChannelCode == "" {
+			return "Bank code is required for virtual account payments"
+		}
+	case models.PaymentMethodQRCode:
+		req.ChannelCode = "QRIS"
+	case models.PaymentMethodEWallet:
+		if _, ok := eWalletChannels[req.ChannelCode]; !ok {
+			return "E-wallet channel must be OVO, DANA or SHOPEEPAY"
+		}
+		if req.ChannelCode == "OVO" && req.MobileNumber == "" {
+			return "Mobile number is required for OVO payments"
+		}
+		if req.ChannelCode != "OVO" && req.SuccessRedirectURL == "" {
+			req.SuccessRedirectURL = os.Getenv("PAYMENT_SUCCESS_REDIRECT_URL")
+			if req.SuccessRedirectURL == "" {
+				return "Success redirect URL is required for " + req.ChannelCode + " payments"
+			}
+		}
+	default:
+		return "Payment method must be QR_CODE, VIRTUAL_ACCOUNT or EWALLET"
+	}
+	return ""
+}
 
-	request := map[string]interface{}{
-		"amount": amount,
+// startCharge creates the charge for the payment method at the gateway and
+// stores what the customer needs to pay it on the payment.
+func (ctrl *PaymentController) startCharge(ctx context.Context, req *PaymentRequest, payment *models.Payment, user *models.User) error {
+	switch req.PaymentMethod {
+	case models.PaymentMethodQRCode:
+		code, err := ctrl.gateway.CreateQRCode(ctx, gateways.QRCodeRequest{
+			ReferenceID: payment.XenditExternalID,
+			Amount:      payment.Amount.Float64(),
+		})
+		if err != nil {
+			return err
+		}
+		payment.XenditInvoiceID = code.ID
+		payment.QRString = code.QRString
+
+	case models.PaymentMethodEWallet:
+		charge, err := ctrl.gateway.CreateEWalletCharge(ctx, gateways.EWalletChargeRequest{
+			ReferenceID: payment.XenditExternalID,
+			Amount:      payment.Amount.Float64(),
+			ChannelCode: eWalletChannels[req.ChannelCode],
+			ChannelProperties: gateways.EWalletChannelProperties{
+				MobileNumber:       req.MobileNumber,
+				SuccessRedirectURL: req.SuccessRedirectURL,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		payment.XenditInvoiceID = charge.ID
+		payment.CheckoutURL = charge.Actions.DesktopWebCheckoutURL
+		payment.MobileCheckoutURL = charge.Actions.MobileWebCheckoutURL
+		payment.DeeplinkURL = charge.Actions.MobileDeeplinkCheckoutURL
+		payment.XenditPaymentURL = charge.Actions.DesktopWebCheckoutURL
+
+	default:
+		account, err := ctrl.gateway.CreateVirtualAccount(ctx, gateways.VirtualAccountRequest{
+			ExternalID:     payment.XenditExternalID,
+			BankCode:       req.ChannelCode,
+			Name:           user.FullName,
+			ExpectedAmount: payment.Amount.Float64(),
+			IsClosed:       true,
+			IsSingleUse:    true,
+		})
+		if err != nil {
+			return err
+		}
+		payment.XenditInvoiceID = account.ID
+		payment.AccountNumber = account.AccountNumber
+		payment.XenditPaymentURL = account.AccountNumber
 	}
+	return nil
+}
 
-	jsonData, err := json.Marshal(request)
+// activePaymentConflict explains why the rental cannot be paid again, or
+// returns "" when a new payment may be started.
+func (ctrl *PaymentController) activePaymentConflict(rental *models.Rental) (string, error) {
+	if rental.Status != models.RentalStatusPending {
+		return "Only pending rentals can be paid", nil
+	}
+	payments, err := ctrl.paymentRepo.FindByRentalID(rental.ID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	for _, payment := range payments {
+		if payment.ExtensionID != nil || payment.LateFeeID != nil {
+			continue
+		}
+		switch payment.PaymentStatus {
+		case models.PaymentStatusPending:
+			return "This rental already has a pending payment", nil
+		case models.PaymentStatusCompleted:
+			return "This rental has already been paid", nil
+		}
+	}
+	return "", nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// pendingExtensionPayment returns the rental's pending extension and the
+// payment that was created for it.
+func (ctrl *PaymentController) pendingExtensionPayment(rental *models.Rental, extensionIDStr string) (*models.RentalExtension, *models.Payment, error) {
+	extensionID, err := uuid.Parse(extensionIDStr)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("Invalid extension ID format")
+	}
+	extension, err := ctrl.rentalRepo.FindExtensionByID(extensionID)
+	if err != nil || extension.RentalID != rental.ID {
+		return nil, nil, fmt.Errorf("Extension not found for this rental")
+	}
+	if extension.Status != models.ExtensionStatusPending {
+		return nil, nil, fmt.Errorf("Extension is no longer waiting for payment")
 	}
-	req.SetBasicAuth(apiKey, "")
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	payments, err := ctrl.paymentRepo.FindByRentalID(rental.ID)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("Failed to load payments")
+	}
+	for i := range payments {
+		if payments[i].ExtensionID != nil && *payments[i].ExtensionID == extension.ID && payments[i].PaymentStatus == models.PaymentStatusPending {
+			return extension, &payments[i], nil
+		}
 	}
-	defer resp.Body.Close()
+	return nil, nil, fmt.Errorf("Extension has no pending payment")
+}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+// payableLateFee returns the rental's late fee when something of it is left to
+// pay and no payment of it is pending.
+func (ctrl *PaymentController) payableLateFee(rental *models.Rental) (*models.LateFee, error) {
+	fee, err := ctrl.lateFeeRepo.FindByRentalID(rental.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Rental has no late fee")
+	}
+	if fee.Status == models.LateFeeStatusWaived || fee.Outstanding() <= 0 {
+		return nil, fmt.Errorf("Late fee has nothing left to pay")
 	}
 
-	return result, nil
+	payments, err := ctrl.paymentRepo.FindByRentalID(rental.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load payments")
+	}
+	for _, payment := range payments {
+		if payment.LateFeeID != nil && *payment.LateFeeID == fee.ID && payment.PaymentStatus == models.PaymentStatusPending {
+			return nil, fmt.Errorf("This late fee already has a pending payment")
+		}
+	}
+	return fee, nil
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -18,7 +19,7 @@ import (
 func TestEquipmentController_Categories(t *testing.T) {
 	e := echo.New()
 	mockRepo := new(repositories.MockEquipmentRepository)
-	ctrl := NewEquipmentController(mockRepo)
+	ctrl := NewEquipmentController(mockRepo, new(repositories.MockRentalRepository))
 
 	t.Run("CreateCategory", func(t *testing.T) {
 		tests := []struct {
@@ -61,7 +62,7 @@ func TestEquipmentController_Categories(t *testing.T) {
 func TestEquipmentController_Equipment(t *testing.T) {
 	e := echo.New()
 	mockRepo := new(repositories.MockEquipmentRepository)
-	ctrl := NewEquipmentController(mockRepo)
+	ctrl := NewEquipmentController(mockRepo, new(repositories.MockRentalRepository))
 
 	t.Run("CreateEquipment", func(t *testing.T) {
 		tests := []struct {
@@ -75,7 +76,7 @@ func TestEquipmentController_Equipment(t *testing.T) {
 				payload: models.Equipment{
 					Name:          "Camping Tent",
 					StockQuantity: 5,
-					RentalPrice:   50.00,
+					RentalPrice:   models.NewMoney(50.00),
 					CategoryID:    uuid.New(),
 					IsAvailable:   true,
 				},
@@ -104,3 +105,91 @@ func TestEquipmentController_Equipment(t *testing.T) {
 		}
 	})
 }
+
+func TestEquipmentController_Availability(t *testing.T) {
+	e := echo.New()
+	mockRepo := new(repositories.MockEquipmentRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	ctrl := NewEquipmentController(mockRepo, mockRentalRepo)
+
+	equipment := &models.Equipment{
+		ID:            uuid.New(),
+		Name:          "Camping Tent",
+		Slug:          "camping-tent",
+		StockQuantity: 5,
+		IsAvailable:   true,
+	}
+	day1 := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name       string
+		query      string
+		setupMocks func()
+		wantCode   int
+		wantDays   []int
+	}{
+		{
+			name:  "available units per day",
+			query: "?from=2025-03-01&to=2025-03-02",
+			setupMocks: func() {
+				mockRepo.On("FindEquipmentBySlug", "camping-tent").Return(equipment, nil)
+				mockRentalRepo.On("FindBookedPeriods", equipment.ID, day1, day2.AddDate(0, 0, 1)).Return([]repositories.BookedPeriod{
+					{StartDate: day1.Add(-24 * time.Hour), EndDate: day1.Add(12 * time.Hour), Quantity: 2},
+					{StartDate: day2.Add(10 * time.Hour), EndDate: day2.AddDate(0, 0, 3), Quantity: 3},
+					{StartDate: day2, EndDate: day2.AddDate(0, 0, 1), Quantity: 2},
+				}, nil)
+			},
+			wantCode: http.StatusOK,
+			wantDays: []int{3, 0},
+		},
+		{
+			name:  "range too long",
+			query: "?from=2025-03-01&to=2025-05-15",
+			setupMocks: func() {
+				mockRepo.On("FindEquipmentBySlug", "camping-tent").Return(equipment, nil)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:  "invalid range",
+			query: "?from=2025-03-02&to=2025-03-01",
+			setupMocks: func() {
+				mockRepo.On("FindEquipmentBySlug", "camping-tent").Return(equipment, nil)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRentalRepo.ExpectedCalls = nil
+			tt.setupMocks()
+
+			req := httptest.NewRequest(http.MethodGet, "/equipment/camping-tent/availability"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("slug")
+			c.SetParamValues("camping-tent")
+
+			assert.NoError(t, ctrl.GetEquipmentAvailability(c))
+			assert.Equal(t, tt.wantCode, rec.Code)
+
+			if tt.wantDays != nil {
+				var response struct {
+					Days []struct {
+						Available int `json:"available"`
+					} `json:"days"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				var got []int
+				for _, day := range response.Days {
+					got = append(got, day.Available)
+				}
+				assert.Equal(t, tt.wantDays, got)
+			}
+			mockRentalRepo.AssertExpectations(t)
+		})
+	}
+}
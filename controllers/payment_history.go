@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"invitified-go/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// PaymentStatusResponse is the latest state of a payment
+type PaymentStatusResponse struct {
+	PaymentID uuid.UUID `json:"payment_id"`
+	Status    string    `json:"status"`
+	// GatewayStatus is the status of the charge at the payment provider
+	GatewayStatus string       `json:"gateway_status,omitempty"`
+	Amount        models.Money `json:"amount"`
+	PaidAmount    models.Money `json:"paid_amount"`
+	PaidAt        *time.Time   `json:"paid_at,omitempty"`
+	// Amounts are in Currency, OriginalAmount is the amount due in the
+	// currency the rental was priced in
+	Currency         models.Currency `json:"currency"`
+	OriginalAmount   models.Money    `json:"original_amount"`
+	OriginalCurrency models.Currency `json:"original_currency"`
+	// DepositAmount is the part of Amount that is a refundable deposit
+	DepositAmount models.Money `json:"deposit_amount"`
+	// Instructions are included while the payment is still pending
+	Instructions *models.PaymentInstructions `json:"instructions,omitempty"`
+}
+
+// GetMyPayments godoc
+// @Summary Get my payments
+// @Description Get the caller's payments, newest first
+// @Tags payments
+// @Produce json
+// @Param status query string false "Payment status"
+// @Param method query string false "QR_CODE, VIRTUAL_ACCOUNT or EWALLET"
+// @Param from query string false "Only payments created at or after this time (RFC 3339)"
+// @Param to query string false "Only payments created before this time (RFC 3339)"
+// @Param page query int false "Page"
+// @Param limit query int false "Limit"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /payments [get]
+func (ctrl *PaymentController) GetMyPayments(c echo.Context) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	filter, err := parsePaymentFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	filter.UserID = userID
+	return ctrl.listPayments(c, filter)
+}
+
+// GetAllPayments godoc
+// @Summary Get all payments
+// @Description Get the payments of every customer, newest first
+// @Tags payments
+// @Produce json
+// @Param user_id query string false "User ID"
+// @Param rental_id query string false "Rental ID"
+// @Param status query string false "Payment status"
+// @Param method query string false "QR_CODE, VIRTUAL_ACCOUNT or EWALLET"
+// @Param from query string false "Only payments created at or after this time (RFC 3339)"
+// @Param to query string false "Only payments created before this time (RFC 3339)"
+// @Param page query int false "Page"
+// @Param limit query int false "Limit"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /payments/all [get]
+func (ctrl *PaymentController) GetAllPayments(c echo.Context) error {
+	filter, err := parsePaymentFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	return ctrl.listPayments(c, filter)
+}
+
+func (ctrl *PaymentController) listPayments(c echo.Context, filter repositories.PaymentFilter) error {
+	pagination := utils.GetPagination(c)
+	payments, total, err := ctrl.paymentRepo.FindWithFilter(filter, pagination.Limit, pagination.Offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load payments"})
+	}
+	utils.SetPagination(&pagination, total)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       payments,
+		"pagination": pagination,
+	})
+}
+
+// GetPaymentByID godoc
+// @Summary Get a payment
+// @Description Get one of the caller's payments. Admins can get any payment.
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.Payment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /payments/{id} [get]
+func (ctrl *PaymentController) GetPaymentByID(c echo.Context) error {
+	payment, errResponse := ctrl.findPayment(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	return c.JSON(http.StatusOK, payment)
+}
+
+// GetRentalPayments godoc
+// @Summary Get the payments of a rental
+// @Description Get every payment made for a rental and its extensions, oldest first
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {array} models.Payment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/payments [get]
+func (ctrl *PaymentController) GetRentalPayments(c echo.Context) error {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID format"})
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	rental, err := ctrl.rentalRepo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
+	}
+	if rental.UserID != userID && !isAdmin(ctrl.userRepo, userID) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to view this rental"})
+	}
+
+	payments, err := ctrl.paymentRepo.FindByRentalID(rental.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load payments"})
+	}
+	return c.JSON(http.StatusOK, payments)
+}
+
+// GetPaymentStatus godoc
+// @Summary Get the latest status of a payment
+// @Description Check a pending payment with the payment provider and return its latest status. A payment the provider reports as paid or failed is recorded right away, so clients can poll this while the customer pays. Virtual account payments are only reported through callbacks.
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} PaymentStatusResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /payments/{id}/status [get]
+func (ctrl *PaymentController) GetPaymentStatus(c echo.Context) error {
+	payment, errResponse := ctrl.findPayment(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	response := PaymentStatusResponse{PaymentID: payment.ID}
+	if payment.PaymentStatus == models.PaymentStatusPending {
+		gatewayPayment, err := services.LookupGatewayPayment(c.Request().Context(), ctrl.gateway, payment)
+		if err != nil {
+			// Answer with what we know, the client polls again
+			log.Printf("Failed to check payment %s with the gateway: %v", payment.ID, err)
+		} else {
+			response.GatewayStatus = gatewayPayment.GatewayStatus
+			if payment, err = ctrl.applyGatewayPayment(payment, gatewayPayment); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to record payment"})
+			}
+		}
+	}
+
+	response.Status = payment.PaymentStatus
+	response.Amount = payment.Amount
+	response.PaidAmount = payment.XenditPaidAmount
+	response.PaidAt = payment.PaidAt
+	response.Currency = payment.Currency.OrDefault()
+	response.OriginalAmount = payment.OriginalAmount
+	response.OriginalCurrency = payment.OriginalCurrency.OrDefault()
+	response.DepositAmount = payment.DepositAmount
+	if payment.PaymentStatus == models.PaymentStatusPending {
+		instructions := payment.Instructions()
+		response.Instructions = &instructions
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// applyGatewayPayment records a pending payment that the gateway reports as
+// paid or failed and returns the updated payment
+func (ctrl *PaymentController) applyGatewayPayment(payment *models.Payment, gatewayPayment *services.GatewayPayment) (*models.Payment, error) {
+	switch gatewayPayment.State {
+	case services.GatewayPaymentPaid:
+		settlement, err := ctrl.settlement.Record(payment, gatewayPayment.Paid)
+		if errors.Is(err, services.ErrUnderpaid) {
+			log.Printf("Gateway reports payment %s paid %s of %s", payment.ID, gatewayPayment.Paid.Amount, payment.Amount)
+			return payment, nil
+		}
+		if err != nil {
+			log.Printf("Failed to settle payment %s: %v", payment.ID, err)
+			return nil, err
+		}
+		return settlement.Payment, nil
+
+	case services.GatewayPaymentFailed:
+		err := ctrl.paymentRepo.MarkFailed(payment)
+		if err != nil && !errors.Is(err, repositories.ErrPaymentNotPending) {
+			return nil, err
+		}
+	}
+	return payment, nil
+}
+
+// findPayment loads the payment in the id path parameter if the caller owns
+// it or is an admin
+func (ctrl *PaymentController) findPayment(c echo.Context) (*models.Payment, *echo.HTTPError) {
+	paymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid payment ID format")
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid user ID")
+	}
+
+	payment, err := ctrl.paymentRepo.FindByID(paymentID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Payment not found")
+	}
+	if payment.UserID != userID && !isAdmin(ctrl.userRepo, userID) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Not authorized to view this payment")
+	}
+	return payment, nil
+}
+
+// parsePaymentFilter reads the payment listing filters from the query string
+func parsePaymentFilter(c echo.Context) (repositories.PaymentFilter, error) {
+	filter := repositories.PaymentFilter{
+		Status: c.QueryParam("status"),
+		Method: c.QueryParam("method"),
+	}
+
+	var err error
+	if param := c.QueryParam("user_id"); param != "" {
+		if filter.UserID, err = uuid.Parse(param); err != nil {
+			return filter, fmt.Errorf("Invalid user ID format")
+		}
+	}
+	if param := c.QueryParam("rental_id"); param != "" {
+		if filter.RentalID, err = uuid.Parse(param); err != nil {
+			return filter, fmt.Errorf("Invalid rental ID format")
+		}
+	}
+	if param := c.QueryParam("from"); param != "" {
+		if filter.From, err = time.Parse(time.RFC3339, param); err != nil {
+			return filter, fmt.Errorf("Invalid from date, expected RFC 3339")
+		}
+	}
+	if param := c.QueryParam("to"); param != "" {
+		if filter.To, err = time.Parse(time.RFC3339, param); err != nil {
+			return filter, fmt.Errorf("Invalid to date, expected RFC 3339")
+		}
+	}
+	return filter, nil
+}
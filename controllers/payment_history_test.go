@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPaymentController_GetMyPayments(t *testing.T) {
+	e := echo.New()
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	ctrl := NewPaymentController(mockPaymentRepo, new(repositories.MockRentalRepository), new(repositories.MockUserRepository), new(repositories.MockLoyaltyRepository), new(repositories.MockLateFeeRepository), gateways.NewFakeGateway())
+	userID := uuid.New()
+
+	tests := []struct {
+		name         string
+		query        string
+		setupMocks   func()
+		expectedCode int
+	}{
+		{
+			name:  "only own payments",
+			query: "?status=COMPLETED&method=QR_CODE&user_id=" + uuid.New().String(),
+			setupMocks: func() {
+				mockPaymentRepo.On("FindWithFilter", mock.MatchedBy(func(filter repositories.PaymentFilter) bool {
+					return filter.UserID == userID && filter.Status == "COMPLETED" && filter.Method == "QR_CODE"
+				}), 10, 0).Return([]models.Payment{{ID: uuid.New(), UserID: userID}}, int64(1), nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "invalid date",
+			query:        "?from=yesterday",
+			setupMocks:   func() {},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPaymentRepo.ExpectedCalls = nil
+			tt.setupMocks()
+
+			req := httptest.NewRequest(http.MethodGet, "/payments"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", userID.String())
+
+			err := ctrl.GetMyPayments(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			mockPaymentRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentController_GetPaymentByID(t *testing.T) {
+	e := echo.New()
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	ctrl := NewPaymentController(mockPaymentRepo, new(repositories.MockRentalRepository), mockUserRepo, new(repositories.MockLoyaltyRepository), new(repositories.MockLateFeeRepository), gateways.NewFakeGateway())
+
+	ownerID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), UserID: ownerID, Amount: models.NewMoney(100000), PaymentStatus: models.PaymentStatusCompleted}
+	customerRole := &models.Role{ID: uuid.New(), Name: "CUSTOMER"}
+
+	tests := []struct {
+		name         string
+		userID       uuid.UUID
+		setupMocks   func(userID uuid.UUID)
+		expectedCode int
+	}{
+		{
+			name:   "owner",
+			userID: ownerID,
+			setupMocks: func(userID uuid.UUID) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "other customer",
+			userID: uuid.New(),
+			setupMocks: func(userID uuid.UUID) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockUserRepo.On("FindByID", userID).Return(&models.User{ID: userID, RoleID: customerRole.ID}, nil)
+				mockUserRepo.On("FindRoleByID", customerRole.ID).Return(customerRole, nil)
+			},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPaymentRepo.ExpectedCalls = nil
+			mockUserRepo.ExpectedCalls = nil
+			tt.setupMocks(tt.userID)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(payment.ID.String())
+			c.Set("userID", tt.userID.String())
+
+			err := ctrl.GetPaymentByID(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			mockPaymentRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentController_GetPaymentStatus(t *testing.T) {
+	e := echo.New()
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	gateway := gateways.NewFakeGateway()
+	ctrl := NewPaymentController(mockPaymentRepo, mockRentalRepo, mockUserRepo, new(repositories.MockLoyaltyRepository), new(repositories.MockLateFeeRepository), gateway)
+
+	ownerID := uuid.New()
+	rental := &models.Rental{ID: uuid.New(), UserID: ownerID, TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+
+	// newEWalletPayment starts a real charge at the fake gateway
+	newEWalletPayment := func() *models.Payment {
+		charge, err := gateway.CreateEWalletCharge(context.Background(), gateways.EWalletChargeRequest{
+			ReferenceID: "payment-" + uuid.NewString(),
+			Amount:      100000,
+			ChannelCode: gateways.EWalletDANA,
+		})
+		assert.NoError(t, err)
+		return &models.Payment{
+			ID:              uuid.New(),
+			RentalID:        rental.ID,
+			UserID:          ownerID,
+			Amount:          models.NewMoney(100000),
+			PaymentMethod:   models.PaymentMethodEWallet,
+			PaymentStatus:   models.PaymentStatusPending,
+			XenditInvoiceID: charge.ID,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		gatewayStatus string
+		setupMocks    func(payment *models.Payment)
+		wantStatus    string
+		wantGateway   string
+		wantSteps     bool
+	}{
+		{
+			name: "still waiting for the customer",
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+			},
+			wantStatus:  models.PaymentStatusPending,
+			wantGateway: "PENDING",
+			wantSteps:   true,
+		},
+		{
+			name:          "paid without a callback",
+			gatewayStatus: "SUCCEEDED",
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockPaymentRepo.On("MarkPaid", payment).Run(func(args mock.Arguments) {
+					args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusCompleted
+				}).Return(nil)
+				mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+				mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPending, mock.Anything).Return(nil)
+				mockUserRepo.On("FindByID", ownerID).Return(&models.User{ID: ownerID, Email: "test@example.com"}, nil)
+			},
+			wantStatus:  models.PaymentStatusCompleted,
+			wantGateway: "SUCCEEDED",
+		},
+		{
+			name:          "customer rejected the charge",
+			gatewayStatus: "FAILED",
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockPaymentRepo.On("MarkFailed", payment).Run(func(args mock.Arguments) {
+					args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusFailed
+				}).Return(nil)
+			},
+			wantStatus:  models.PaymentStatusFailed,
+			wantGateway: "FAILED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPaymentRepo.ExpectedCalls = nil
+			mockRentalRepo.ExpectedCalls = nil
+			mockUserRepo.ExpectedCalls = nil
+			rental.Status = models.RentalStatusPending
+
+			payment := newEWalletPayment()
+			if tt.gatewayStatus != "" {
+				gateway.SetEWalletChargeStatus(payment.XenditInvoiceID, tt.gatewayStatus)
+			}
+			tt.setupMocks(payment)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(payment.ID.String())
+			c.Set("userID", ownerID.String())
+
+			err := ctrl.GetPaymentStatus(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var response PaymentStatusResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantStatus, response.Status)
+			assert.Equal(t, tt.wantGateway, response.GatewayStatus)
+			assert.Equal(t, tt.wantSteps, response.Instructions != nil)
+			mockPaymentRepo.AssertExpectations(t)
+			mockRentalRepo.AssertExpectations(t)
+		})
+	}
+}
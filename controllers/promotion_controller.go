@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// PromotionController handles the admin management of promo codes
+type PromotionController struct {
+	repo repositories.PromotionRepository
+}
+
+// NewPromotionController creates a new PromotionController
+func NewPromotionController(repo repositories.PromotionRepository) *PromotionController {
+	return &PromotionController{repo}
+}
+
+// CreatePromotion godoc
+// @Summary Create a promotion
+// @Description Create a promo code with a PERCENTAGE or FIXED discount. Codes are stored in upper case.
+// @Tags promotions
+// @Accept json
+// @Produce json
+// @Param promotion body models.Promotion true "Promotion"
+// @Success 201 {object} models.Promotion
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /promotions [post]
+func (ctrl *PromotionController) CreatePromotion(c echo.Context) error {
+	promotion := new(models.Promotion)
+	if err := c.Bind(promotion); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	promotion.ID = uuid.Nil
+	promotion.Code = strings.ToUpper(strings.TrimSpace(promotion.Code))
+	if message := validatePromotion(promotion); message != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": message})
+	}
+
+	if _, err := ctrl.repo.FindByCode(promotion.Code); err == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Promo code already exists"})
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check promo code"})
+	}
+
+	if err := ctrl.repo.Create(promotion); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to create promotion"})
+	}
+	return c.JSON(http.StatusCreated, promotion)
+}
+
+// GetAllPromotions godoc
+// @Summary List promotions
+// @Description List all promotions, newest first
+// @Tags promotions
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /promotions [get]
+func (ctrl *PromotionController) GetAllPromotions(c echo.Context) error {
+	pagination := utils.GetPagination(c)
+	promotions, total, err := ctrl.repo.FindAll(pagination.Limit, pagination.Offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load promotions"})
+	}
+	utils.SetPagination(&pagination, total)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       promotions,
+		"pagination": pagination,
+	})
+}
+
+// GetPromotionByID godoc
+// @Summary Get a promotion
+// @Description Get a promotion by ID
+// @Tags promotions
+// @Produce json
+// @Param id path string true "Promotion ID"
+// @Success 200 {object} models.Promotion
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /promotions/{id} [get]
+func (ctrl *PromotionController) GetPromotionByID(c echo.Context) error {
+	promotion, errResponse := ctrl.findPromotion(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	return c.JSON(http.StatusOK, promotion)
+}
+
+// UpdatePromotion godoc
+// @Summary Update a promotion
+// @Description Replace the settings of a promotion. Its code cannot be changed.
+// @Tags promotions
+// @Accept json
+// @Produce json
+// @Param id path string true "Promotion ID"
+// @Param promotion body models.Promotion true "Promotion"
+// @Success 200 {object} models.Promotion
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /promotions/{id} [put]
+func (ctrl *PromotionController) UpdatePromotion(c echo.Context) error {
+	existing, errResponse := ctrl.findPromotion(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	promotion := new(models.Promotion)
+	if err := c.Bind(promotion); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	// Rentals refer to the promotion by its code
+	promotion.ID = existing.ID
+	promotion.Code = existing.Code
+	promotion.CreatedAt = existing.CreatedAt
+	if message := validatePromotion(promotion); message != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": message})
+	}
+
+	if err := ctrl.repo.Update(promotion); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update promotion"})
+	}
+	return c.JSON(http.StatusOK, promotion)
+}
+
+// DeletePromotion godoc
+// @Summary Delete a promotion
+// @Description Delete a promotion that was never redeemed. Redeemed promotions can be deactivated instead.
+// @Tags promotions
+// @Param id path string true "Promotion ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /promotions/{id} [delete]
+func (ctrl *PromotionController) DeletePromotion(c echo.Context) error {
+	promotion, errResponse := ctrl.findPromotion(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	if err := ctrl.repo.Delete(promotion.ID); err != nil {
+		if errors.Is(err, repositories.ErrPromotionInUse) {
+			return c.JSON(http.StatusConflict, map[string]string{"message": "Promotion has been redeemed, deactivate it instead"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to delete promotion"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ctrl *PromotionController) findPromotion(c echo.Context) (*models.Promotion, *echo.HTTPError) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid promotion ID format")
+	}
+	promotion, err := ctrl.repo.FindByID(id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Promotion not found")
+	}
+	return promotion, nil
+}
+
+// validatePromotion returns why the promotion cannot be saved, or an empty
+// string when it is valid
+func validatePromotion(promotion *models.Promotion) string {
+	switch {
+	case promotion.Code == "":
+		return "Code is required"
+	case len(promotion.Code) > 50:
+		return "Code must be at most 50 characters"
+	case promotion.DiscountType != models.DiscountTypePercentage && promotion.DiscountType != models.DiscountTypeFixed:
+		return "Discount type must be PERCENTAGE or FIXED"
+	case promotion.DiscountValue <= 0:
+		return "Discount value must be greater than 0"
+	case promotion.DiscountType == models.DiscountTypePercentage && promotion.DiscountValue > 100:
+		return "Percentage discount cannot exceed 100"
+	case promotion.MaxDiscount < 0 || promotion.MinOrderAmount < 0:
+		return "Amounts cannot be negative"
+	case promotion.UsageLimit < 0 || promotion.PerUserLimit < 0:
+		return "Usage limits cannot be negative"
+	case promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt):
+		return "End date must be after start date"
+	}
+	return ""
+}
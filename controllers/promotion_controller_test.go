@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestPromotionController(t *testing.T) {
+	e := echo.New()
+	mockPromotionRepo := new(repositories.MockPromotionRepository)
+	ctrl := NewPromotionController(mockPromotionRepo)
+
+	t.Run("CreatePromotion", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			payload     map[string]interface{}
+			setupMocks  func()
+			wantCode    int
+			wantMessage string
+		}{
+			{
+				name:    "created with upper case code",
+				payload: map[string]interface{}{"code": " wedding10 ", "discount_type": "PERCENTAGE", "discount_value": 10, "per_user_limit": 1},
+				setupMocks: func() {
+					mockPromotionRepo.On("FindByCode", "WEDDING10").Return(nil, gorm.ErrRecordNotFound)
+					mockPromotionRepo.On("Create", mock.MatchedBy(func(promotion *models.Promotion) bool {
+						return promotion.Code == "WEDDING10" && promotion.PerUserLimit == 1
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+			},
+			{
+				name:        "percentage above 100",
+				payload:     map[string]interface{}{"code": "HALF", "discount_type": "PERCENTAGE", "discount_value": 150},
+				setupMocks:  func() {},
+				wantCode:    http.StatusBadRequest,
+				wantMessage: "Percentage discount cannot exceed 100",
+			},
+			{
+				name:        "unknown discount type",
+				payload:     map[string]interface{}{"code": "FREE", "discount_type": "FREE", "discount_value": 1},
+				setupMocks:  func() {},
+				wantCode:    http.StatusBadRequest,
+				wantMessage: "Discount type must be PERCENTAGE or FIXED",
+			},
+			{
+				name:    "duplicate code",
+				payload: map[string]interface{}{"code": "WEDDING10", "discount_type": "FIXED", "discount_value": 50000},
+				setupMocks: func() {
+					mockPromotionRepo.On("FindByCode", "WEDDING10").Return(&models.Promotion{ID: uuid.New()}, nil)
+				},
+				wantCode:    http.StatusConflict,
+				wantMessage: "Promo code already exists",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockPromotionRepo.ExpectedCalls = nil
+				tt.setupMocks()
+
+				body, _ := json.Marshal(tt.payload)
+				req := httptest.NewRequest(http.MethodPost, "/promotions", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				assert.NoError(t, ctrl.CreatePromotion(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+				if tt.wantMessage != "" {
+					var response map[string]string
+					json.Unmarshal(rec.Body.Bytes(), &response)
+					assert.Equal(t, tt.wantMessage, response["message"])
+				}
+				mockPromotionRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("UpdatePromotion keeps the code", func(t *testing.T) {
+		mockPromotionRepo.ExpectedCalls = nil
+		existing := &models.Promotion{ID: uuid.New(), Code: "WEDDING10", DiscountType: models.DiscountTypeFixed, DiscountValue: 50000}
+		mockPromotionRepo.On("FindByID", existing.ID).Return(existing, nil)
+		mockPromotionRepo.On("Update", mock.MatchedBy(func(promotion *models.Promotion) bool {
+			return promotion.ID == existing.ID && promotion.Code == "WEDDING10" && promotion.DiscountValue == 75000
+		})).Return(nil)
+
+		body := `{"code":"OTHER","discount_type":"FIXED","discount_value":75000,"is_active":true}`
+		req := httptest.NewRequest(http.MethodPut, "/promotions/"+existing.ID.String(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(existing.ID.String())
+
+		assert.NoError(t, ctrl.UpdatePromotion(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		mockPromotionRepo.AssertExpectations(t)
+	})
+
+	t.Run("DeletePromotion refuses redeemed promotions", func(t *testing.T) {
+		mockPromotionRepo.ExpectedCalls = nil
+		promotion := &models.Promotion{ID: uuid.New()}
+		mockPromotionRepo.On("FindByID", promotion.ID).Return(promotion, nil)
+		mockPromotionRepo.On("Delete", promotion.ID).Return(repositories.ErrPromotionInUse)
+
+		req := httptest.NewRequest(http.MethodDelete, "/promotions/"+promotion.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(promotion.ID.String())
+
+		assert.NoError(t, ctrl.DeletePromotion(c))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"invitified-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultQuoteValidity is how long a saved quote can be booked at its price
+const defaultQuoteValidity = 24 * time.Hour
+
+// QuoteController handles rental price quotes
+type QuoteController struct {
+	repo          repositories.QuoteRepository
+	rentalRepo    repositories.RentalRepository
+	equipmentRepo repositories.EquipmentRepository
+	userRepo      repositories.UserRepository
+	availability  *services.AvailabilityService
+	pricing       services.Pricer
+	exchangeRates *services.ExchangeRates
+	promotions    *services.PromotionService
+	tax           services.TaxPolicy
+	validity      time.Duration
+	now           func() time.Time
+}
+
+// QuoteResponse is a quote together with the current availability of its items
+type QuoteResponse struct {
+	*models.Quote
+	Available    bool                        `json:"available"`
+	Availability []services.ItemAvailability `json:"availability"`
+}
+
+// NewQuoteController creates a new QuoteController
+func NewQuoteController(repo repositories.QuoteRepository, rentalRepo repositories.RentalRepository, equipmentRepo repositories.EquipmentRepository, userRepo repositories.UserRepository, promotionRepo repositories.PromotionRepository, exchangeRateRepo repositories.ExchangeRateRepository) *QuoteController {
+	return &QuoteController{
+		repo:          repo,
+		rentalRepo:    rentalRepo,
+		equipmentRepo: equipmentRepo,
+		userRepo:      userRepo,
+		availability:  services.NewAvailabilityService(rentalRepo),
+		pricing:       services.NewPricingEngine(equipmentRepo, exchangeRateRepo),
+		exchangeRates: services.NewExchangeRates(exchangeRateRepo),
+		promotions:    services.NewPromotionService(promotionRepo),
+		tax:           services.TaxPolicyFromEnv(),
+		validity:      utils.DurationFromEnv("QUOTE_VALIDITY", defaultQuoteValidity),
+		now:           time.Now,
+	}
+}
+
+// CreateQuote godoc
+// @Summary Quote a rental
+// @Description Price a rental without booking it. Pass save=true to keep the quote so it can be booked at the quoted price until it expires. Admins may quote for another customer by setting user_id. A promo_code is applied to the quoted price and redeemed when the quote is booked. Quotes in a currency other than IDR are priced at the exchange rate in force.
+// @Tags rentals
+// @Accept json
+// @Produce json
+// @Param rental body models.Rental true "Rental"
+// @Param save query bool false "Save the quote"
+// @Success 200 {object} QuoteResponse
+// @Success 201 {object} QuoteResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/quote [post]
+func (ctrl *QuoteController) CreateQuote(c echo.Context) error {
+	rental := new(models.Rental)
+	if err := c.Bind(rental); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	// Sales staff quote for customers over the phone
+	if rental.UserID == uuid.Nil {
+		rental.UserID = userID
+	} else if rental.UserID != userID && !isAdmin(ctrl.userRepo, userID) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to quote for another user"})
+	}
+
+	equipmentMap, httpErr := loadRentalEquipment(ctrl.equipmentRepo, rental)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+
+	breakdown, err := ctrl.pricing.PriceRental(rental.Items, equipmentMap, rental.Currency, rental.StartDate, rental.EndDate)
+	if err != nil {
+		httpErr := priceRentalError(err)
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+	if httpErr := applyPromoCode(ctrl.promotions, rental, breakdown, equipmentMap); httpErr != nil {
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+	ctrl.tax.Apply(breakdown)
+
+	availability, err := ctrl.availability.ItemsAvailability(rental.Items, equipmentMap, rental.StartDate, rental.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check availability"})
+	}
+
+	quote := &models.Quote{
+		UserID:         rental.UserID,
+		CreatedBy:      userID,
+		StartDate:      rental.StartDate,
+		EndDate:        rental.EndDate,
+		TotalCost:      breakdown.Total,
+		Currency:       breakdown.Currency,
+		PriceBreakdown: breakdown,
+	}
+	response := QuoteResponse{Quote: quote, Available: true, Availability: availability}
+	for _, item := range availability {
+		if item.Requested > item.Available {
+			response.Available = false
+		}
+	}
+
+	if c.QueryParam("save") != "true" {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	quote.ExpiresAt = ctrl.now().Add(ctrl.validity)
+	if err := ctrl.repo.Create(quote); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to save quote"})
+	}
+	return c.JSON(http.StatusCreated, response)
+}
+
+// GetQuoteByID godoc
+// @Summary Get a saved quote
+// @Description Get a saved quote with the current availability of its items
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Quote ID"
+// @Success 200 {object} QuoteResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/quotes/{id} [get]
+func (ctrl *QuoteController) GetQuoteByID(c echo.Context) error {
+	quote, errResponse := ctrl.findQuote(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+
+	items := quote.RentalItems()
+	equipmentMap, err := ctrl.quotedEquipment(items)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
+	}
+	availability, err := ctrl.availability.ItemsAvailability(items, equipmentMap, quote.StartDate, quote.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check availability"})
+	}
+
+	response := QuoteResponse{Quote: quote, Available: true, Availability: availability}
+	for _, item := range availability {
+		if item.Requested > item.Available {
+			response.Available = false
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// BookQuote godoc
+// @Summary Book a saved quote
+// @Description Create a rental at the quoted price. The quote must not have expired and can only be booked once. Payments are settled at the exchange rate in force at booking, which is stored with the rental.
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Quote ID"
+// @Success 201 {object} models.Rental
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/quotes/{id}/book [post]
+func (ctrl *QuoteController) BookQuote(c echo.Context) error {
+	quote, errResponse := ctrl.findQuote(c)
+	if errResponse != nil {
+		return c.JSON(errResponse.Code, map[string]interface{}{"message": errResponse.Message})
+	}
+	if quote.Status != models.QuoteStatusActive {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Quote has already been booked"})
+	}
+	if !ctrl.now().Before(quote.ExpiresAt) {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Quote has expired"})
+	}
+
+	rental := &models.Rental{
+		UserID:    quote.UserID,
+		StartDate: quote.StartDate,
+		EndDate:   quote.EndDate,
+		TotalCost: quote.TotalCost,
+		Currency:  quote.Currency.OrDefault(),
+		Items:     quote.RentalItems(),
+	}
+	if quote.PriceBreakdown != nil {
+		rental.SetPrice(quote.PriceBreakdown)
+	}
+
+	// The quoted price holds in the quote's currency, what it settles for
+	// follows the exchange rate of the booking day
+	rate, err := ctrl.exchangeRates.Rate(rental.Currency, ctrl.now())
+	if err != nil {
+		httpErr := priceRentalError(err)
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+	rental.ExchangeRate = rate
+
+	// The price is guaranteed, the stock is not
+	equipmentMap, err := ctrl.quotedEquipment(rental.Items)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
+	}
+	conflicts, err := ctrl.availability.CheckItems(rental.Items, equipmentMap, rental.StartDate, rental.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check availability"})
+	}
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"message":   availabilityConflictMessage(conflicts),
+			"conflicts": conflicts,
+		})
+	}
+
+	if err := ctrl.repo.Book(quote, rental); err != nil {
+		if errors.Is(err, repositories.ErrQuoteNotActive) {
+			return c.JSON(http.StatusConflict, map[string]string{"message": "Quote has already been booked or has expired"})
+		}
+		if message, ok := bookingConflictMessage(err); ok {
+			return c.JSON(http.StatusConflict, map[string]string{"message": message})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to book quote"})
+	}
+	return c.JSON(http.StatusCreated, rental)
+}
+
+// findQuote loads the quote in the path if the caller owns it or is an admin
+func (ctrl *QuoteController) findQuote(c echo.Context) (*models.Quote, *echo.HTTPError) {
+	quoteID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid quote ID format")
+	}
+	quote, err := ctrl.repo.FindByID(quoteID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Quote not found")
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok || (quote.UserID != userID && quote.CreatedBy != userID && !isAdmin(ctrl.userRepo, userID)) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Not authorized to access this quote")
+	}
+	return quote, nil
+}
+
+func (ctrl *QuoteController) quotedEquipment(items []models.RentalItem) (map[uuid.UUID]*models.Equipment, error) {
+	equipmentMap := make(map[uuid.UUID]*models.Equipment)
+	for _, item := range items {
+		equipment, err := ctrl.equipmentRepo.FindEquipmentByID(item.EquipmentID)
+		if err != nil {
+			return nil, err
+		}
+		equipmentMap[item.EquipmentID] = equipment
+	}
+	return equipmentMap, nil
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestQuoteController(t *testing.T) {
+	e := echo.New()
+	mockQuoteRepo := new(repositories.MockQuoteRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockEquipmentRepo := new(repositories.MockEquipmentRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	mockPromotionRepo := new(repositories.MockPromotionRepository)
+	mockExchangeRateRepo := new(repositories.MockExchangeRateRepository)
+	ctrl := NewQuoteController(mockQuoteRepo, mockRentalRepo, mockEquipmentRepo, mockUserRepo, mockPromotionRepo, mockExchangeRateRepo)
+
+	now := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	ctrl.now = func() time.Time { return now }
+
+	userID := uuid.New()
+	equipment := &models.Equipment{
+		ID:            uuid.New(),
+		Name:          "Projector",
+		RentalPrice:   models.NewMoney(100),
+		StockQuantity: 3,
+		IsAvailable:   true,
+	}
+
+	t.Run("CreateQuote", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			query         string
+			booked        int
+			wantCode      int
+			wantSaved     bool
+			wantAvailable bool
+		}{
+			{
+				name:          "preview does not save",
+				booked:        0,
+				wantCode:      http.StatusOK,
+				wantAvailable: true,
+			},
+			{
+				name:          "preview reports missing stock",
+				booked:        2,
+				wantCode:      http.StatusOK,
+				wantAvailable: false,
+			},
+			{
+				name:          "saved quote",
+				query:         "?save=true",
+				booked:        0,
+				wantCode:      http.StatusCreated,
+				wantSaved:     true,
+				wantAvailable: true,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockQuoteRepo.ExpectedCalls = nil
+				mockQuoteRepo.Calls = nil
+				mockRentalRepo.ExpectedCalls = nil
+				mockEquipmentRepo.ExpectedCalls = nil
+
+				mockEquipmentRepo.On("FindEquipmentByID", equipment.ID).Return(equipment, nil)
+				mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.Anything, mock.Anything).Return(tt.booked, nil)
+				if tt.wantSaved {
+					mockQuoteRepo.On("Create", mock.MatchedBy(func(quote *models.Quote) bool {
+						return quote.ExpiresAt.Equal(now.Add(defaultQuoteValidity))
+					})).Return(nil)
+				}
+
+				payload := models.Rental{
+					StartDate: now,
+					EndDate:   now.Add(48 * time.Hour),
+					Items:     []models.RentalItem{{EquipmentID: equipment.ID, Quantity: 2}},
+				}
+				body, _ := json.Marshal(payload)
+				req := httptest.NewRequest(http.MethodPost, "/rentals/quote"+tt.query, bytes.NewReader(body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.Set("userID", userID.String())
+
+				assert.NoError(t, ctrl.CreateQuote(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+
+				var response QuoteResponse
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantAvailable, response.Available)
+				assert.Equal(t, models.NewMoney(400), response.TotalCost)
+				assert.Equal(t, 2, response.PriceBreakdown.Lines[0].Days)
+
+				mockQuoteRepo.AssertExpectations(t)
+				if !tt.wantSaved {
+					mockQuoteRepo.AssertNotCalled(t, "Create", mock.Anything)
+				}
+			})
+		}
+	})
+
+	t.Run("BookQuote", func(t *testing.T) {
+		activeQuote := func(expiresAt time.Time) *models.Quote {
+			return &models.Quote{
+				ID:        uuid.New(),
+				UserID:    userID,
+				CreatedBy: userID,
+				StartDate: now.Add(24 * time.Hour),
+				EndDate:   now.Add(72 * time.Hour),
+				TotalCost: models.NewMoney(350),
+				PriceBreakdown: &models.PriceBreakdown{
+					Lines: []models.PriceLine{{EquipmentID: equipment.ID, EquipmentName: equipment.Name, Quantity: 2}},
+					Total: models.NewMoney(350),
+				},
+				Status:    models.QuoteStatusActive,
+				ExpiresAt: expiresAt,
+			}
+		}
+
+		dollarQuote := activeQuote(now.Add(time.Hour))
+		dollarQuote.Currency = models.CurrencyUSD
+		dollarQuote.PriceBreakdown.Currency = models.CurrencyUSD
+		dollarQuote.PriceBreakdown.ExchangeRate = 15000
+
+		tests := []struct {
+			name         string
+			quote        *models.Quote
+			exchangeRate *models.ExchangeRate
+			wantCode     int
+		}{
+			{
+				name:     "books at the quoted price",
+				quote:    activeQuote(now.Add(time.Hour)),
+				wantCode: http.StatusCreated,
+			},
+			{
+				name:         "settles at the rate of the booking day",
+				quote:        dollarQuote,
+				exchangeRate: &models.ExchangeRate{Currency: models.CurrencyUSD, Rate: 15500},
+				wantCode:     http.StatusCreated,
+			},
+			{
+				name:     "expired quote",
+				quote:    activeQuote(now.Add(-time.Hour)),
+				wantCode: http.StatusConflict,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockQuoteRepo.ExpectedCalls = nil
+				mockRentalRepo.ExpectedCalls = nil
+				mockEquipmentRepo.ExpectedCalls = nil
+				mockExchangeRateRepo.ExpectedCalls = nil
+
+				mockQuoteRepo.On("FindByID", tt.quote.ID).Return(tt.quote, nil)
+				wantRate := 1.0
+				if tt.exchangeRate != nil {
+					mockExchangeRateRepo.On("FindEffective", tt.exchangeRate.Currency, now).Return(tt.exchangeRate, nil)
+					wantRate = tt.exchangeRate.Rate
+				}
+				if tt.wantCode == http.StatusCreated {
+					mockEquipmentRepo.On("FindEquipmentByID", equipment.ID).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, tt.quote.StartDate, tt.quote.EndDate).Return(0, nil)
+					mockQuoteRepo.On("Book", tt.quote, mock.MatchedBy(func(rental *models.Rental) bool {
+						return rental.TotalCost == models.NewMoney(350) && rental.UserID == userID && len(rental.Items) == 1 &&
+							rental.Currency == tt.quote.Currency.OrDefault() && rental.ExchangeRate == wantRate
+					})).Return(nil)
+				}
+
+				req := httptest.NewRequest(http.MethodPost, "/", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetPath("/rentals/quotes/:id/book")
+				c.SetParamNames("id")
+				c.SetParamValues(tt.quote.ID.String())
+				c.Set("userID", userID.String())
+
+				assert.NoError(t, ctrl.BookQuote(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+
+				mockQuoteRepo.AssertExpectations(t)
+				mockExchangeRateRepo.AssertExpectations(t)
+			})
+		}
+	})
+}
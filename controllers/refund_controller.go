@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RefundController handles refunds of payments
+type RefundController struct {
+	paymentRepo repositories.PaymentRepository
+	refundRepo  repositories.RefundRepository
+	refunds     *services.RefundService
+}
+
+// RefundRequest represents a request to refund a payment
+type RefundRequest struct {
+	// Amount to refund. Everything that was not refunded yet when omitted.
+	Amount models.Money `json:"amount,omitempty"`
+	Reason string       `json:"reason" validate:"required"`
+}
+
+// RefundResponse is returned when a refund is created
+type RefundResponse struct {
+	Refund  *models.Refund  `json:"refund"`
+	Payment *models.Payment `json:"payment"`
+}
+
+// XenditRefundCallback is the body Xendit posts when a refund succeeds or
+// fails
+type XenditRefundCallback struct {
+	Event string                   `json:"event"`
+	Data  XenditRefundCallbackData `json:"data"`
+}
+
+// XenditRefundCallbackData is the refund inside a refund callback
+type XenditRefundCallbackData struct {
+	ID          string       `json:"id"`
+	ReferenceID string       `json:"reference_id"`
+	Status      string       `json:"status"`
+	Amount      models.Money `json:"amount"`
+	FailureCode string       `json:"failure_code"`
+}
+
+// NewRefundController creates a new RefundController
+func NewRefundController(pr repositories.PaymentRepository, rfr repositories.RefundRepository, ur repositories.UserRepository, gateway gateways.PaymentGateway) *RefundController {
+	return &RefundController{
+		paymentRepo: pr,
+		refundRepo:  rfr,
+		refunds:     services.NewRefundService(rfr, ur, gateway),
+	}
+}
+
+// CreateRefund godoc
+// @Summary Refund a payment
+// @Description Refund all or part of a QR code or e-wallet payment through the payment provider. Refunds of a payment can never add up to more than was paid. The points used on the payment are returned and the points earned on it taken back in proportion, and the customer is emailed a receipt once the refund succeeds.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Param refund body RefundRequest true "Refund Request"
+// @Success 201 {object} RefundResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /payments/{id}/refunds [post]
+func (ctrl *RefundController) CreateRefund(c echo.Context) error {
+	paymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid payment ID format"})
+	}
+
+	var req RefundRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	if req.Amount < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Refund amount must be positive"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Refund reason is required"})
+	}
+
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	payment, err := ctrl.paymentRepo.FindByID(paymentID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Payment not found"})
+	}
+
+	refund := &models.Refund{
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		RequestedBy: adminID,
+	}
+	err = ctrl.refunds.Refund(c.Request().Context(), payment, refund)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrRefundNotSupported):
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Virtual account payments cannot be refunded through the payment provider"})
+	case errors.Is(err, repositories.ErrPaymentNotRefundable):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Payment has nothing left to refund"})
+	case errors.Is(err, repositories.ErrRefundExceedsPayment):
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Refund amount exceeds what is left to refund on this payment"})
+	case errors.Is(err, services.ErrRefundNotAccepted):
+		log.Printf("Failed to refund payment %s: %v", payment.ID, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"message": "Payment provider did not accept the refund"})
+	default:
+		log.Printf("Failed to refund payment %s: %v", payment.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to refund payment"})
+	}
+
+	return c.JSON(http.StatusCreated, RefundResponse{Refund: refund, Payment: payment})
+}
+
+// XenditRefundCallback godoc
+// @Summary Xendit refund callback
+// @Description Receives refund status notifications from Xendit. Requests must carry the callback verification token in the x-callback-token header.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param callback body XenditRefundCallback true "Xendit refund callback"
+// @Param x-callback-token header string true "Xendit callback verification token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /payments/callbacks/xendit/refunds [post]
+func (ctrl *RefundController) XenditRefundCallback(c echo.Context) error {
+	if !validXenditCallbackToken(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid callback token"})
+	}
+
+	var callback XenditRefundCallback
+	if err := json.NewDecoder(c.Request().Body).Decode(&callback); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid callback payload"})
+	}
+	refundIDStr, ok := services.ParseRefundReferenceID(callback.Data.ReferenceID)
+	if !ok {
+		// Refunds made outside this service, e.g. from the Xendit dashboard
+		return c.JSON(http.StatusOK, map[string]string{"message": "Event ignored"})
+	}
+	refundID, err := uuid.Parse(refundIDStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid callback payload"})
+	}
+
+	refund, err := ctrl.refundRepo.FindByID(refundID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Refund not found"})
+	}
+	payment, err := ctrl.paymentRepo.FindByID(refund.PaymentID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Payment not found"})
+	}
+
+	refund.XenditRefundID = callback.Data.ID
+	err = ctrl.refunds.ApplyStatus(refund, payment, callback.Data.Status, callback.Data.FailureCode)
+	if errors.Is(err, repositories.ErrRefundNotPending) {
+		return c.JSON(http.StatusOK, map[string]string{"message": "Refund already processed"})
+	}
+	if err != nil {
+		log.Printf("Failed to record refund %s: %v", refund.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to record refund"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Refund recorded"})
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRefundController_CreateRefund(t *testing.T) {
+	e := echo.New()
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRefundRepo := new(repositories.MockRefundRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+
+	adminID := uuid.New()
+	customerID := uuid.New()
+	newPayment := func(method string) *models.Payment {
+		return &models.Payment{
+			ID:               uuid.New(),
+			RentalID:         uuid.New(),
+			UserID:           customerID,
+			Amount:           models.NewMoney(100000),
+			XenditPaidAmount: models.NewMoney(100000),
+			PointsUsed:       50,
+			PaymentMethod:    method,
+			PaymentStatus:    models.PaymentStatusCompleted,
+			XenditInvoiceID:  "ewc-1",
+			XenditPaymentID:  "qrpy-1",
+		}
+	}
+	reserve := func(args mock.Arguments) {
+		refund := args.Get(0).(*models.Refund)
+		refund.ID = uuid.New()
+		refund.UserID = customerID
+		refund.Status = models.RefundStatusPending
+	}
+
+	tests := []struct {
+		name          string
+		payment       *models.Payment
+		body          string
+		refundStatus  string
+		gatewayErr    error
+		setupMocks    func(payment *models.Payment)
+		expectedCode  int
+		expectedMsg   string
+		checkResponse func(t *testing.T, gateway *gateways.FakeGateway, resp RefundResponse)
+	}{
+		{
+			name:    "partial e-wallet refund",
+			payment: newPayment(models.PaymentMethodEWallet),
+			body:    `{"amount": 40000, "reason": "One item was damaged"}`,
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Run(reserve).Return(nil)
+				mockRefundRepo.On("MarkSucceeded", mock.AnythingOfType("*models.Refund"), payment).Run(func(args mock.Arguments) {
+					args.Get(0).(*models.Refund).Status = models.RefundStatusSucceeded
+					args.Get(1).(*models.Payment).RefundedAmount = models.NewMoney(40000)
+					args.Get(1).(*models.Payment).PaymentStatus = models.PaymentStatusPartiallyRefunded
+				}).Return(nil)
+				mockUserRepo.On("FindByID", customerID).Return(&models.User{ID: customerID, Email: "customer@example.com"}, nil)
+			},
+			expectedCode: http.StatusCreated,
+			checkResponse: func(t *testing.T, gateway *gateways.FakeGateway, resp RefundResponse) {
+				assert.Len(t, gateway.RefundRequests, 1)
+				assert.Equal(t, "ewc-1", gateway.RefundRequests[0].InvoiceID)
+				assert.Equal(t, float64(40000), gateway.RefundRequests[0].Amount)
+				assert.Equal(t, "refund-"+resp.Refund.ID.String(), gateway.RefundRequests[0].ReferenceID)
+				assert.Equal(t, models.RefundStatusSucceeded, resp.Refund.Status)
+				assert.Equal(t, adminID, resp.Refund.RequestedBy)
+				assert.Equal(t, models.PaymentStatusPartiallyRefunded, resp.Payment.PaymentStatus)
+			},
+		},
+		{
+			name:         "QR refund waits for the callback",
+			payment:      newPayment(models.PaymentMethodQRCode),
+			body:         `{"reason": "Rental cancelled"}`,
+			refundStatus: gateways.RefundStatusPending,
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Run(func(args mock.Arguments) {
+					reserve(args)
+					args.Get(0).(*models.Refund).Amount = models.NewMoney(100000)
+				}).Return(nil)
+				mockRefundRepo.On("SetXenditRefundID", mock.AnythingOfType("*models.Refund")).Return(nil)
+			},
+			expectedCode: http.StatusCreated,
+			checkResponse: func(t *testing.T, gateway *gateways.FakeGateway, resp RefundResponse) {
+				assert.Equal(t, "qrpy-1", gateway.RefundRequests[0].QRPaymentID)
+				assert.Equal(t, float64(100000), gateway.RefundRequests[0].Amount)
+				assert.Equal(t, models.RefundStatusPending, resp.Refund.Status)
+				assert.NotEmpty(t, resp.Refund.XenditRefundID)
+			},
+		},
+		{
+			name:    "refund exceeds amount paid",
+			payment: newPayment(models.PaymentMethodEWallet),
+			body:    `{"amount": 150000, "reason": "Too much"}`,
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Return(repositories.ErrRefundExceedsPayment)
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "Refund amount exceeds what is left to refund on this payment",
+		},
+		{
+			name:    "payment already refunded",
+			payment: newPayment(models.PaymentMethodEWallet),
+			body:    `{"reason": "Again"}`,
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Return(repositories.ErrPaymentNotRefundable)
+			},
+			expectedCode: http.StatusConflict,
+			expectedMsg:  "Payment has nothing left to refund",
+		},
+		{
+			name:    "virtual account payment",
+			payment: newPayment(models.PaymentMethodVirtualAccount),
+			body:    `{"reason": "Cancelled"}`,
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+			},
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "Virtual account payments cannot be refunded through the payment provider",
+		},
+		{
+			name:       "gateway rejects refund",
+			payment:    newPayment(models.PaymentMethodEWallet),
+			body:       `{"amount": 10000, "reason": "Cancelled"}`,
+			gatewayErr: &gateways.APIError{StatusCode: http.StatusBadRequest, ErrorCode: "INELIGIBLE_TRANSACTION"},
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Run(reserve).Return(nil)
+				mockRefundRepo.On("MarkFailed", mock.MatchedBy(func(refund *models.Refund) bool {
+					return refund.FailureCode == "INELIGIBLE_TRANSACTION"
+				})).Return(nil)
+			},
+			expectedCode: http.StatusBadGateway,
+			expectedMsg:  "Payment provider did not accept the refund",
+		},
+		{
+			name:       "gateway unreachable keeps refund pending",
+			payment:    newPayment(models.PaymentMethodEWallet),
+			body:       `{"amount": 10000, "reason": "Cancelled"}`,
+			gatewayErr: errors.New("connection reset"),
+			setupMocks: func(payment *models.Payment) {
+				mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil)
+				mockRefundRepo.On("Create", mock.AnythingOfType("*models.Refund")).Run(reserve).Return(nil)
+			},
+			expectedCode: http.StatusBadGateway,
+			expectedMsg:  "Payment provider did not accept the refund",
+		},
+		{
+			name:         "missing reason",
+			payment:      newPayment(models.PaymentMethodEWallet),
+			body:         `{"amount": 10000}`,
+			setupMocks:   func(payment *models.Payment) {},
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "Refund reason is required",
+		},
+		{
+			name:         "negative amount",
+			payment:      newPayment(models.PaymentMethodEWallet),
+			body:         `{"amount": -1, "reason": "Cancelled"}`,
+			setupMocks:   func(payment *models.Payment) {},
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "Refund amount must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPaymentRepo.ExpectedCalls = nil
+			mockRefundRepo.ExpectedCalls = nil
+			mockUserRepo.ExpectedCalls = nil
+			tt.setupMocks(tt.payment)
+
+			gateway := gateways.NewFakeGateway()
+			gateway.RefundStatus = tt.refundStatus
+			gateway.Err = tt.gatewayErr
+			ctrl := NewRefundController(mockPaymentRepo, mockRefundRepo, mockUserRepo, gateway)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.payment.ID.String())
+			c.Set("userID", adminID.String())
+
+			err := ctrl.CreateRefund(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedMsg != "" {
+				var response map[string]string
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedMsg, response["message"])
+			}
+			if tt.checkResponse != nil {
+				var response RefundResponse
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				tt.checkResponse(t, gateway, response)
+			}
+
+			mockPaymentRepo.AssertExpectations(t)
+			mockRefundRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRefundController_XenditRefundCallback(t *testing.T) {
+	t.Setenv("XENDIT_CALLBACK_TOKEN", "callback-secret")
+
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRefundRepo := new(repositories.MockRefundRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	ctrl := NewRefundController(mockPaymentRepo, mockRefundRepo, mockUserRepo, gateways.NewFakeGateway())
+
+	e := echo.New()
+	e.POST("/payments/callbacks/xendit/refunds", ctrl.XenditRefundCallback)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	xendit := &fakeXendit{t: t, callbackURL: server.URL + "/payments/callbacks/xendit/refunds", token: "callback-secret"}
+
+	payment := &models.Payment{ID: uuid.New(), RentalID: uuid.New(), UserID: uuid.New(), PaymentStatus: models.PaymentStatusCompleted}
+	refund := &models.Refund{ID: uuid.New(), PaymentID: payment.ID, UserID: payment.UserID, Amount: models.NewMoney(25000), Status: models.RefundStatusPending}
+	refundEvent := func(status string) []byte {
+		body, _ := json.Marshal(XenditRefundCallback{
+			Event: "refund.succeeded",
+			Data: XenditRefundCallbackData{
+				ID:          "rfd-1",
+				ReferenceID: "refund-" + refund.ID.String(),
+				Status:      status,
+				Amount:      refund.Amount,
+			},
+		})
+		return body
+	}
+
+	t.Run("refund succeeded", func(t *testing.T) {
+		mockRefundRepo.On("FindByID", refund.ID).Return(refund, nil).Once()
+		mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil).Once()
+		mockRefundRepo.On("MarkSucceeded", refund, payment).Return(nil).Once()
+		mockUserRepo.On("FindByID", payment.UserID).Return(&models.User{Email: "customer@example.com"}, nil).Once()
+
+		resp := xendit.post(refundEvent(gateways.RefundStatusSucceeded))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "rfd-1", refund.XenditRefundID)
+	})
+
+	t.Run("repeated delivery", func(t *testing.T) {
+		mockRefundRepo.On("FindByID", refund.ID).Return(refund, nil).Once()
+		mockPaymentRepo.On("FindByID", payment.ID).Return(payment, nil).Once()
+		mockRefundRepo.On("MarkSucceeded", refund, payment).Return(repositories.ErrRefundNotPending).Once()
+
+		resp := xendit.post(refundEvent(gateways.RefundStatusSucceeded))
+		defer resp.Body.Close()
+
+		var response map[string]string
+		json.NewDecoder(resp.Body).Decode(&response)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Refund already processed", response["message"])
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		impostor := &fakeXendit{t: t, callbackURL: xendit.callbackURL, token: "wrong"}
+		resp := impostor.post(refundEvent(gateways.RefundStatusSucceeded))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	mockRefundRepo.AssertExpectations(t)
+	mockPaymentRepo.AssertExpectations(t)
+}
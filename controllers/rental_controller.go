@@ -1,9 +1,17 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"invitified-go/gateways"
 	"invitified-go/models"
 	"invitified-go/repositories"
+	"invitified-go/services"
+	"invitified-go/utils"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -13,16 +21,57 @@ import (
 type RentalController struct {
 	repo          repositories.RentalRepository
 	equipmentRepo repositories.EquipmentRepository
+	paymentRepo   repositories.PaymentRepository
+	userRepo      repositories.UserRepository
+	depositRepo   repositories.DepositRepository
+	availability  *services.AvailabilityService
+	pricing       services.Pricer
+	lifecycle     *services.RentalLifecycle
+	cancellation  services.CancellationPolicy
+	promotions    *services.PromotionService
+	tax           services.TaxPolicy
+	lateFees      *services.LateFees
+	refunds       *services.RefundService
+}
+
+// ExtendRentalRequest represents a request to extend a rental
+type ExtendRentalRequest struct {
+	EndDate time.Time `json:"end_date" validate:"required"`
+}
+
+// UpdateRentalRequest lists the details of a rental that can be corrected
+// without repricing it. Fields left out are not changed.
+type UpdateRentalRequest struct {
+	CancelReason *string `json:"cancel_reason"`
+}
+
+// CancelRentalRequest represents a request to cancel a rental
+type CancelRentalRequest struct {
+	Reason string `json:"reason" validate:"required"`
 }
 
 // NewRentalController creates a new RentalController
-func NewRentalController(repo repositories.RentalRepository, equipmentRepo repositories.EquipmentRepository) *RentalController {
-	return &RentalController{repo, equipmentRepo}
+func NewRentalController(repo repositories.RentalRepository, equipmentRepo repositories.EquipmentRepository, paymentRepo repositories.PaymentRepository, userRepo repositories.UserRepository, promotionRepo repositories.PromotionRepository, exchangeRateRepo repositories.ExchangeRateRepository, depositRepo repositories.DepositRepository, lateFeeRepo repositories.LateFeeRepository, refundRepo repositories.RefundRepository, gateway gateways.PaymentGateway) *RentalController {
+	return &RentalController{
+		repo:          repo,
+		equipmentRepo: equipmentRepo,
+		paymentRepo:   paymentRepo,
+		userRepo:      userRepo,
+		depositRepo:   depositRepo,
+		availability:  services.NewAvailabilityService(repo),
+		pricing:       services.NewPricingEngine(equipmentRepo, exchangeRateRepo),
+		lifecycle:     services.NewRentalLifecycle(repo),
+		cancellation:  services.CancellationPolicyFromEnv(),
+		promotions:    services.NewPromotionService(promotionRepo),
+		tax:           services.TaxPolicyFromEnv(),
+		lateFees:      services.NewLateFees(lateFeeRepo, userRepo),
+		refunds:       services.NewRefundService(refundRepo, userRepo, gateway),
+	}
 }
 
 // CreateRental godoc
 // @Summary Create a new rental
-// @Description Create a new rental
+// @Description Create a new rental. A promo_code takes its discount off the total. The currency defaults to IDR, other currencies are converted at the exchange rate in force and the rate is stored with the rental.
 // @Tags rentals
 // @Accept json
 // @Produce json
@@ -31,6 +80,7 @@ func NewRentalController(repo repositories.RentalRepository, equipmentRepo repos
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} models.ErrorResponse
 // @Param Authorization header string true "token" default(<token>)
 // @Router /rentals [post]
@@ -52,27 +102,39 @@ func (ctrl *RentalController) CreateRental(c echo.Context) error {
 
 	rental.UserID = userID
 
-	// Calculate total cost and set equipment names in one loop
-	var totalCost float64
-	equipmentMap := make(map[uuid.UUID]*models.Equipment)
-
-	for i := range rental.Items {
-		equipment, err := ctrl.equipmentRepo.FindEquipmentByID(rental.Items[i].EquipmentID)
-		if err != nil {
-			return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
-		}
-		equipmentMap[equipment.ID] = equipment
+	equipmentMap, httpErr := loadRentalEquipment(ctrl.equipmentRepo, rental)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
 
-		duration := rental.EndDate.Sub(rental.StartDate).Hours() / 24
-		itemCost := float64(rental.Items[i].Quantity) * equipment.RentalPrice * duration
-		totalCost += itemCost
+	breakdown, err := ctrl.pricing.PriceRental(rental.Items, equipmentMap, rental.Currency, rental.StartDate, rental.EndDate)
+	if err != nil {
+		httpErr := priceRentalError(err)
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+	if httpErr := applyPromoCode(ctrl.promotions, rental, breakdown, equipmentMap); httpErr != nil {
+		return c.JSON(httpErr.Code, map[string]interface{}{"message": httpErr.Message})
+	}
+	ctrl.tax.Apply(breakdown)
+	rental.SetPrice(breakdown)
 
-		rental.Items[i].EquipmentName = equipment.Name
+	// Reject the booking if any item would exceed the free stock
+	conflicts, err := ctrl.availability.CheckItems(rental.Items, equipmentMap, rental.StartDate, rental.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check availability"})
+	}
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"message":   availabilityConflictMessage(conflicts),
+			"conflicts": conflicts,
+		})
 	}
-	rental.TotalCost = totalCost
 
 	// Create rental and rental items
 	if err := ctrl.repo.Create(rental); err != nil {
+		if message, ok := bookingConflictMessage(err); ok {
+			return c.JSON(http.StatusConflict, map[string]string{"message": message})
+		}
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
@@ -87,6 +149,7 @@ func (ctrl *RentalController) CreateRental(c echo.Context) error {
 // @Param id path string true "Rental ID"
 // @Success 200 {object} models.Rental
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Param Authorization header string true "token" default(<token>)
 // @Router /rentals/{id} [get]
@@ -100,88 +163,120 @@ func (ctrl *RentalController) GetRentalByID(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusNotFound, err)
 	}
-
-	for i := range rental.Items {
-		equipment, err := ctrl.equipmentRepo.FindEquipmentByID(rental.Items[i].EquipmentID)
-		if err != nil {
-			return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
-		}
-		rental.Items[i].EquipmentName = equipment.Name
+	if !ctrl.canAccessRental(c, rental) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to view this rental"})
 	}
+	ctrl.fillMissingEquipmentNames(rental)
 
 	return c.JSON(http.StatusOK, rental)
 }
 
 // GetAllRentals godoc
 // @Summary Get all rentals
-// @Description Get all rentals
+// @Description Get the caller's rentals. Admins see every rental and may filter by user.
 // @Tags rentals
 // @Produce json
-// @Success 200 {array} models.Rental
+// @Param status query string false "Rental status"
+// @Param user_id query string false "User ID (admins only)"
+// @Param equipment_id query string false "Equipment ID"
+// @Param from query string false "Only rentals ending after this time (RFC 3339)"
+// @Param to query string false "Only rentals starting before this time (RFC 3339)"
+// @Param sort query string false "start_date, end_date, created_at or total_cost, prefix with - for descending"
+// @Param page query int false "Page"
+// @Param limit query int false "Limit"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Param Authorization header string true "token" default(<token>)
 // @Router /rentals [get]
 func (ctrl *RentalController) GetAllRentals(c echo.Context) error {
-	rentals, err := ctrl.repo.FindAll()
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+	}
+
+	filter, err := parseRentalFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	// Regular users only ever see their own rentals
+	if !isAdmin(ctrl.userRepo, userID) {
+		filter.UserID = userID
+	}
+
+	pagination := utils.GetPagination(c)
+	rentals, total, err := ctrl.repo.FindWithFilter(filter, pagination.Limit, pagination.Offset)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
+	utils.SetPagination(&pagination, total)
 
-	// Fetch equipment names for each rental item
 	for i := range rentals {
-		for j := range rentals[i].Items {
-			equipment, err := ctrl.equipmentRepo.FindEquipmentByID(rentals[i].Items[j].EquipmentID)
-			if err != nil {
-				return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
-			}
-			rentals[i].Items[j].EquipmentName = equipment.Name
-		}
+		ctrl.fillMissingEquipmentNames(&rentals[i])
 	}
 
-	return c.JSON(http.StatusOK, rentals)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       rentals,
+		"pagination": pagination,
+	})
 }
 
 // UpdateRental godoc
 // @Summary Update a rental
-// @Description Update a rental
+// @Description Correct the recorded details of one of your rentals, or any rental as an admin. Dates and items change through the extension endpoints, amounts through pricing and payments, and the status through the status endpoints.
 // @Tags rentals
 // @Accept json
 // @Produce json
 // @Param id path string true "Rental ID"
-// @Param rental body models.Rental true "Rental"
+// @Param rental body UpdateRentalRequest true "Rental details"
 // @Success 200 {object} models.Rental
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Param Authorization header string true "token" default(<token>)
 // @Router /rentals/{id} [put]
 func (ctrl *RentalController) UpdateRental(c echo.Context) error {
-	id := c.Param("id")
-	rentalID, err := uuid.Parse(id)
+	rentalID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID"})
+	}
+	var req UpdateRentalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
 	}
 	rental, err := ctrl.repo.FindByID(rentalID)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, err)
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
 	}
-	if err := c.Bind(rental); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	if !ctrl.canAccessRental(c, rental) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to update this rental"})
+	}
+
+	if req.CancelReason != nil {
+		if rental.Status != models.RentalStatusCancelled {
+			return c.JSON(http.StatusBadRequest, map[string]string{"message": "Only cancelled rentals have a cancel reason"})
+		}
+		rental.CancelReason = *req.CancelReason
 	}
 	if err := ctrl.repo.Update(rental); err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update rental"})
 	}
 	return c.JSON(http.StatusOK, rental)
 }
 
 // DeleteRental godoc
 // @Summary Delete a rental
-// @Description Delete a rental
+// @Description Delete a PENDING rental. Paid rentals must be cancelled instead.
 // @Tags rentals
 // @Produce json
 // @Param id path string true "Rental ID"
 // @Success 204
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Param Authorization header string true "token" default(<token>)
 // @Router /rentals/{id} [delete]
@@ -191,8 +286,538 @@ func (ctrl *RentalController) DeleteRental(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, err)
 	}
+	rental, err := ctrl.repo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, err)
+	}
+	if !ctrl.canAccessRental(c, rental) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to delete this rental"})
+	}
+	// Keep paid rentals and their payments for auditing
+	if rental.Status != models.RentalStatusPending {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Only pending rentals can be deleted, cancel the rental instead"})
+	}
 	if err := ctrl.repo.Delete(rentalID); err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 	return c.NoContent(http.StatusNoContent)
 }
+
+// PickupRental godoc
+// @Summary Mark a rental as picked up
+// @Description Move a PAID rental to PICKED_UP once its rental period has started
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {object} models.Rental
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/pickup [post]
+func (ctrl *RentalController) PickupRental(c echo.Context) error {
+	return ctrl.transitionRental(c, models.RentalStatusPickedUp)
+}
+
+// ReturnRental godoc
+// @Summary Mark a rental as returned
+// @Description Move a PICKED_UP or OVERDUE rental to RETURNED. Equipment returned after the end date and grace period is charged a late fee up to the return.
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {object} models.Rental
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/return [post]
+func (ctrl *RentalController) ReturnRental(c echo.Context) error {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID format"})
+	}
+	rental, err := ctrl.repo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
+	}
+
+	if err := ctrl.lifecycle.Transition(rental, models.RentalStatusReturned, nil); err != nil {
+		return transitionErrorResponse(c, err)
+	}
+	// The fee stops growing with the return. The return stands when the fee
+	// cannot be stored, the overdue job does not charge returned rentals.
+	if _, err := ctrl.lateFees.Accrue(rental, *rental.ReturnedAt); err != nil {
+		log.Printf("Failed to charge late fee of rental %s: %v", rental.ID, err)
+	}
+	return c.JSON(http.StatusOK, rental)
+}
+
+// CompleteRental godoc
+// @Summary Complete a rental
+// @Description Move a RETURNED rental to COMPLETED after the equipment has been checked
+// @Tags rentals
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Success 200 {object} models.Rental
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/complete [post]
+func (ctrl *RentalController) CompleteRental(c echo.Context) error {
+	return ctrl.transitionRental(c, models.RentalStatusComplete)
+}
+
+// CancelRental godoc
+// @Summary Cancel a rental
+// @Description Cancel a PENDING or PAID rental and refund the payments according to the cancellation policy. A security deposit is refunded in full. Payments that cannot be refunded through the payment provider are marked REFUND_PENDING.
+// @Tags rentals
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Param request body CancelRentalRequest true "Cancellation"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/cancel [post]
+func (ctrl *RentalController) CancelRental(c echo.Context) error {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID format"})
+	}
+
+	var req CancelRentalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "A cancellation reason is required"})
+	}
+
+	rental, err := ctrl.repo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
+	}
+	if !ctrl.canAccessRental(c, rental) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to cancel this rental"})
+	}
+
+	payments, err := ctrl.paymentRepo.FindByRentalID(rental.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to load payments"})
+	}
+	// Payments are charged in the settlement currency, so that is the
+	// currency the refund is paid back in
+	var paid, deposit models.Money
+	refundCurrency := models.DefaultCurrency
+	for _, payment := range payments {
+		if payment.PaymentStatus == models.PaymentStatusCompleted {
+			paid += payment.Amount - payment.DepositAmount
+			deposit += payment.DepositAmount
+			refundCurrency = payment.Currency.OrDefault()
+		}
+	}
+
+	now := time.Now()
+	refundPercent := ctrl.cancellation.RefundPercent(rental, now)
+	policyRefund := ctrl.cancellation.RefundAmount(rental, paid, refundCurrency, now)
+	refundAmount := policyRefund + deposit
+
+	if err := ctrl.lifecycle.Transition(rental, models.RentalStatusCancelled, map[string]interface{}{
+		"cancel_reason":   req.Reason,
+		"refund_amount":   refundAmount,
+		"refund_currency": refundCurrency,
+	}); err != nil {
+		return transitionErrorResponse(c, err)
+	}
+	rental.CancelReason = req.Reason
+	rental.RefundAmount = refundAmount
+	rental.RefundCurrency = refundCurrency
+
+	// Unpaid virtual accounts must not be settled for a cancelled rental
+	if err := ctrl.paymentRepo.ExpirePendingByRentalID(rental.ID, now); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to expire pending payments"})
+	}
+	// The deposit is released in full and goes back with the refund
+	userID, _ := currentUserID(c)
+	var settlement *repositories.DepositSettlement
+	if deposit > 0 {
+		settlement, err = ctrl.depositRepo.Settle(rental.ID, 0, "Rental cancelled", userID)
+		if err != nil && !errors.Is(err, repositories.ErrDepositNotHeld) {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to release deposit"})
+		}
+	}
+	refunds := ctrl.refundCancellation(c, payments, policyRefund, settlement, userID)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rental":          rental,
+		"refund_percent":  refundPercent,
+		"refund_amount":   refundAmount,
+		"refund_currency": refundCurrency,
+		"refunds":         refunds,
+	})
+}
+
+// refundCancellation refunds the amount the cancellation policy gives back,
+// taken from the completed payments in order, and the deposit to release
+// from the payment that collected it. The deposit is released when its
+// refund succeeds. A payment the gateway cannot refund, such as a virtual
+// account transfer, is marked REFUND_PENDING to be returned by hand together
+// with its deposit.
+func (ctrl *RentalController) refundCancellation(c echo.Context, payments []models.Payment, amount models.Money, deposit *repositories.DepositSettlement, requestedBy uuid.UUID) []models.Refund {
+	refunds := []models.Refund{}
+	for i := range payments {
+		payment := &payments[i]
+		if payment.PaymentStatus != models.PaymentStatusCompleted {
+			continue
+		}
+
+		var parts []*models.Refund
+		if share := min(amount, payment.Amount-payment.DepositAmount); share > 0 {
+			amount -= share
+			parts = append(parts, &models.Refund{Amount: share, Reason: "Rental cancelled", RequestedBy: requestedBy})
+		}
+		if deposit != nil && deposit.Release > 0 && deposit.PaymentID == payment.ID {
+			parts = append(parts, &models.Refund{Amount: deposit.Release, Reason: "Security deposit released", RequestedBy: requestedBy, Deposit: true})
+		}
+
+		for _, refund := range parts {
+			err := ctrl.refunds.RefundCancellation(c.Request().Context(), payment, refund)
+			if refund.ID != uuid.Nil {
+				// The refund is recorded, the gateway or its callback settles it
+				refunds = append(refunds, *refund)
+				if err != nil {
+					log.Printf("Failed to refund payment %s of cancelled rental: %v", payment.ID, err)
+				}
+				continue
+			}
+			if !errors.Is(err, services.ErrRefundNotSupported) {
+				log.Printf("Failed to refund payment %s of cancelled rental: %v", payment.ID, err)
+			}
+			payment.PaymentStatus = models.PaymentStatusRefundPending
+			payment.UpdatedAt = time.Now()
+			if err := ctrl.paymentRepo.Update(payment); err != nil {
+				log.Printf("Failed to mark payment %s for a manual refund: %v", payment.ID, err)
+			}
+			if deposit != nil && deposit.Release > 0 && deposit.PaymentID == payment.ID {
+				if _, err := ctrl.depositRepo.Release(deposit.RentalID, deposit.Release, "Rental cancelled", requestedBy); err != nil {
+					log.Printf("Failed to release deposit of cancelled rental %s: %v", deposit.RentalID, err)
+				}
+			}
+			break
+		}
+	}
+	return refunds
+}
+
+// ExtendRental godoc
+// @Summary Extend a rental
+// @Description Request a later end date for a PAID or PICKED_UP rental before it ends. The extra days are charged at the prices the rental was booked at, less its percentage promotion. The extension takes effect once its payment succeeds, or right away when it costs nothing.
+// @Tags rentals
+// @Accept json
+// @Produce json
+// @Param id path string true "Rental ID"
+// @Param request body ExtendRentalRequest true "New end date"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} models.ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /rentals/{id}/extend [post]
+func (ctrl *RentalController) ExtendRental(c echo.Context) error {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID format"})
+	}
+
+	var req ExtendRentalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request format"})
+	}
+
+	rental, err := ctrl.repo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
+	}
+	if !ctrl.canAccessRental(c, rental) {
+		return c.JSON(http.StatusForbidden, map[string]string{"message": "Not authorized to extend this rental"})
+	}
+	if rental.Status != models.RentalStatusPaid && rental.Status != models.RentalStatusPickedUp {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Only paid or picked up rentals can be extended"})
+	}
+	// Past the end date the rental is already holding its units as overdue
+	if !rental.EndDate.After(time.Now()) {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Rentals can only be extended before their end date"})
+	}
+	if !req.EndDate.After(rental.EndDate) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "New end date must be after the current end date"})
+	}
+	if _, err := ctrl.repo.FindPendingExtension(rental.ID); err == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "This rental already has an extension waiting for payment"})
+	}
+
+	equipmentMap := make(map[uuid.UUID]*models.Equipment)
+	for _, item := range rental.Items {
+		equipment, err := ctrl.equipmentRepo.FindEquipmentByID(item.EquipmentID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"message": "Equipment not found"})
+		}
+		equipmentMap[item.EquipmentID] = equipment
+	}
+
+	// Charge the extra days at the prices the rental was booked at
+	extraCost, extraTax, err := ctrl.extensionCost(rental, equipmentMap, req.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to calculate rental price"})
+	}
+
+	// Check that nobody else booked the extra days
+	conflicts, err := ctrl.availability.CheckItems(rental.Items, equipmentMap, rental.EndDate, req.EndDate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check availability"})
+	}
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"message":   availabilityConflictMessage(conflicts),
+			"conflicts": conflicts,
+		})
+	}
+
+	extension := &models.RentalExtension{
+		RentalID:      rental.ID,
+		OldEndDate:    rental.EndDate,
+		NewEndDate:    req.EndDate,
+		ExtraCost:     extraCost,
+		ExtraSubtotal: extraCost - extraTax,
+		ExtraTax:      extraTax,
+	}
+	var payment *models.Payment
+	if extraCost > 0 {
+		payment = &models.Payment{
+			ID:               uuid.New(),
+			RentalID:         rental.ID,
+			UserID:           rental.UserID,
+			Amount:           rental.SettlementAmount(extraCost),
+			TaxAmount:        rental.SettlementAmount(extraTax),
+			Currency:         models.DefaultCurrency,
+			OriginalAmount:   extraCost,
+			OriginalCurrency: rental.Currency.OrDefault(),
+			PaymentStatus:    models.PaymentStatusPending,
+		}
+		payment.Subtotal = payment.Amount - payment.TaxAmount
+	}
+	if err := ctrl.repo.CreateExtension(extension, payment); err != nil {
+		if message, ok := bookingConflictMessage(err); ok {
+			return c.JSON(http.StatusConflict, map[string]string{"message": message})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to create extension"})
+	}
+
+	// With nothing to pay the extension takes effect right away
+	if payment == nil {
+		if err := ctrl.repo.ApplyExtension(extension); err != nil {
+			if errors.Is(err, repositories.ErrRentalStatusChanged) {
+				return c.JSON(http.StatusConflict, map[string]string{"message": "Rental was changed by another request"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to apply extension"})
+		}
+		rental.EndDate = extension.NewEndDate
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"extension": extension,
+			"rental":    rental,
+		})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"extension": extension,
+		"payment":   payment,
+	})
+}
+
+func (ctrl *RentalController) transitionRental(c echo.Context, to string) error {
+	rentalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid rental ID format"})
+	}
+	rental, err := ctrl.repo.FindByID(rentalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": "Rental not found"})
+	}
+
+	if err := ctrl.lifecycle.Transition(rental, to, nil); err != nil {
+		return transitionErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, rental)
+}
+
+// canAccessRental reports whether the caller owns the rental or is an admin
+func (ctrl *RentalController) canAccessRental(c echo.Context, rental *models.Rental) bool {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return false
+	}
+	return rental.UserID == userID || isAdmin(ctrl.userRepo, userID)
+}
+
+// parseRentalFilter reads the rental listing filters from the query string
+func parseRentalFilter(c echo.Context) (repositories.RentalFilter, error) {
+	filter := repositories.RentalFilter{
+		Status: c.QueryParam("status"),
+		Sort:   c.QueryParam("sort"),
+	}
+	if !repositories.ValidRentalSort(filter.Sort) {
+		return filter, fmt.Errorf("Invalid sort option")
+	}
+
+	var err error
+	if param := c.QueryParam("user_id"); param != "" {
+		if filter.UserID, err = uuid.Parse(param); err != nil {
+			return filter, fmt.Errorf("Invalid user ID format")
+		}
+	}
+	if param := c.QueryParam("equipment_id"); param != "" {
+		if filter.EquipmentID, err = uuid.Parse(param); err != nil {
+			return filter, fmt.Errorf("Invalid equipment ID format")
+		}
+	}
+	if param := c.QueryParam("from"); param != "" {
+		if filter.From, err = time.Parse(time.RFC3339, param); err != nil {
+			return filter, fmt.Errorf("Invalid from date, expected RFC 3339")
+		}
+	}
+	if param := c.QueryParam("to"); param != "" {
+		if filter.To, err = time.Parse(time.RFC3339, param); err != nil {
+			return filter, fmt.Errorf("Invalid to date, expected RFC 3339")
+		}
+	}
+	return filter, nil
+}
+
+func transitionErrorResponse(c echo.Context, err error) error {
+	var transitionErr *services.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		return c.JSON(http.StatusConflict, map[string]string{"message": transitionErr.Error()})
+	case errors.Is(err, repositories.ErrRentalStatusChanged):
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Rental was updated by another request, please retry"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update rental status"})
+	}
+}
+
+// fillMissingEquipmentNames looks up the names of items booked before names
+// were stored with the rental. Items of deleted equipment keep an empty name.
+func (ctrl *RentalController) fillMissingEquipmentNames(rental *models.Rental) {
+	for i := range rental.Items {
+		if rental.Items[i].EquipmentName != "" {
+			continue
+		}
+		if equipment, err := ctrl.equipmentRepo.FindEquipmentByID(rental.Items[i].EquipmentID); err == nil {
+			rental.Items[i].EquipmentName = equipment.Name
+		}
+	}
+}
+
+// loadRentalEquipment validates the period and items of a rental request and
+// loads the equipment of every item, filling in the equipment names.
+func loadRentalEquipment(equipmentRepo repositories.EquipmentRepository, rental *models.Rental) (map[uuid.UUID]*models.Equipment, *echo.HTTPError) {
+	if !rental.EndDate.After(rental.StartDate) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "End date must be after start date")
+	}
+	if len(rental.Items) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Rental must contain at least one item")
+	}
+
+	equipmentMap := make(map[uuid.UUID]*models.Equipment)
+	for i := range rental.Items {
+		if rental.Items[i].Quantity < 1 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Item quantity must be at least 1")
+		}
+
+		equipment, err := equipmentRepo.FindEquipmentByID(rental.Items[i].EquipmentID)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Equipment not found")
+		}
+		equipmentMap[rental.Items[i].EquipmentID] = equipment
+		rental.Items[i].EquipmentName = equipment.Name
+	}
+	return equipmentMap, nil
+}
+
+// applyPromoCode takes the discount of the rental's promo code off the price
+// breakdown and stores the code and discount on the rental
+func applyPromoCode(promotions *services.PromotionService, rental *models.Rental, breakdown *models.PriceBreakdown, equipment map[uuid.UUID]*models.Equipment) *echo.HTTPError {
+	rental.DiscountAmount = 0
+	if strings.TrimSpace(rental.PromoCode) == "" {
+		rental.PromoCode = ""
+		return nil
+	}
+
+	if err := promotions.Apply(rental.PromoCode, rental.UserID, breakdown, equipment); err != nil {
+		var promotionErr *services.PromotionError
+		if errors.As(err, &promotionErr) {
+			return echo.NewHTTPError(http.StatusBadRequest, promotionErr.Message)
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to apply promo code")
+	}
+	rental.PromoCode = breakdown.PromoCode
+	rental.DiscountAmount = breakdown.Discount
+	return nil
+}
+
+// bookingConflictMessage explains a promotion usage limit that was reached
+// or stock that was taken while the rental was being stored
+func bookingConflictMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, repositories.ErrInsufficientStock):
+		return "Some items were booked by someone else in the meantime, check availability again", true
+	case errors.Is(err, repositories.ErrPromotionUsedUp):
+		return "Promo code has been used up", true
+	case errors.Is(err, repositories.ErrPromotionUserLimit):
+		return "You have already used this promo code", true
+	}
+	return "", false
+}
+
+// extensionCost prices the extra days of moving the end of the rental to
+// newEnd at the prices it was booked at, less its promotion, returning the
+// extra cost and the tax it contains
+func (ctrl *RentalController) extensionCost(rental *models.Rental, equipment map[uuid.UUID]*models.Equipment, newEnd time.Time) (models.Money, models.Money, error) {
+	breakdown, err := ctrl.pricing.PriceExtension(rental, equipment, newEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := ctrl.promotions.ApplyToExtension(rental, breakdown, equipment); err != nil {
+		return 0, 0, err
+	}
+	ctrl.tax.Apply(breakdown)
+	return breakdown.Total, breakdown.Tax, nil
+}
+
+// priceRentalError answers a price that could not be calculated. A currency
+// without an exchange rate is the caller's mistake.
+func priceRentalError(err error) *echo.HTTPError {
+	if errors.Is(err, services.ErrNoExchangeRate) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Currency is not supported")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to calculate rental price")
+}
+
+func availabilityConflictMessage(conflicts []services.ItemAvailability) string {
+	if len(conflicts) == 1 {
+		return fmt.Sprintf("Only %d unit(s) of %s available for the selected dates, %d requested",
+			conflicts[0].Available, conflicts[0].EquipmentName, conflicts[0].Requested)
+	}
+	return "Some items are not available in the requested quantity for the selected dates"
+}
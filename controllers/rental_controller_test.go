@@ -3,8 +3,11 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"invitified-go/gateways"
 	"invitified-go/models"
 	"invitified-go/repositories"
+	"invitified-go/services"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -20,12 +23,21 @@ func TestRentalController(t *testing.T) {
 	e := echo.New()
 	mockRentalRepo := new(repositories.MockRentalRepository)
 	mockEquipmentRepo := new(repositories.MockEquipmentRepository)
-	ctrl := NewRentalController(mockRentalRepo, mockEquipmentRepo)
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	mockPromotionRepo := new(repositories.MockPromotionRepository)
+	mockExchangeRateRepo := new(repositories.MockExchangeRateRepository)
+	mockDepositRepo := new(repositories.MockDepositRepository)
+	mockRefundRepo := new(repositories.MockRefundRepository)
+	gateway := gateways.NewFakeGateway()
+	gateway.RefundStatus = gateways.RefundStatusPending
+	ctrl := NewRentalController(mockRentalRepo, mockEquipmentRepo, mockPaymentRepo, mockUserRepo, mockPromotionRepo, mockExchangeRateRepo, mockDepositRepo, new(repositories.MockLateFeeRepository), mockRefundRepo, gateway)
 
 	t.Run("CreateRental", func(t *testing.T) {
 		tests := []struct {
 			name       string
 			payload    models.Rental
+			tax        services.TaxPolicy
 			setupAuth  func(c echo.Context)
 			setupMocks func()
 			wantCode   int
@@ -49,16 +61,184 @@ func TestRentalController(t *testing.T) {
 				},
 				setupMocks: func() {
 					equipment := &models.Equipment{
-						ID:          uuid.New(),
-						Name:        "Test Equipment",
-						RentalPrice: 100.0,
+						ID:            uuid.New(),
+						Name:          "Test Equipment",
+						RentalPrice:   models.NewMoney(100.0),
+						StockQuantity: 5,
+						IsAvailable:   true,
 					}
 					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(1, nil)
 					mockRentalRepo.On("Create", mock.AnythingOfType("*models.Rental")).Return(nil)
 				},
 				wantCode: http.StatusCreated,
 				wantErr:  false,
 			},
+			{
+				name: "insufficient stock",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(48 * time.Hour),
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    3,
+						},
+					},
+				},
+				setupAuth: func(c echo.Context) {
+					userID := uuid.New()
+					c.Set("userID", userID.String())
+				},
+				setupMocks: func() {
+					equipment := &models.Equipment{
+						ID:            uuid.New(),
+						Name:          "Test Equipment",
+						RentalPrice:   models.NewMoney(100.0),
+						StockQuantity: 4,
+						IsAvailable:   true,
+					}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(2, nil)
+				},
+				wantCode: http.StatusConflict,
+				wantErr:  false,
+			},
+			{
+				name: "promo code applied",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					PromoCode: "wedding10",
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    2,
+						},
+					},
+				},
+				setupAuth: func(c echo.Context) {
+					c.Set("userID", uuid.New().String())
+				},
+				setupMocks: func() {
+					equipment := &models.Equipment{ID: uuid.New(), Name: "Test Equipment", RentalPrice: models.NewMoney(100.0), StockQuantity: 5, IsAvailable: true}
+					promotion := &models.Promotion{ID: uuid.New(), Code: "WEDDING10", DiscountType: models.DiscountTypeFixed, DiscountValue: 50, IsActive: true}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockPromotionRepo.On("FindByCode", "wedding10").Return(promotion, nil)
+					mockPromotionRepo.On("CountRedemptions", promotion.ID, mock.AnythingOfType("uuid.UUID")).Return(int64(0), int64(0), nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(0, nil)
+					mockRentalRepo.On("Create", mock.MatchedBy(func(rental *models.Rental) bool {
+						return rental.PromoCode == "WEDDING10" && rental.DiscountAmount == models.NewMoney(50) &&
+							rental.TotalCost == rental.PriceBreakdown.Subtotal-models.NewMoney(50) && *rental.PriceBreakdown.PromotionID == promotion.ID
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+				wantErr:  false,
+			},
+			{
+				name: "tax added to the total",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    2,
+						},
+					},
+				},
+				tax: services.TaxPolicy{Name: "PPN", Rate: 0.11},
+				setupAuth: func(c echo.Context) {
+					c.Set("userID", uuid.New().String())
+				},
+				setupMocks: func() {
+					equipment := &models.Equipment{ID: uuid.New(), Name: "Test Equipment", RentalPrice: models.NewMoney(100.0), StockQuantity: 5, IsAvailable: true}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(0, nil)
+					mockRentalRepo.On("Create", mock.MatchedBy(func(rental *models.Rental) bool {
+						return rental.Subtotal == models.NewMoney(400) && rental.TaxAmount == models.NewMoney(44) && rental.TotalCost == models.NewMoney(444)
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+				wantErr:  false,
+			},
+			{
+				name: "expired promo code",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					PromoCode: "OLD",
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    1,
+						},
+					},
+				},
+				setupAuth: func(c echo.Context) {
+					c.Set("userID", uuid.New().String())
+				},
+				setupMocks: func() {
+					ended := time.Now().Add(-time.Hour)
+					equipment := &models.Equipment{ID: uuid.New(), Name: "Test Equipment", RentalPrice: models.NewMoney(100.0), StockQuantity: 5, IsAvailable: true}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockPromotionRepo.On("FindByCode", "OLD").Return(&models.Promotion{ID: uuid.New(), Code: "OLD", DiscountType: models.DiscountTypeFixed, DiscountValue: 50, IsActive: true, EndsAt: &ended}, nil)
+				},
+				wantCode: http.StatusBadRequest,
+				wantErr:  false,
+			},
+			{
+				name: "promo code used up while booking",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					PromoCode: "LAST",
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    1,
+						},
+					},
+				},
+				setupAuth: func(c echo.Context) {
+					c.Set("userID", uuid.New().String())
+				},
+				setupMocks: func() {
+					equipment := &models.Equipment{ID: uuid.New(), Name: "Test Equipment", RentalPrice: models.NewMoney(100.0), StockQuantity: 5, IsAvailable: true}
+					promotion := &models.Promotion{ID: uuid.New(), Code: "LAST", DiscountType: models.DiscountTypePercentage, DiscountValue: 10, UsageLimit: 1, IsActive: true}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockPromotionRepo.On("FindByCode", "LAST").Return(promotion, nil)
+					mockPromotionRepo.On("CountRedemptions", promotion.ID, mock.AnythingOfType("uuid.UUID")).Return(int64(0), int64(0), nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(0, nil)
+					mockRentalRepo.On("Create", mock.AnythingOfType("*models.Rental")).Return(repositories.ErrPromotionUsedUp)
+				},
+				wantCode: http.StatusConflict,
+				wantErr:  false,
+			},
+			{
+				name: "stock taken by a concurrent booking",
+				payload: models.Rental{
+					StartDate: time.Now(),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					Items: []models.RentalItem{
+						{
+							EquipmentID: uuid.New(),
+							Quantity:    1,
+						},
+					},
+				},
+				setupAuth: func(c echo.Context) {
+					c.Set("userID", uuid.New().String())
+				},
+				setupMocks: func() {
+					equipment := &models.Equipment{ID: uuid.New(), Name: "Test Equipment", RentalPrice: models.NewMoney(100.0), StockQuantity: 1, IsAvailable: true}
+					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(0, nil)
+					mockRentalRepo.On("Create", mock.AnythingOfType("*models.Rental")).Return(repositories.ErrInsufficientStock)
+				},
+				wantCode: http.StatusConflict,
+				wantErr:  false,
+			},
 			{
 				name: "invalid date range",
 				payload: models.Rental{
@@ -77,7 +257,7 @@ func TestRentalController(t *testing.T) {
 				},
 				setupMocks: func() {},
 				wantCode:   http.StatusBadRequest,
-				wantErr:    true,
+				wantErr:    false,
 			},
 		}
 
@@ -85,6 +265,8 @@ func TestRentalController(t *testing.T) {
 			t.Run(tt.name, func(t *testing.T) {
 				mockRentalRepo.ExpectedCalls = nil
 				mockEquipmentRepo.ExpectedCalls = nil
+				mockPromotionRepo.ExpectedCalls = nil
+				ctrl.tax = tt.tax
 
 				tt.setupMocks()
 
@@ -108,6 +290,7 @@ func TestRentalController(t *testing.T) {
 
 				mockRentalRepo.AssertExpectations(t)
 				mockEquipmentRepo.AssertExpectations(t)
+				mockPromotionRepo.AssertExpectations(t)
 			})
 		}
 	})
@@ -115,6 +298,7 @@ func TestRentalController(t *testing.T) {
 	t.Run("GetRentalByID", func(t *testing.T) {
 		rental := &models.Rental{
 			ID:        uuid.New(),
+			UserID:    uuid.New(),
 			StartDate: time.Now(),
 			EndDate:   time.Now().Add(24 * time.Hour),
 			Items: []models.RentalItem{
@@ -124,16 +308,33 @@ func TestRentalController(t *testing.T) {
 				},
 			},
 		}
+		snapshotRental := &models.Rental{
+			ID:     uuid.New(),
+			UserID: uuid.New(),
+			Items: []models.RentalItem{
+				{
+					EquipmentID:   uuid.New(),
+					Quantity:      1,
+					EquipmentName: "Retired Projector",
+					UnitPrice:     models.NewMoney(100),
+					Days:          1,
+					LineTotal:     models.NewMoney(100),
+				},
+			},
+		}
+		otherUser := &models.User{ID: uuid.New(), RoleID: uuid.New()}
 
 		tests := []struct {
 			name       string
 			rentalID   string
+			userID     uuid.UUID
 			setupMocks func()
 			wantCode   int
 		}{
 			{
 				name:     "successful rental retrieval",
 				rentalID: rental.ID.String(),
+				userID:   rental.UserID,
 				setupMocks: func() {
 					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
 					mockEquipmentRepo.On("FindEquipmentByID", mock.AnythingOfType("uuid.UUID")).Return(&models.Equipment{
@@ -143,12 +344,33 @@ func TestRentalController(t *testing.T) {
 				},
 				wantCode: http.StatusOK,
 			},
+			{
+				name:     "snapshot survives deleted equipment",
+				rentalID: snapshotRental.ID.String(),
+				userID:   snapshotRental.UserID,
+				setupMocks: func() {
+					mockRentalRepo.On("FindByID", snapshotRental.ID).Return(snapshotRental, nil)
+				},
+				wantCode: http.StatusOK,
+			},
+			{
+				name:     "rental of another user",
+				rentalID: rental.ID.String(),
+				userID:   otherUser.ID,
+				setupMocks: func() {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockUserRepo.On("FindByID", otherUser.ID).Return(otherUser, nil)
+					mockUserRepo.On("FindRoleByID", otherUser.RoleID).Return(&models.Role{Name: "USER"}, nil)
+				},
+				wantCode: http.StatusForbidden,
+			},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				mockRentalRepo.ExpectedCalls = nil
 				mockEquipmentRepo.ExpectedCalls = nil
+				mockUserRepo.ExpectedCalls = nil
 
 				tt.setupMocks()
 
@@ -157,6 +379,7 @@ func TestRentalController(t *testing.T) {
 				c := e.NewContext(req, rec)
 				c.SetParamNames("id")
 				c.SetParamValues(tt.rentalID)
+				c.Set("userID", tt.userID.String())
 
 				err := ctrl.GetRentalByID(c)
 				assert.NoError(t, err)
@@ -167,4 +390,489 @@ func TestRentalController(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("GetAllRentals", func(t *testing.T) {
+		user := &models.User{ID: uuid.New(), RoleID: uuid.New()}
+		admin := &models.User{ID: uuid.New(), RoleID: uuid.New()}
+		filterUserID := uuid.New()
+
+		tests := []struct {
+			name       string
+			user       *models.User
+			role       string
+			query      string
+			wantFilter repositories.RentalFilter
+			wantCode   int
+		}{
+			{
+				name:       "users only see their own rentals",
+				user:       user,
+				role:       "USER",
+				query:      "?user_id=" + filterUserID.String() + "&status=PAID",
+				wantFilter: repositories.RentalFilter{UserID: user.ID, Status: "PAID"},
+				wantCode:   http.StatusOK,
+			},
+			{
+				name:       "admins may filter by user",
+				user:       admin,
+				role:       "ADMIN",
+				query:      "?user_id=" + filterUserID.String() + "&sort=-start_date",
+				wantFilter: repositories.RentalFilter{UserID: filterUserID, Sort: "-start_date"},
+				wantCode:   http.StatusOK,
+			},
+			{
+				name:     "unknown sort column",
+				user:     admin,
+				role:     "ADMIN",
+				query:    "?sort=password",
+				wantCode: http.StatusBadRequest,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockRentalRepo.ExpectedCalls = nil
+				mockUserRepo.ExpectedCalls = nil
+
+				mockUserRepo.On("FindByID", tt.user.ID).Return(tt.user, nil)
+				mockUserRepo.On("FindRoleByID", tt.user.RoleID).Return(&models.Role{Name: tt.role}, nil)
+				if tt.wantCode == http.StatusOK {
+					mockRentalRepo.On("FindWithFilter", tt.wantFilter, 10, 0).Return([]models.Rental{}, int64(0), nil)
+				}
+
+				req := httptest.NewRequest(http.MethodGet, "/rentals"+tt.query, nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.Set("userID", tt.user.ID.String())
+
+				assert.NoError(t, ctrl.GetAllRentals(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+
+				mockRentalRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("PickupRental", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			rental     *models.Rental
+			setupMocks func(rental *models.Rental)
+			wantCode   int
+			wantStatus string
+		}{
+			{
+				name: "paid rental is picked up",
+				rental: &models.Rental{
+					ID:        uuid.New(),
+					StartDate: time.Now().Add(-time.Hour),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					Status:    models.RentalStatusPaid,
+				},
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPaid, mock.MatchedBy(func(updates map[string]interface{}) bool {
+						return updates["status"] == models.RentalStatusPickedUp
+					})).Return(nil)
+				},
+				wantCode:   http.StatusOK,
+				wantStatus: models.RentalStatusPickedUp,
+			},
+			{
+				name: "unpaid rental cannot be picked up",
+				rental: &models.Rental{
+					ID:        uuid.New(),
+					StartDate: time.Now().Add(-time.Hour),
+					EndDate:   time.Now().Add(24 * time.Hour),
+					Status:    models.RentalStatusPending,
+				},
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+				},
+				wantCode:   http.StatusConflict,
+				wantStatus: models.RentalStatusPending,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockRentalRepo.ExpectedCalls = nil
+				mockEquipmentRepo.ExpectedCalls = nil
+
+				tt.setupMocks(tt.rental)
+
+				req := httptest.NewRequest(http.MethodPost, "/rentals/"+tt.rental.ID.String()+"/pickup", nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues(tt.rental.ID.String())
+
+				assert.NoError(t, ctrl.PickupRental(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+				assert.Equal(t, tt.wantStatus, tt.rental.Status)
+
+				mockRentalRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("UpdateRental", func(t *testing.T) {
+		endDate := time.Now().Add(24 * time.Hour)
+		ownerID := uuid.New()
+		otherUser := &models.User{ID: uuid.New(), RoleID: uuid.New()}
+		tests := []struct {
+			name       string
+			status     string
+			userID     uuid.UUID
+			body       string
+			setupMocks func(rental *models.Rental)
+			wantCode   int
+			wantReason string
+		}{
+			{
+				name:   "cancel reason is corrected and priced fields are ignored",
+				status: models.RentalStatusCancelled,
+				userID: ownerID,
+				body:   `{"cancel_reason":"Venue closed","end_date":"2030-01-01T00:00:00Z","total_cost":1,"status":"PAID"}`,
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockRentalRepo.On("Update", mock.MatchedBy(func(r *models.Rental) bool {
+						return r.EndDate.Equal(endDate) && r.TotalCost == models.NewMoney(300) && r.Status == models.RentalStatusCancelled
+					})).Return(nil)
+				},
+				wantCode:   http.StatusOK,
+				wantReason: "Venue closed",
+			},
+			{
+				name:   "cancel reason of an active rental",
+				status: models.RentalStatusPaid,
+				userID: ownerID,
+				body:   `{"cancel_reason":"Venue closed"}`,
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+				},
+				wantCode: http.StatusBadRequest,
+			},
+			{
+				name:   "another user's rental",
+				status: models.RentalStatusCancelled,
+				userID: otherUser.ID,
+				body:   `{"cancel_reason":"Venue closed"}`,
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockUserRepo.On("FindByID", otherUser.ID).Return(otherUser, nil)
+					mockUserRepo.On("FindRoleByID", otherUser.RoleID).Return(&models.Role{Name: "USER"}, nil)
+				},
+				wantCode: http.StatusForbidden,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockRentalRepo.ExpectedCalls = nil
+				rental := &models.Rental{
+					ID:        uuid.New(),
+					UserID:    ownerID,
+					StartDate: time.Now(),
+					EndDate:   endDate,
+					TotalCost: models.NewMoney(300),
+					Status:    tt.status,
+				}
+				tt.setupMocks(rental)
+
+				req := httptest.NewRequest(http.MethodPut, "/rentals/"+rental.ID.String(), bytes.NewBufferString(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues(rental.ID.String())
+				c.Set("userID", tt.userID.String())
+
+				assert.NoError(t, ctrl.UpdateRental(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+				assert.Equal(t, tt.wantReason, rental.CancelReason)
+
+				mockRentalRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("CancelRental", func(t *testing.T) {
+		userID := uuid.New()
+		createRefund := func(amount float64, deposit bool) {
+			mockRefundRepo.On("Create", mock.MatchedBy(func(refund *models.Refund) bool {
+				return refund.Amount == models.NewMoney(amount) && refund.Deposit == deposit && refund.RequestedBy == userID
+			})).Run(func(args mock.Arguments) {
+				args.Get(0).(*models.Refund).ID = uuid.New()
+			}).Return(nil).Once()
+		}
+
+		tests := []struct {
+			name        string
+			rental      *models.Rental
+			payload     string
+			setupMocks  func(rental *models.Rental)
+			wantCode    int
+			wantRefund  float64
+			wantRefunds []float64
+		}{
+			{
+				name: "full refund more than a week ahead",
+				rental: &models.Rental{
+					ID:        uuid.New(),
+					UserID:    userID,
+					StartDate: time.Now().Add(10 * 24 * time.Hour),
+					EndDate:   time.Now().Add(12 * 24 * time.Hour),
+					Status:    models.RentalStatusPaid,
+				},
+				payload: `{"reason":"Event postponed"}`,
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{
+						{ID: uuid.New(), RentalID: rental.ID, Amount: models.NewMoney(200000), PaymentMethod: models.PaymentMethodEWallet, PaymentStatus: models.PaymentStatusCompleted},
+					}, nil)
+					mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPaid, mock.MatchedBy(func(updates map[string]interface{}) bool {
+						return updates["status"] == models.RentalStatusCancelled && updates["refund_amount"] == models.NewMoney(200000) &&
+							updates["refund_currency"] == models.DefaultCurrency
+					})).Return(nil)
+					mockPaymentRepo.On("ExpirePendingByRentalID", rental.ID, mock.AnythingOfType("time.Time")).Return(nil)
+					createRefund(200000, false)
+					mockRefundRepo.On("SetXenditRefundID", mock.AnythingOfType("*models.Refund")).Return(nil)
+				},
+				wantCode:    http.StatusOK,
+				wantRefund:  200000,
+				wantRefunds: []float64{200000},
+			},
+			{
+				name: "full refund split across the payments with the deposit",
+				rental: &models.Rental{
+					ID:        uuid.New(),
+					UserID:    userID,
+					StartDate: time.Now().Add(10 * 24 * time.Hour),
+					EndDate:   time.Now().Add(12 * 24 * time.Hour),
+					Status:    models.RentalStatusPaid,
+				},
+				payload: `{"reason":"Changed plans"}`,
+				setupMocks: func(rental *models.Rental) {
+					rentalPayment := models.Payment{ID: uuid.New(), RentalID: rental.ID, Amount: models.NewMoney(150000), DepositAmount: models.NewMoney(50000),
+						PaymentMethod: models.PaymentMethodEWallet, PaymentStatus: models.PaymentStatusCompleted}
+					extensionPayment := models.Payment{ID: uuid.New(), RentalID: rental.ID, Amount: models.NewMoney(100000),
+						PaymentMethod: models.PaymentMethodQRCode, PaymentStatus: models.PaymentStatusCompleted}
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{rentalPayment, extensionPayment}, nil)
+					mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPaid, mock.MatchedBy(func(updates map[string]interface{}) bool {
+						return updates["refund_amount"] == models.NewMoney(250000)
+					})).Return(nil)
+					mockPaymentRepo.On("ExpirePendingByRentalID", rental.ID, mock.AnythingOfType("time.Time")).Return(nil)
+					mockDepositRepo.On("Settle", rental.ID, models.Money(0), "Rental cancelled", userID).Return(&repositories.DepositSettlement{
+						RentalID: rental.ID, PaymentID: rentalPayment.ID, Release: models.NewMoney(50000),
+					}, nil)
+					createRefund(100000, false)
+					createRefund(50000, true)
+					createRefund(100000, false)
+					mockRefundRepo.On("SetXenditRefundID", mock.AnythingOfType("*models.Refund")).Return(nil)
+				},
+				wantCode:    http.StatusOK,
+				wantRefund:  250000,
+				wantRefunds: []float64{100000, 50000, 100000},
+			},
+			{
+				name: "virtual account payment left for a manual refund",
+				rental: &models.Rental{
+					ID:        uuid.New(),
+					UserID:    userID,
+					StartDate: time.Now().Add(24 * time.Hour),
+					EndDate:   time.Now().Add(48 * time.Hour),
+					Status:    models.RentalStatusPaid,
+				},
+				payload: `{"reason":"Changed plans"}`,
+				setupMocks: func(rental *models.Rental) {
+					payment := models.Payment{ID: uuid.New(), RentalID: rental.ID, Amount: models.NewMoney(200000), DepositAmount: models.NewMoney(50000),
+						PaymentMethod: models.PaymentMethodVirtualAccount, PaymentStatus: models.PaymentStatusCompleted}
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockPaymentRepo.On("FindByRentalID", rental.ID).Return([]models.Payment{payment}, nil)
+					mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPaid, mock.Anything).Return(nil)
+					mockPaymentRepo.On("ExpirePendingByRentalID", rental.ID, mock.AnythingOfType("time.Time")).Return(nil)
+					mockDepositRepo.On("Settle", rental.ID, models.Money(0), "Rental cancelled", userID).Return(&repositories.DepositSettlement{
+						RentalID: rental.ID, PaymentID: payment.ID, Release: models.NewMoney(50000),
+					}, nil)
+					mockPaymentRepo.On("Update", mock.MatchedBy(func(payment *models.Payment) bool {
+						return payment.PaymentStatus == models.PaymentStatusRefundPending
+					})).Return(nil)
+					// Returned by hand together with the payment
+					mockDepositRepo.On("Release", rental.ID, models.NewMoney(50000), "Rental cancelled", userID).Return(&models.DepositEntry{}, nil)
+				},
+				wantCode:    http.StatusOK,
+				wantRefund:  125000,
+				wantRefunds: []float64{},
+			},
+			{
+				name: "missing reason",
+				rental: &models.Rental{
+					ID:     uuid.New(),
+					UserID: userID,
+					Status: models.RentalStatusPaid,
+				},
+				payload:    `{}`,
+				setupMocks: func(rental *models.Rental) {},
+				wantCode:   http.StatusBadRequest,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockRentalRepo.ExpectedCalls = nil
+				mockPaymentRepo.ExpectedCalls = nil
+				mockDepositRepo.ExpectedCalls = nil
+				mockRefundRepo.ExpectedCalls = nil
+				gateway.RefundRequests = nil
+
+				tt.setupMocks(tt.rental)
+
+				req := httptest.NewRequest(http.MethodPost, "/rentals/"+tt.rental.ID.String()+"/cancel", bytes.NewBufferString(tt.payload))
+				req.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues(tt.rental.ID.String())
+				c.Set("userID", userID.String())
+
+				assert.NoError(t, ctrl.CancelRental(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+
+				if tt.wantCode == http.StatusOK {
+					var response struct {
+						RefundAmount float64         `json:"refund_amount"`
+						Refunds      []models.Refund `json:"refunds"`
+					}
+					json.Unmarshal(rec.Body.Bytes(), &response)
+					assert.Equal(t, tt.wantRefund, response.RefundAmount)
+					refunded := []float64{}
+					for _, refund := range response.Refunds {
+						refunded = append(refunded, refund.Amount.Float64())
+					}
+					assert.Equal(t, tt.wantRefunds, refunded)
+					for _, request := range gateway.RefundRequests {
+						assert.Equal(t, gateways.RefundReasonCancellation, request.Reason)
+					}
+				}
+
+				mockRentalRepo.AssertExpectations(t)
+				mockPaymentRepo.AssertExpectations(t)
+				mockDepositRepo.AssertExpectations(t)
+				mockRefundRepo.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("ExtendRental", func(t *testing.T) {
+		userID := uuid.New()
+		equipment := &models.Equipment{
+			ID:            uuid.New(),
+			Name:          "Test Equipment",
+			RentalPrice:   models.NewMoney(100.0),
+			StockQuantity: 2,
+			IsAvailable:   true,
+		}
+		endDate := time.Date(2030, 1, 3, 10, 0, 0, 0, time.UTC)
+		newEndDate := endDate.Add(48 * time.Hour)
+		pastEndDate := time.Date(2020, 1, 3, 10, 0, 0, 0, time.UTC)
+
+		tests := []struct {
+			name        string
+			setupMocks  func(rental *models.Rental)
+			wantCode    int
+			wantEndDate time.Time
+		}{
+			{
+				name: "extension priced for the extra days",
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockRentalRepo.On("FindPendingExtension", rental.ID).Return(nil, errors.New("record not found"))
+					mockEquipmentRepo.On("FindEquipmentByID", equipment.ID).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, endDate, newEndDate).Return(0, nil)
+					mockRentalRepo.On("CreateExtension", mock.MatchedBy(func(extension *models.RentalExtension) bool {
+						return extension.ExtraCost == models.NewMoney(400) && extension.NewEndDate.Equal(newEndDate)
+					}), mock.MatchedBy(func(payment *models.Payment) bool {
+						return payment.Amount == models.NewMoney(400) && payment.PaymentStatus == models.PaymentStatusPending
+					})).Return(nil)
+				},
+				wantCode: http.StatusCreated,
+			},
+			{
+				name: "extra days already booked",
+				setupMocks: func(rental *models.Rental) {
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockRentalRepo.On("FindPendingExtension", rental.ID).Return(nil, errors.New("record not found"))
+					mockEquipmentRepo.On("FindEquipmentByID", equipment.ID).Return(equipment, nil)
+					mockRentalRepo.On("SumBookedQuantity", equipment.ID, endDate, newEndDate).Return(1, nil)
+				},
+				wantCode: http.StatusConflict,
+			},
+			{
+				name: "free extension applied without a payment",
+				setupMocks: func(rental *models.Rental) {
+					free := &models.Equipment{ID: uuid.New(), Name: "Free Equipment", StockQuantity: 1, IsAvailable: true}
+					rental.Items = []models.RentalItem{{EquipmentID: free.ID, Quantity: 1}}
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+					mockRentalRepo.On("FindPendingExtension", rental.ID).Return(nil, errors.New("record not found"))
+					mockEquipmentRepo.On("FindEquipmentByID", free.ID).Return(free, nil)
+					mockRentalRepo.On("SumBookedQuantity", free.ID, endDate, newEndDate).Return(0, nil)
+					mockRentalRepo.On("CreateExtension", mock.MatchedBy(func(extension *models.RentalExtension) bool {
+						return extension.ExtraCost == 0 && extension.NewEndDate.Equal(newEndDate)
+					}), (*models.Payment)(nil)).Return(nil)
+					mockRentalRepo.On("ApplyExtension", mock.AnythingOfType("*models.RentalExtension")).Return(nil)
+				},
+				wantCode:    http.StatusCreated,
+				wantEndDate: newEndDate,
+			},
+			{
+				name: "rental past its end date",
+				setupMocks: func(rental *models.Rental) {
+					rental.Status = models.RentalStatusPickedUp
+					rental.EndDate = pastEndDate
+					mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+				},
+				wantCode:    http.StatusConflict,
+				wantEndDate: pastEndDate,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockRentalRepo.ExpectedCalls = nil
+				mockEquipmentRepo.ExpectedCalls = nil
+
+				rental := &models.Rental{
+					ID:        uuid.New(),
+					UserID:    userID,
+					StartDate: endDate.Add(-48 * time.Hour),
+					EndDate:   endDate,
+					Status:    models.RentalStatusPaid,
+					Items:     []models.RentalItem{{EquipmentID: equipment.ID, Quantity: 2}},
+				}
+				tt.setupMocks(rental)
+
+				payload, _ := json.Marshal(ExtendRentalRequest{EndDate: newEndDate})
+				req := httptest.NewRequest(http.MethodPost, "/rentals/"+rental.ID.String()+"/extend", bytes.NewBuffer(payload))
+				req.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues(rental.ID.String())
+				c.Set("userID", userID.String())
+
+				assert.NoError(t, ctrl.ExtendRental(c))
+				assert.Equal(t, tt.wantCode, rec.Code)
+				if !tt.wantEndDate.IsZero() {
+					assert.Equal(t, tt.wantEndDate, rental.EndDate)
+				} else {
+					assert.Equal(t, endDate, rental.EndDate)
+				}
+
+				mockRentalRepo.AssertExpectations(t)
+				mockEquipmentRepo.AssertExpectations(t)
+			})
+		}
+	})
 }
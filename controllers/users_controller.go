@@ -1,11 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"invitified-go/models"
 	"invitified-go/repositories"
-	"invitified-go/utils"
+	"invitified-go/services"
+	"log"
 	"net/http"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -14,13 +15,13 @@ import (
 
 // UserController handles user-related requests
 type UserController struct {
-	repo      repositories.UserRepository
-	tokenRepo repositories.TokenRepository
+	repo   repositories.UserRepository
+	tokens *services.TokenService
 }
 
 // NewUserController creates a new UserController
 func NewUserController(repo repositories.UserRepository, tokenRepo repositories.TokenRepository) *UserController {
-	return &UserController{repo, tokenRepo}
+	return &UserController{repo, services.NewTokenService(tokenRepo)}
 }
 
 // LoginRequest represents a login request
@@ -29,6 +30,18 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// RefreshTokenRequest represents a request for a new access token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse is returned when tokens are issued. The access token goes in
+// the Authorization header, the refresh token gets a new one once it expires.
+type TokenResponse struct {
+	Message string `json:"message"`
+	services.TokenPair
+}
+
 // ErrorResponse represents the error response structure
 type ErrorResponse struct {
 	Message string `json:"message"`
@@ -90,12 +103,12 @@ func (ctrl *UserController) RegisterUser(c echo.Context) error {
 
 // LoginUser godoc
 // @Summary Login a user
-// @Description Login a user
+// @Description Login a user and start a session. The access token is short-lived, the refresh token gets new tokens from /users/token/refresh.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param login body LoginRequest true "Login Request"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} TokenResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -115,39 +128,85 @@ func (ctrl *UserController) LoginUser(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid email or password"})
 	}
 
-	token, err := utils.GenerateJWT(user.ID)
+	tokens, err := ctrl.tokens.Login(user.ID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate token"})
 	}
 
-	// Check if a token already exists for the user
-	existingToken, err := ctrl.tokenRepo.FindValidToken(user.ID)
-	if err == nil && existingToken != nil {
-		// Update the existing token
-		existingToken.Token = token
-		existingToken.ExpiresAt = time.Now().Add(time.Hour * 24) // Token valid for 24 hours
-		existingToken.IsValid = true
-		if err := ctrl.tokenRepo.UpdateToken(existingToken); err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update token"})
-		}
-	} else {
-		// Create a new token
-		tokenModel := &models.Tokens{
-			UserID:    user.ID,
-			Token:     token,
-			ExpiresAt: time.Now().Add(time.Hour * 24), // Token valid for 24 hours
-			IsValid:   true,
-			CreatedAt: time.Now(),
-		}
-		if err := ctrl.tokenRepo.SaveToken(tokenModel); err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to save token"})
-		}
+	return c.JSON(http.StatusOK, TokenResponse{Message: "Login successful", TokenPair: *tokens})
+}
+
+// RefreshToken godoc
+// @Summary Refresh the access token
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token can be used once, using it again signs out the session it belongs to.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/token/refresh [post]
+func (ctrl *UserController) RefreshToken(c echo.Context) error {
+	var req RefreshTokenRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Refresh token is required"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Login successful",
-		"token":   token,
-	})
+	tokens, err := ctrl.tokens.Refresh(req.RefreshToken)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, TokenResponse{Message: "Token refreshed", TokenPair: *tokens})
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Refresh token was already used, please log in again"})
+	case errors.Is(err, services.ErrInvalidRefreshToken):
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid or expired refresh token"})
+	default:
+		log.Printf("Failed to refresh token: %v", err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to refresh token"})
+	}
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Sign out the session of the access token. Its access and refresh tokens stop working.
+// @Tags users
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /users/logout [post]
+func (ctrl *UserController) Logout(c echo.Context) error {
+	sessionIDStr, _ := c.Get("sessionID").(string)
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid session"})
+	}
+	if err := ctrl.tokens.Logout(sessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to logout"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Logout everywhere
+// @Description Sign out every session of the user, on all devices
+// @Tags users
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Param Authorization header string true "token" default(<token>)
+// @Router /users/logout-all [post]
+func (ctrl *UserController) LogoutAll(c echo.Context) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid user ID"})
+	}
+	if err := ctrl.tokens.LogoutAll(userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to logout"})
+	}
+	return c.NoContent(http.StatusNoContent)
 }
 
 // GetUserProfile godoc
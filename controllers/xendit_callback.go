@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// XenditVACallback is the body Xendit posts when a virtual account is paid
+type XenditVACallback struct {
+	ID                       string       `json:"id"`
+	PaymentID                string       `json:"payment_id"`
+	CallbackVirtualAccountID string       `json:"callback_virtual_account_id"`
+	ExternalID               string       `json:"external_id"`
+	BankCode                 string       `json:"bank_code"`
+	AccountNumber            string       `json:"account_number"`
+	Amount                   models.Money `json:"amount"`
+	TransactionTimestamp     time.Time    `json:"transaction_timestamp"`
+}
+
+// XenditEventCallback is the body Xendit posts for QR code and e-wallet
+// payments
+type XenditEventCallback struct {
+	Event   string          `json:"event"`
+	Created time.Time       `json:"created"`
+	Data    XenditEventData `json:"data"`
+}
+
+// XenditEventData is the payment inside a QR code or e-wallet callback. QR
+// payments report Amount, e-wallet captures report CaptureAmount.
+type XenditEventData struct {
+	ID            string       `json:"id"`
+	ReferenceID   string       `json:"reference_id"`
+	Status        string       `json:"status"`
+	ChannelCode   string       `json:"channel_code"`
+	Amount        models.Money `json:"amount"`
+	CaptureAmount models.Money `json:"capture_amount"`
+	Created       time.Time    `json:"created"`
+}
+
+const (
+	xenditEventEWalletCapture = "ewallet.capture"
+	xenditEventQRPayment      = "qr.payment"
+	xenditStatusSucceeded     = "SUCCEEDED"
+)
+
+var errUnsupportedXenditEvent = errors.New("unsupported Xendit event")
+
+// xenditNotification is a payment callback of any payment method
+type xenditNotification struct {
+	ExternalID string
+	PaymentID  string
+	Channel    string
+	Amount     models.Money
+	PaidAt     time.Time
+	Succeeded  bool
+}
+
+// parseXenditCallback reads a virtual account, QR code or e-wallet callback.
+// Virtual account callbacks are the only ones without an event name.
+func parseXenditCallback(body []byte) (*xenditNotification, error) {
+	var probe struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, err
+	}
+
+	switch probe.Event {
+	case "":
+		var callback XenditVACallback
+		if err := json.Unmarshal(body, &callback); err != nil {
+			return nil, err
+		}
+		return &xenditNotification{
+			ExternalID: callback.ExternalID,
+			PaymentID:  callback.PaymentID,
+			Channel:    callback.BankCode,
+			Amount:     callback.Amount,
+			PaidAt:     callback.TransactionTimestamp,
+			Succeeded:  true,
+		}, nil
+
+	case xenditEventEWalletCapture, xenditEventQRPayment:
+		var callback XenditEventCallback
+		if err := json.Unmarshal(body, &callback); err != nil {
+			return nil, err
+		}
+		amount := callback.Data.Amount
+		if probe.Event == xenditEventEWalletCapture {
+			amount = callback.Data.CaptureAmount
+		}
+		return &xenditNotification{
+			ExternalID: callback.Data.ReferenceID,
+			PaymentID:  callback.Data.ID,
+			Channel:    strings.TrimPrefix(callback.Data.ChannelCode, "ID_"),
+			Amount:     amount,
+			PaidAt:     callback.Data.Created,
+			Succeeded:  callback.Data.Status == xenditStatusSucceeded,
+		}, nil
+	}
+	return nil, errUnsupportedXenditEvent
+}
+
+// validXenditCallbackToken checks the x-callback-token header against the
+// verification token configured in XENDIT_CALLBACK_TOKEN
+func validXenditCallbackToken(c echo.Context) bool {
+	expected := os.Getenv("XENDIT_CALLBACK_TOKEN")
+	token := c.Request().Header.Get("x-callback-token")
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// XenditCallback godoc
+// @Summary Xendit payment callback
+// @Description Receives virtual account, QR code and e-wallet payment notifications from Xendit. Requests must carry the callback verification token in the x-callback-token header. Repeated deliveries of the same payment are acknowledged without changes.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param callback body XenditVACallback true "Xendit callback"
+// @Param x-callback-token header string true "Xendit callback verification token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /payments/callbacks/xendit [post]
+func (ctrl *PaymentController) XenditCallback(c echo.Context) error {
+	if !validXenditCallbackToken(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"message": "Invalid callback token",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Invalid callback payload",
+		})
+	}
+	notification, err := parseXenditCallback(body)
+	if errors.Is(err, errUnsupportedXenditEvent) {
+		// Acknowledge so Xendit does not keep retrying events we do not use
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Event ignored",
+		})
+	}
+	if err != nil || notification.ExternalID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Invalid callback payload",
+		})
+	}
+
+	payment, err := ctrl.paymentRepo.FindByExternalID(notification.ExternalID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"message": "Payment not found",
+		})
+	}
+
+	if !notification.Succeeded {
+		if payment.PaymentStatus == models.PaymentStatusPending {
+			payment.XenditPaymentID = notification.PaymentID
+			err := ctrl.paymentRepo.MarkFailed(payment)
+			if err != nil && !errors.Is(err, repositories.ErrPaymentNotPending) {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"message": "Failed to record payment",
+				})
+			}
+		}
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Payment failure recorded",
+		})
+	}
+
+	settlement, err := ctrl.settlement.Record(payment, services.PaidDetails{
+		Amount:    notification.Amount,
+		PaymentID: notification.PaymentID,
+		Channel:   notification.Channel,
+		PaidAt:    notification.PaidAt,
+	})
+	if errors.Is(err, services.ErrUnderpaid) {
+		// Acknowledge so Xendit stops retrying, the payment waits for review
+		log.Printf("Xendit callback for payment %s paid %s of %s", payment.ID, notification.Amount, payment.Amount)
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Underpaid payment recorded for review",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to settle payment %s: %v", payment.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"message": "Failed to record payment",
+		})
+	}
+	if settlement.Duplicate {
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Payment already processed",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Payment recorded",
+	})
+}
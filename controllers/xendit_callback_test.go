@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeXendit delivers payment callbacks the way Xendit does
+type fakeXendit struct {
+	t           *testing.T
+	callbackURL string
+	token       string
+}
+
+func (x *fakeXendit) payVirtualAccount(externalID string, amount float64) *http.Response {
+	body, _ := json.Marshal(XenditVACallback{
+		ID:                   uuid.New().String(),
+		PaymentID:            "pay-" + externalID,
+		ExternalID:           externalID,
+		BankCode:             "BCA",
+		Amount:               models.NewMoney(amount),
+		TransactionTimestamp: time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC),
+	})
+	return x.post(body)
+}
+
+func (x *fakeXendit) post(body []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, x.callbackURL, bytes.NewReader(body))
+	assert.NoError(x.t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-callback-token", x.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(x.t, err)
+	return resp
+}
+
+func (x *fakeXendit) captureEWallet(referenceID string, amount float64, status string) *http.Response {
+	body, _ := json.Marshal(XenditEventCallback{
+		Event: "ewallet.capture",
+		Data: XenditEventData{
+			ID:            "ewc-" + referenceID,
+			ReferenceID:   referenceID,
+			Status:        status,
+			ChannelCode:   "ID_OVO",
+			CaptureAmount: models.NewMoney(amount),
+		},
+	})
+	return x.post(body)
+}
+
+func TestPaymentController_XenditCallback(t *testing.T) {
+	t.Setenv("XENDIT_CALLBACK_TOKEN", "callback-secret")
+
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	ctrl := NewPaymentController(mockPaymentRepo, mockRentalRepo, mockUserRepo, new(repositories.MockLoyaltyRepository), new(repositories.MockLateFeeRepository), gateways.NewFakeGateway())
+
+	e := echo.New()
+	e.POST("/payments/callbacks/xendit", ctrl.XenditCallback)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	rental := &models.Rental{ID: uuid.New(), UserID: uuid.New(), TotalCost: models.NewMoney(100000), Status: models.RentalStatusPending}
+	payment := &models.Payment{
+		ID:               uuid.New(),
+		RentalID:         rental.ID,
+		UserID:           rental.UserID,
+		Amount:           models.NewMoney(100000),
+		PaymentStatus:    models.PaymentStatusPending,
+		XenditExternalID: "payment-1",
+	}
+
+	mockPaymentRepo.On("FindByExternalID", "payment-1").Return(payment, nil)
+	mockPaymentRepo.On("MarkPaid", payment).Return(nil).Once()
+	mockPaymentRepo.On("MarkPaid", payment).Return(repositories.ErrPaymentNotPending)
+	mockPaymentRepo.On("FindByID", payment.ID).Return(&models.Payment{
+		ID:            payment.ID,
+		RentalID:      rental.ID,
+		PaymentStatus: models.PaymentStatusCompleted,
+	}, nil)
+	mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+	mockRentalRepo.On("Transition", rental.ID, models.RentalStatusPending, mock.Anything).Return(nil).Once()
+	mockUserRepo.On("FindByID", rental.UserID).Return(&models.User{ID: rental.UserID, Email: "test@example.com"}, nil)
+
+	t.Run("wrong token", func(t *testing.T) {
+		xendit := &fakeXendit{t, server.URL + "/payments/callbacks/xendit", "wrong"}
+		resp := xendit.payVirtualAccount("payment-1", 100000)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		mockPaymentRepo.AssertNotCalled(t, "FindByExternalID", mock.Anything)
+	})
+
+	xendit := &fakeXendit{t, server.URL + "/payments/callbacks/xendit", "callback-secret"}
+
+	t.Run("payment is recorded", func(t *testing.T) {
+		resp := xendit.payVirtualAccount("payment-1", 100000)
+		defer resp.Body.Close()
+
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Payment recorded", body["message"])
+		assert.Equal(t, models.RentalStatusPaid, rental.Status)
+		assert.Equal(t, models.NewMoney(100000), payment.XenditPaidAmount)
+		assert.Equal(t, "BCA", payment.XenditPaymentChannel)
+		assert.NotNil(t, payment.PaidAt)
+	})
+
+	t.Run("duplicate delivery", func(t *testing.T) {
+		resp := xendit.payVirtualAccount("payment-1", 100000)
+		defer resp.Body.Close()
+
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Payment already processed", body["message"])
+	})
+
+	t.Run("underpaid payment is recorded for review", func(t *testing.T) {
+		underpaid := &models.Payment{
+			ID:               uuid.New(),
+			RentalID:         rental.ID,
+			Amount:           models.NewMoney(100000),
+			PaymentStatus:    models.PaymentStatusPending,
+			XenditExternalID: "payment-4",
+		}
+		mockPaymentRepo.On("FindByExternalID", "payment-4").Return(underpaid, nil)
+		mockPaymentRepo.On("MarkUnderpaid", underpaid).Run(func(args mock.Arguments) {
+			args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusUnderpaid
+		}).Return(nil)
+
+		resp := xendit.payVirtualAccount("payment-4", 60000)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, models.PaymentStatusUnderpaid, underpaid.PaymentStatus)
+		assert.Equal(t, models.NewMoney(60000), underpaid.XenditPaidAmount)
+		assert.Equal(t, "BCA", underpaid.XenditPaymentChannel)
+		assert.NotNil(t, underpaid.PaidAt)
+	})
+
+	t.Run("unknown payment", func(t *testing.T) {
+		mockPaymentRepo.On("FindByExternalID", "payment-2").Return(nil, assert.AnError)
+		resp := xendit.payVirtualAccount("payment-2", 100000)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("failed e-wallet charge", func(t *testing.T) {
+		ewalletPayment := &models.Payment{
+			ID:               uuid.New(),
+			RentalID:         rental.ID,
+			Amount:           models.NewMoney(100000),
+			PaymentMethod:    models.PaymentMethodEWallet,
+			PaymentStatus:    models.PaymentStatusPending,
+			XenditExternalID: "payment-3",
+		}
+		mockPaymentRepo.On("FindByExternalID", "payment-3").Return(ewalletPayment, nil)
+		mockPaymentRepo.On("MarkFailed", ewalletPayment).Run(func(args mock.Arguments) {
+			args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusFailed
+		}).Return(nil)
+
+		resp := xendit.captureEWallet("payment-3", 100000, "FAILED")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, models.PaymentStatusFailed, ewalletPayment.PaymentStatus)
+	})
+
+	mockRentalRepo.AssertNumberOfCalls(t, "Transition", 1)
+}
@@ -0,0 +1,303 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeGateway is an in-memory PaymentGateway for tests and local development.
+// Account numbers are assigned in order, so results are deterministic.
+type FakeGateway struct {
+	mu       sync.Mutex
+	accounts map[string]*VirtualAccount
+	qrCodes  map[string][]QRCodePayment
+	charges  map[string]*EWalletCharge
+	sequence int
+
+	// SimulatedStatus is returned by SimulateVirtualAccountPayment, COMPLETED
+	// when empty
+	SimulatedStatus string
+	// RefundStatus is returned by CreateRefund, SUCCEEDED when empty
+	RefundStatus string
+	// Err makes every call fail when set
+	Err error
+
+	// Requests records every virtual account request in order
+	Requests []VirtualAccountRequest
+	// QRCodeRequests records every QR code request in order
+	QRCodeRequests []QRCodeRequest
+	// EWalletRequests records every e-wallet charge request in order
+	EWalletRequests []EWalletChargeRequest
+	// RefundRequests records every refund request in order
+	RefundRequests []RefundRequest
+
+	// Transactions are listed by ListTransactions in order
+	Transactions []Transaction
+	// TransactionListRequests records every transaction listing in order
+	TransactionListRequests []TransactionListRequest
+}
+
+// NewFakeGateway creates a new FakeGateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		accounts: make(map[string]*VirtualAccount),
+		qrCodes:  make(map[string][]QRCodePayment),
+		charges:  make(map[string]*EWalletCharge),
+	}
+}
+
+// CreateVirtualAccount stores and returns a new virtual account
+func (g *FakeGateway) CreateVirtualAccount(ctx context.Context, req VirtualAccountRequest) (*VirtualAccount, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Requests = append(g.Requests, req)
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	g.sequence++
+	account := &VirtualAccount{
+		ID:             fmt.Sprintf("fake-va-%d", g.sequence),
+		ExternalID:     req.ExternalID,
+		BankCode:       req.BankCode,
+		AccountNumber:  fmt.Sprintf("88080000%08d", g.sequence),
+		Name:           req.Name,
+		Status:         "ACTIVE",
+		ExpectedAmount: req.ExpectedAmount,
+	}
+	g.accounts[req.ExternalID] = account
+	copied := *account
+	return &copied, nil
+}
+
+// SimulateVirtualAccountPayment pays a virtual account created by the fake
+func (g *FakeGateway) SimulateVirtualAccountPayment(ctx context.Context, externalID string, amount float64) (*SimulatedPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	account, ok := g.accounts[externalID]
+	if !ok {
+		return nil, &APIError{StatusCode: 404, ErrorCode: "CALLBACK_VIRTUAL_ACCOUNT_NOT_FOUND_ERROR", Message: "virtual account not found"}
+	}
+
+	status := g.SimulatedStatus
+	if status == "" {
+		status = "COMPLETED"
+	}
+	if status == "COMPLETED" {
+		account.Status = "INACTIVE"
+	}
+	return &SimulatedPayment{Status: status, Message: "Payment simulated"}, nil
+}
+
+// CreateQRCode returns a QR code with a predictable QR string
+func (g *FakeGateway) CreateQRCode(ctx context.Context, req QRCodeRequest) (*QRCode, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.QRCodeRequests = append(g.QRCodeRequests, req)
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	g.sequence++
+	id := fmt.Sprintf("fake-qr-%d", g.sequence)
+	g.qrCodes[id] = nil
+	return &QRCode{
+		ID:          id,
+		ReferenceID: req.ReferenceID,
+		Status:      "ACTIVE",
+		Amount:      req.Amount,
+		QRString:    fmt.Sprintf("00020101021226fake%08d5303360", g.sequence),
+	}, nil
+}
+
+// CreateEWalletCharge returns a pending charge with predictable checkout URLs
+func (g *FakeGateway) CreateEWalletCharge(ctx context.Context, req EWalletChargeRequest) (*EWalletCharge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.EWalletRequests = append(g.EWalletRequests, req)
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	g.sequence++
+	id := fmt.Sprintf("fake-ewc-%d", g.sequence)
+	charge := &EWalletCharge{
+		ID:           id,
+		ReferenceID:  req.ReferenceID,
+		Status:       "PENDING",
+		ChannelCode:  req.ChannelCode,
+		ChargeAmount: req.Amount,
+	}
+	if req.ChannelCode != EWalletOVO {
+		charge.Actions = EWalletActions{
+			DesktopWebCheckoutURL:     "https://checkout.fake.test/" + id,
+			MobileWebCheckoutURL:      "https://checkout.fake.test/" + id + "/mobile",
+			MobileDeeplinkCheckoutURL: "fakewallet://checkout/" + id,
+		}
+	}
+	g.charges[id] = charge
+	copied := *charge
+	return &copied, nil
+}
+
+// CreateRefund returns a refund in RefundStatus
+func (g *FakeGateway) CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.RefundRequests = append(g.RefundRequests, req)
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	status := g.RefundStatus
+	if status == "" {
+		status = RefundStatusSucceeded
+	}
+	g.sequence++
+	return &Refund{
+		ID:          fmt.Sprintf("fake-rfd-%d", g.sequence),
+		ReferenceID: req.ReferenceID,
+		Status:      status,
+		Amount:      req.Amount,
+	}, nil
+}
+
+// GetVirtualAccount returns a virtual account created by the fake
+func (g *FakeGateway) GetVirtualAccount(ctx context.Context, id string) (*VirtualAccount, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	for _, account := range g.accounts {
+		if account.ID == id {
+			copied := *account
+			return &copied, nil
+		}
+	}
+	return nil, &APIError{StatusCode: 404, ErrorCode: "CALLBACK_VIRTUAL_ACCOUNT_NOT_FOUND_ERROR", Message: "virtual account not found"}
+}
+
+// GetQRCodePayments returns the payments made with PayQRCode
+func (g *FakeGateway) GetQRCodePayments(ctx context.Context, qrCodeID string) ([]QRCodePayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	payments, ok := g.qrCodes[qrCodeID]
+	if !ok {
+		return nil, &APIError{StatusCode: 404, ErrorCode: "DATA_NOT_FOUND", Message: "QR code not found"}
+	}
+	return append([]QRCodePayment(nil), payments...), nil
+}
+
+// GetEWalletCharge returns a charge created by the fake
+func (g *FakeGateway) GetEWalletCharge(ctx context.Context, id string) (*EWalletCharge, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	charge, ok := g.charges[id]
+	if !ok {
+		return nil, &APIError{StatusCode: 404, ErrorCode: "DATA_NOT_FOUND", Message: "charge not found"}
+	}
+	copied := *charge
+	return &copied, nil
+}
+
+// PayQRCode records a successful payment of the QR code, as if a customer
+// scanned it
+func (g *FakeGateway) PayQRCode(qrCodeID string, amount float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sequence++
+	g.qrCodes[qrCodeID] = append(g.qrCodes[qrCodeID], QRCodePayment{
+		ID:          fmt.Sprintf("fake-qrpy-%d", g.sequence),
+		QRID:        qrCodeID,
+		Status:      "SUCCEEDED",
+		Amount:      amount,
+		ChannelCode: "ID_DANA",
+	})
+}
+
+// SetEWalletChargeStatus moves a charge to SUCCEEDED, FAILED or VOIDED, as if
+// the customer confirmed or rejected it. A succeeded charge captures its full
+// amount.
+func (g *FakeGateway) SetEWalletChargeStatus(id, status string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if charge, ok := g.charges[id]; ok {
+		charge.Status = status
+		if status == "SUCCEEDED" {
+			charge.CaptureAmount = charge.ChargeAmount
+		}
+	}
+}
+
+// ListTransactions pages through Transactions, keeping those that match the
+// requested types and creation window
+func (g *FakeGateway) ListTransactions(ctx context.Context, req TransactionListRequest) (*TransactionPage, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.TransactionListRequests = append(g.TransactionListRequests, req)
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	page := &TransactionPage{}
+	started := req.AfterID == ""
+	for _, transaction := range g.Transactions {
+		if !started {
+			started = transaction.ID == req.AfterID
+			continue
+		}
+		if !transactionMatches(transaction, req) {
+			continue
+		}
+		if len(page.Data) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Data = append(page.Data, transaction)
+	}
+	return page, nil
+}
+
+func transactionMatches(transaction Transaction, req TransactionListRequest) bool {
+	if !req.CreatedFrom.IsZero() && transaction.Created.Before(req.CreatedFrom) {
+		return false
+	}
+	if !req.CreatedTo.IsZero() && transaction.Created.After(req.CreatedTo) {
+		return false
+	}
+	if len(req.Types) == 0 {
+		return true
+	}
+	for _, transactionType := range req.Types {
+		if transaction.Type == transactionType {
+			return true
+		}
+	}
+	return false
+}
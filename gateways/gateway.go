@@ -0,0 +1,217 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PaymentGateway creates and inspects charges at a payment provider
+type PaymentGateway interface {
+	CreateVirtualAccount(ctx context.Context, req VirtualAccountRequest) (*VirtualAccount, error)
+	SimulateVirtualAccountPayment(ctx context.Context, externalID string, amount float64) (*SimulatedPayment, error)
+	CreateQRCode(ctx context.Context, req QRCodeRequest) (*QRCode, error)
+	CreateEWalletCharge(ctx context.Context, req EWalletChargeRequest) (*EWalletCharge, error)
+	CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error)
+
+	GetVirtualAccount(ctx context.Context, id string) (*VirtualAccount, error)
+	GetQRCodePayments(ctx context.Context, qrCodeID string) ([]QRCodePayment, error)
+	GetEWalletCharge(ctx context.Context, id string) (*EWalletCharge, error)
+
+	ListTransactions(ctx context.Context, req TransactionListRequest) (*TransactionPage, error)
+}
+
+// VirtualAccountRequest asks for a virtual account the customer pays into
+type VirtualAccountRequest struct {
+	ExternalID     string  `json:"external_id"`
+	BankCode       string  `json:"bank_code"`
+	Name           string  `json:"name"`
+	ExpectedAmount float64 `json:"expected_amount,omitempty"`
+	IsClosed       bool    `json:"is_closed"`
+	IsSingleUse    bool    `json:"is_single_use"`
+}
+
+// VirtualAccount is a virtual account created by the provider
+type VirtualAccount struct {
+	ID             string    `json:"id"`
+	ExternalID     string    `json:"external_id"`
+	BankCode       string    `json:"bank_code"`
+	AccountNumber  string    `json:"account_number"`
+	Name           string    `json:"name"`
+	Status         string    `json:"status"`
+	ExpectedAmount float64   `json:"expected_amount"`
+	ExpirationDate time.Time `json:"expiration_date"`
+}
+
+// SimulatedPayment is the result of paying a virtual account in test mode
+type SimulatedPayment struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// QRCodeRequest asks for a dynamic QRIS code for a fixed amount
+type QRCodeRequest struct {
+	ReferenceID string  `json:"reference_id"`
+	Type        string  `json:"type"`
+	Currency    string  `json:"currency"`
+	Amount      float64 `json:"amount"`
+}
+
+// QRCode is a QRIS code the customer scans with any supporting app
+type QRCode struct {
+	ID          string    `json:"id"`
+	ReferenceID string    `json:"reference_id"`
+	Status      string    `json:"status"`
+	Amount      float64   `json:"amount"`
+	QRString    string    `json:"qr_string"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// QRCodePayment is a payment made by scanning a QR code
+type QRCodePayment struct {
+	ID          string    `json:"id"`
+	QRID        string    `json:"qr_id"`
+	ReferenceID string    `json:"reference_id"`
+	Status      string    `json:"status"`
+	Amount      float64   `json:"amount"`
+	ChannelCode string    `json:"channel_code"`
+	Created     time.Time `json:"created"`
+}
+
+// E-wallet channel codes supported for one time payments
+const (
+	EWalletOVO       = "ID_OVO"
+	EWalletDANA      = "ID_DANA"
+	EWalletShopeePay = "ID_SHOPEEPAY"
+)
+
+// EWalletChargeRequest asks for a one time e-wallet charge
+type EWalletChargeRequest struct {
+	ReferenceID       string                   `json:"reference_id"`
+	Currency          string                   `json:"currency"`
+	Amount            float64                  `json:"amount"`
+	CheckoutMethod    string                   `json:"checkout_method"`
+	ChannelCode       string                   `json:"channel_code"`
+	ChannelProperties EWalletChannelProperties `json:"channel_properties"`
+}
+
+// EWalletChannelProperties are the channel specific fields of a charge. OVO
+// needs the customer's mobile number, DANA and ShopeePay a redirect URL.
+type EWalletChannelProperties struct {
+	MobileNumber       string `json:"mobile_number,omitempty"`
+	SuccessRedirectURL string `json:"success_redirect_url,omitempty"`
+}
+
+// EWalletCharge is a charge waiting for the customer to confirm it
+type EWalletCharge struct {
+	ID           string  `json:"id"`
+	ReferenceID  string  `json:"reference_id"`
+	Status       string  `json:"status"`
+	ChannelCode  string  `json:"channel_code"`
+	ChargeAmount float64 `json:"charge_amount"`
+	// CaptureAmount is the amount paid once the charge SUCCEEDED
+	CaptureAmount float64        `json:"capture_amount"`
+	Actions       EWalletActions `json:"actions"`
+	Updated       time.Time      `json:"updated"`
+}
+
+// EWalletActions are the ways the customer can confirm a charge. OVO pushes a
+// notification to the app and returns no URLs.
+type EWalletActions struct {
+	DesktopWebCheckoutURL     string `json:"desktop_web_checkout_url"`
+	MobileWebCheckoutURL      string `json:"mobile_web_checkout_url"`
+	MobileDeeplinkCheckoutURL string `json:"mobile_deeplink_checkout_url"`
+}
+
+// Refund reasons accepted by the provider
+const (
+	RefundReasonRequestedByCustomer = "REQUESTED_BY_CUSTOMER"
+	RefundReasonCancellation        = "CANCELLATION"
+	RefundReasonDuplicate           = "DUPLICATE"
+	RefundReasonOthers              = "OTHERS"
+)
+
+// Refund statuses reported by the provider
+const (
+	RefundStatusPending   = "PENDING"
+	RefundStatusSucceeded = "SUCCEEDED"
+	RefundStatusFailed    = "FAILED"
+)
+
+// RefundRequest asks to return all or part of a QR code or e-wallet payment.
+// E-wallet refunds name the charge in InvoiceID, QR code refunds name the QR
+// payment in QRPaymentID.
+type RefundRequest struct {
+	ReferenceID string  `json:"reference_id"`
+	InvoiceID   string  `json:"invoice_id,omitempty"`
+	QRPaymentID string  `json:"-"`
+	Currency    string  `json:"currency,omitempty"`
+	Amount      float64 `json:"amount"`
+	Reason      string  `json:"reason"`
+}
+
+// Refund is a refund accepted by the provider. Most refunds are still PENDING
+// and finish with a callback.
+type Refund struct {
+	ID          string  `json:"id"`
+	ReferenceID string  `json:"reference_id"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+	FailureCode string  `json:"failure_code"`
+}
+
+// Transaction types and statuses reported by the provider
+const (
+	TransactionTypePayment = "PAYMENT"
+	TransactionTypeRefund  = "REFUND"
+
+	TransactionStatusPending  = "PENDING"
+	TransactionStatusSuccess  = "SUCCESS"
+	TransactionStatusFailed   = "FAILED"
+	TransactionStatusVoided   = "VOIDED"
+	TransactionStatusReversed = "REVERSED"
+)
+
+// TransactionListRequest asks for one page of the transactions created
+// within a window, oldest first. AfterID continues after the last transaction
+// of the previous page.
+type TransactionListRequest struct {
+	Types       []string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Limit       int
+	AfterID     string
+}
+
+// Transaction is a movement of money on the provider account. ProductID is
+// the ID of the charge, QR code payment or virtual account payment behind it
+// and ReferenceID the reference we gave when creating it.
+type Transaction struct {
+	ID              string    `json:"id"`
+	ProductID       string    `json:"product_id"`
+	Type            string    `json:"type"`
+	Status          string    `json:"status"`
+	ChannelCategory string    `json:"channel_category"`
+	ChannelCode     string    `json:"channel_code"`
+	ReferenceID     string    `json:"reference_id"`
+	Currency        string    `json:"currency"`
+	Amount          float64   `json:"amount"`
+	Created         time.Time `json:"created"`
+}
+
+// TransactionPage is one page of a transaction listing
+type TransactionPage struct {
+	Data    []Transaction `json:"data"`
+	HasMore bool          `json:"has_more"`
+}
+
+// APIError is an error response returned by the provider
+type APIError struct {
+	StatusCode int
+	ErrorCode  string `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("payment gateway returned %d %s: %s", e.StatusCode, e.ErrorCode, e.Message)
+}
@@ -0,0 +1,241 @@
+package gateways
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultXenditBaseURL = "https://api.xendit.co"
+	defaultXenditTimeout = 30 * time.Second
+
+	// xenditQRCodeAPIVersion selects the QR code API that takes reference_id
+	xenditQRCodeAPIVersion = "2022-07-31"
+)
+
+// XenditConfig configures the Xendit client
+type XenditConfig struct {
+	BaseURL   string
+	SecretKey string
+	Timeout   time.Duration
+}
+
+// XenditConfigFromEnv reads XENDIT_BASE_URL, XENDIT_SECRET_KEY and
+// XENDIT_TIMEOUT. The base URL defaults to the live API.
+func XenditConfigFromEnv() XenditConfig {
+	config := XenditConfig{
+		BaseURL:   os.Getenv("XENDIT_BASE_URL"),
+		SecretKey: os.Getenv("XENDIT_SECRET_KEY"),
+		Timeout:   defaultXenditTimeout,
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = defaultXenditBaseURL
+	}
+	if value := os.Getenv("XENDIT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			log.Printf("Invalid XENDIT_TIMEOUT %q, using %s", value, defaultXenditTimeout)
+		} else {
+			config.Timeout = timeout
+		}
+	}
+	return config
+}
+
+// XenditGateway is the PaymentGateway backed by the Xendit API
+type XenditGateway struct {
+	baseURL   string
+	secretKey string
+	client    *http.Client
+}
+
+// NewXenditGateway creates a new XenditGateway
+func NewXenditGateway(config XenditConfig) *XenditGateway {
+	return &XenditGateway{
+		baseURL:   strings.TrimRight(config.BaseURL, "/"),
+		secretKey: config.SecretKey,
+		client:    &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// CreateVirtualAccount creates a fixed virtual account
+func (g *XenditGateway) CreateVirtualAccount(ctx context.Context, req VirtualAccountRequest) (*VirtualAccount, error) {
+	var account VirtualAccount
+	if err := g.do(ctx, http.MethodPost, "/callback_virtual_accounts", req, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SimulateVirtualAccountPayment pays a virtual account. It only works with
+// test mode keys.
+func (g *XenditGateway) SimulateVirtualAccountPayment(ctx context.Context, externalID string, amount float64) (*SimulatedPayment, error) {
+	path := fmt.Sprintf("/callback_virtual_accounts/external_id=%s/simulate_payment", url.PathEscape(externalID))
+	var result SimulatedPayment
+	if err := g.do(ctx, http.MethodPost, path, map[string]interface{}{"amount": amount}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateQRCode creates a dynamic QRIS code
+func (g *XenditGateway) CreateQRCode(ctx context.Context, req QRCodeRequest) (*QRCode, error) {
+	if req.Type == "" {
+		req.Type = "DYNAMIC"
+	}
+	if req.Currency == "" {
+		req.Currency = "IDR"
+	}
+	var code QRCode
+	if err := g.do(ctx, http.MethodPost, "/qr_codes", req, &code); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// CreateEWalletCharge creates a one time e-wallet charge
+func (g *XenditGateway) CreateEWalletCharge(ctx context.Context, req EWalletChargeRequest) (*EWalletCharge, error) {
+	if req.Currency == "" {
+		req.Currency = "IDR"
+	}
+	if req.CheckoutMethod == "" {
+		req.CheckoutMethod = "ONE_TIME_PAYMENT"
+	}
+	var charge EWalletCharge
+	if err := g.do(ctx, http.MethodPost, "/ewallets/charges", req, &charge); err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// CreateRefund refunds an e-wallet charge or a QR code payment
+func (g *XenditGateway) CreateRefund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	var refund Refund
+	if req.QRPaymentID != "" {
+		path := fmt.Sprintf("/qr_codes/payments/%s/refunds", url.PathEscape(req.QRPaymentID))
+		body := map[string]interface{}{
+			"reference_id": req.ReferenceID,
+			"amount":       req.Amount,
+			"reason":       req.Reason,
+		}
+		if err := g.do(ctx, http.MethodPost, path, body, &refund); err != nil {
+			return nil, err
+		}
+		return &refund, nil
+	}
+
+	if req.Currency == "" {
+		req.Currency = "IDR"
+	}
+	if err := g.do(ctx, http.MethodPost, "/refunds", req, &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// GetVirtualAccount returns a virtual account. Closed single use accounts
+// become INACTIVE once they are paid.
+func (g *XenditGateway) GetVirtualAccount(ctx context.Context, id string) (*VirtualAccount, error) {
+	var account VirtualAccount
+	if err := g.do(ctx, http.MethodGet, "/callback_virtual_accounts/"+url.PathEscape(id), nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetQRCodePayments returns the payments made with a QR code
+func (g *XenditGateway) GetQRCodePayments(ctx context.Context, qrCodeID string) ([]QRCodePayment, error) {
+	var result struct {
+		Data []QRCodePayment `json:"data"`
+	}
+	if err := g.do(ctx, http.MethodGet, "/qr_codes/"+url.PathEscape(qrCodeID)+"/payments", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetEWalletCharge returns the current state of an e-wallet charge
+func (g *XenditGateway) GetEWalletCharge(ctx context.Context, id string) (*EWalletCharge, error) {
+	var charge EWalletCharge
+	if err := g.do(ctx, http.MethodGet, "/ewallets/charges/"+url.PathEscape(id), nil, &charge); err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// ListTransactions returns one page of the account's transactions
+func (g *XenditGateway) ListTransactions(ctx context.Context, req TransactionListRequest) (*TransactionPage, error) {
+	query := url.Values{}
+	for _, transactionType := range req.Types {
+		query.Add("types", transactionType)
+	}
+	if !req.CreatedFrom.IsZero() {
+		query.Set("created[gte]", req.CreatedFrom.UTC().Format(time.RFC3339))
+	}
+	if !req.CreatedTo.IsZero() {
+		query.Set("created[lte]", req.CreatedTo.UTC().Format(time.RFC3339))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if req.AfterID != "" {
+		query.Set("after_id", req.AfterID)
+	}
+
+	var page TransactionPage
+	if err := g.do(ctx, http.MethodGet, "/transactions?"+query.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// do sends a JSON request and decodes a successful response into out
+func (g *XenditGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.secretKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	if strings.HasPrefix(path, "/qr_codes") {
+		req.Header.Set("api-version", xenditQRCodeAPIVersion)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
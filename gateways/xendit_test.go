@@ -0,0 +1,159 @@
+package gateways
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXenditGateway_CreateVirtualAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "secret", user)
+		assert.Equal(t, "/callback_virtual_accounts", r.URL.Path)
+
+		var req VirtualAccountRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "payment-1", req.ExternalID)
+		assert.Equal(t, float64(150000), req.ExpectedAmount)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":              "va-1",
+			"external_id":     req.ExternalID,
+			"bank_code":       req.BankCode,
+			"account_number":  "8808123456",
+			"status":          "PENDING",
+			"expected_amount": req.ExpectedAmount,
+		})
+	}))
+	defer server.Close()
+
+	gateway := NewXenditGateway(XenditConfig{BaseURL: server.URL, SecretKey: "secret", Timeout: time.Second})
+	account, err := gateway.CreateVirtualAccount(context.Background(), VirtualAccountRequest{
+		ExternalID:     "payment-1",
+		BankCode:       "BCA",
+		ExpectedAmount: 150000,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "va-1", account.ID)
+	assert.Equal(t, "8808123456", account.AccountNumber)
+}
+
+func TestXenditGateway_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow/callback_virtual_accounts":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error_code":"API_VALIDATION_ERROR","message":"bank_code is invalid"}`))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("error response", func(t *testing.T) {
+		gateway := NewXenditGateway(XenditConfig{BaseURL: server.URL, Timeout: time.Second})
+		_, err := gateway.CreateVirtualAccount(context.Background(), VirtualAccountRequest{BankCode: "XXX"})
+
+		var apiErr *APIError
+		assert.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.Equal(t, "API_VALIDATION_ERROR", apiErr.ErrorCode)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		gateway := NewXenditGateway(XenditConfig{BaseURL: server.URL + "/slow", Timeout: 50 * time.Millisecond})
+		_, err := gateway.CreateVirtualAccount(context.Background(), VirtualAccountRequest{})
+		assert.Error(t, err)
+	})
+}
+
+func TestXenditGateway_CreateRefund(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		switch r.URL.Path {
+		case "/refunds":
+			assert.Equal(t, "ewc-1", body["invoice_id"])
+			assert.Equal(t, "IDR", body["currency"])
+		case "/qr_codes/payments/qrpy-1/refunds":
+			assert.Equal(t, xenditQRCodeAPIVersion, r.Header.Get("api-version"))
+			assert.Nil(t, body["invoice_id"])
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":           "rfd-1",
+			"reference_id": body["reference_id"],
+			"status":       "PENDING",
+			"amount":       body["amount"],
+		})
+	}))
+	defer server.Close()
+
+	gateway := NewXenditGateway(XenditConfig{BaseURL: server.URL, Timeout: time.Second})
+
+	t.Run("e-wallet charge", func(t *testing.T) {
+		refund, err := gateway.CreateRefund(context.Background(), RefundRequest{
+			ReferenceID: "refund-1",
+			InvoiceID:   "ewc-1",
+			Amount:      50000,
+			Reason:      RefundReasonCancellation,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "rfd-1", refund.ID)
+		assert.Equal(t, RefundStatusPending, refund.Status)
+		assert.Equal(t, float64(50000), refund.Amount)
+	})
+
+	t.Run("QR code payment", func(t *testing.T) {
+		refund, err := gateway.CreateRefund(context.Background(), RefundRequest{
+			ReferenceID: "refund-2",
+			QRPaymentID: "qrpy-1",
+			Amount:      25000,
+			Reason:      RefundReasonOthers,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "refund-2", refund.ReferenceID)
+	})
+}
+
+func TestXenditGateway_ListTransactions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/transactions", r.URL.Path)
+		query := r.URL.Query()
+		assert.Equal(t, []string{"PAYMENT"}, query["types"])
+		assert.Equal(t, "2025-03-01T00:00:00Z", query.Get("created[gte]"))
+		assert.Equal(t, "2025-03-02T00:00:00Z", query.Get("created[lte]"))
+		assert.Equal(t, "50", query.Get("limit"))
+		assert.Equal(t, "txn-1", query.Get("after_id"))
+
+		w.Write([]byte(`{"has_more":true,"data":[{"id":"txn-2","product_id":"ewc-1","type":"PAYMENT","status":"SUCCESS","reference_id":"payment-1","amount":150000}]}`))
+	}))
+	defer server.Close()
+
+	gateway := NewXenditGateway(XenditConfig{BaseURL: server.URL, Timeout: time.Second})
+	page, err := gateway.ListTransactions(context.Background(), TransactionListRequest{
+		Types:       []string{TransactionTypePayment},
+		CreatedFrom: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		CreatedTo:   time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC),
+		Limit:       50,
+		AfterID:     "txn-1",
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, "ewc-1", page.Data[0].ProductID)
+	assert.Equal(t, TransactionStatusSuccess, page.Data[0].Status)
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"invitified-go/repositories"
+	"log"
+	"time"
+)
+
+// IdempotencyCleanupJob deletes stored idempotency keys once they are older
+// than the TTL. Retries after that are treated as new requests.
+type IdempotencyCleanupJob struct {
+	repo repositories.IdempotencyRepository
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewIdempotencyCleanupJob creates a new IdempotencyCleanupJob
+func NewIdempotencyCleanupJob(repo repositories.IdempotencyRepository, ttl time.Duration) *IdempotencyCleanupJob {
+	return &IdempotencyCleanupJob{repo, ttl, time.Now}
+}
+
+// Run deletes the expired keys
+func (j *IdempotencyCleanupJob) Run(ctx context.Context) error {
+	deleted, err := j.repo.DeleteCreatedBefore(j.now().Add(-j.ttl))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired idempotency key(s)", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"invitified-go/config"
+	"invitified-go/gateways"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"invitified-go/utils"
+	"os"
+	"time"
+)
+
+// InitJobs registers the background jobs and starts running them
+func InitJobs(ctx context.Context) {
+	// Initialize repositories
+	rentalRepo := repositories.NewRentalRepository(config.DB)
+	paymentRepo := repositories.NewPaymentRepository(config.DB)
+	idempotencyRepo := repositories.NewIdempotencyRepository(config.DB)
+	userRepo := repositories.NewUserRepository(config.DB)
+	lateFeeRepo := repositories.NewLateFeeRepository(config.DB)
+
+	paymentGateway := gateways.NewXenditGateway(gateways.XenditConfigFromEnv())
+
+	scheduler := NewScheduler(NewAdvisoryLocker(config.DB))
+
+	rentalExpiry := NewRentalExpiryJob(rentalRepo, paymentRepo, utils.DurationFromEnv("RENTAL_PENDING_TTL", time.Hour))
+	scheduler.Register(Job{
+		Name:     "rental-expiry",
+		Interval: utils.DurationFromEnv("RENTAL_EXPIRY_INTERVAL", time.Minute),
+		Run:      rentalExpiry.Run,
+	})
+
+	scheduler.Register(Job{
+		Name:     "late-return",
+		Interval: utils.DurationFromEnv("LATE_RETURN_INTERVAL", time.Hour),
+		Run:      NewLateReturnJob(rentalRepo, lateFeeRepo, userRepo).Run,
+	})
+
+	idempotencyCleanup := NewIdempotencyCleanupJob(idempotencyRepo, utils.DurationFromEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour))
+	scheduler.Register(Job{
+		Name:     "idempotency-cleanup",
+		Interval: time.Hour,
+		Run:      idempotencyCleanup.Run,
+	})
+
+	scheduler.Register(Job{
+		Name:     "payment-reconciliation",
+		Interval: utils.DurationFromEnv("RECONCILIATION_INTERVAL", 24*time.Hour),
+		Run:      NewReconciliationJobFromEnv(paymentRepo, rentalRepo, userRepo, paymentGateway).Run,
+	})
+
+	scheduler.Start(ctx)
+}
+
+// NewReconciliationJobFromEnv creates the reconciliation job configured by
+// RECONCILIATION_WINDOW (48h by default) and RECONCILIATION_REPORT_DIR
+// ("reports" by default)
+func NewReconciliationJobFromEnv(paymentRepo repositories.PaymentRepository, rentalRepo repositories.RentalRepository, userRepo repositories.UserRepository, gateway gateways.PaymentGateway) *ReconciliationJob {
+	reportDir := os.Getenv("RECONCILIATION_REPORT_DIR")
+	if reportDir == "" {
+		reportDir = "reports"
+	}
+	reconciler := services.NewReconciler(paymentRepo, rentalRepo, userRepo, gateway)
+	return NewReconciliationJob(reconciler, utils.DurationFromEnv("RECONCILIATION_WINDOW", 48*time.Hour), reportDir)
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"log"
+	"time"
+)
+
+// LateReturnJob moves PICKED_UP rentals to OVERDUE once their end date and
+// grace period have passed and charges the late fee of every overdue rental
+// for the days it is late.
+type LateReturnJob struct {
+	rentalRepo repositories.RentalRepository
+	lifecycle  *services.RentalLifecycle
+	lateFees   *services.LateFees
+	now        func() time.Time
+}
+
+// NewLateReturnJob creates a new LateReturnJob
+func NewLateReturnJob(rentalRepo repositories.RentalRepository, lateFeeRepo repositories.LateFeeRepository, userRepo repositories.UserRepository) *LateReturnJob {
+	return &LateReturnJob{
+		rentalRepo: rentalRepo,
+		lifecycle:  services.NewRentalLifecycle(rentalRepo),
+		lateFees:   services.NewLateFees(lateFeeRepo, userRepo),
+		now:        time.Now,
+	}
+}
+
+// Run marks the rentals that are late as OVERDUE and accrues their fees
+func (j *LateReturnJob) Run(ctx context.Context) error {
+	now := j.now()
+	rentals, err := j.rentalRepo.FindEndedBefore(now.Add(-j.lateFees.Policy().GracePeriod))
+	if err != nil {
+		return err
+	}
+
+	overdue := 0
+	for i := range rentals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rental := &rentals[i]
+		if rental.Status == models.RentalStatusPickedUp {
+			if err := j.lifecycle.Transition(rental, models.RentalStatusOverdue, nil); err != nil {
+				// The rental was returned since it was loaded
+				if errors.Is(err, repositories.ErrRentalStatusChanged) {
+					continue
+				}
+				log.Printf("Failed to mark rental %s overdue: %v", rental.ID, err)
+				continue
+			}
+			overdue++
+		}
+		if _, err := j.lateFees.Accrue(rental, now); err != nil {
+			log.Printf("Failed to charge late fee of rental %s: %v", rental.ID, err)
+		}
+	}
+
+	if overdue > 0 {
+		log.Printf("Marked %d rental(s) overdue", overdue)
+	}
+	return nil
+}
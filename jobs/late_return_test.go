@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLateReturnJob_Run(t *testing.T) {
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockLateFeeRepo := new(repositories.MockLateFeeRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	job := NewLateReturnJob(mockRentalRepo, mockLateFeeRepo, mockUserRepo)
+	job.now = func() time.Time { return now }
+
+	items := []models.RentalItem{{Quantity: 1, Days: 5, LineTotal: models.NewMoney(500000)}}
+	userID := uuid.New()
+	// Due back this morning and still out
+	late := models.Rental{ID: uuid.New(), UserID: userID, Status: models.RentalStatusPickedUp, EndDate: now.Add(-3 * time.Hour), Items: items}
+	// Overdue for a day and a half already
+	overdue := models.Rental{ID: uuid.New(), UserID: userID, Status: models.RentalStatusOverdue, EndDate: now.Add(-36 * time.Hour), Items: items}
+	returnedMeanwhile := models.Rental{ID: uuid.New(), UserID: userID, Status: models.RentalStatusPickedUp, EndDate: now.Add(-5 * time.Hour), Items: items}
+
+	mockRentalRepo.On("FindEndedBefore", now.Add(-2*time.Hour)).
+		Return([]models.Rental{late, overdue, returnedMeanwhile}, nil)
+	mockRentalRepo.On("Transition", late.ID, models.RentalStatusPickedUp, mock.MatchedBy(func(updates map[string]interface{}) bool {
+		return updates["status"] == models.RentalStatusOverdue
+	})).Return(nil)
+	mockRentalRepo.On("Transition", returnedMeanwhile.ID, models.RentalStatusPickedUp, mock.Anything).
+		Return(repositories.ErrRentalStatusChanged)
+	mockLateFeeRepo.On("Accrue", mock.MatchedBy(func(fee *models.LateFee) bool {
+		return fee.RentalID == late.ID && fee.DaysLate == 1 && fee.Amount == models.NewMoney(100000) &&
+			fee.Status == models.LateFeeStatusAccruing
+	})).Return(true, nil)
+	// Charged twice in one day, the second run changes nothing
+	mockLateFeeRepo.On("Accrue", mock.MatchedBy(func(fee *models.LateFee) bool {
+		return fee.RentalID == overdue.ID && fee.DaysLate == 2 && fee.Amount == models.NewMoney(200000)
+	})).Return(false, nil)
+	mockUserRepo.On("FindByID", userID).Return(nil, errors.New("no mail in tests"))
+
+	assert.NoError(t, job.Run(context.Background()))
+
+	mockRentalRepo.AssertExpectations(t)
+	mockLateFeeRepo.AssertExpectations(t)
+	mockLateFeeRepo.AssertNumberOfCalls(t, "Accrue", 2)
+	// Only the fee that grew is emailed
+	mockUserRepo.AssertNumberOfCalls(t, "FindByID", 1)
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"invitified-go/services"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReconciliationJob reconciles the gateway's payments of the last window and
+// writes a report of the discrepancies it could not resolve. The window
+// overlaps earlier runs so late transactions are still looked at.
+type ReconciliationJob struct {
+	reconciler *services.Reconciler
+	window     time.Duration
+	reportDir  string
+	now        func() time.Time
+}
+
+// NewReconciliationJob creates a new ReconciliationJob writing reports into
+// reportDir
+func NewReconciliationJob(reconciler *services.Reconciler, window time.Duration, reportDir string) *ReconciliationJob {
+	return &ReconciliationJob{
+		reconciler: reconciler,
+		window:     window,
+		reportDir:  reportDir,
+		now:        time.Now,
+	}
+}
+
+// Run reconciles the window ending now
+func (j *ReconciliationJob) Run(ctx context.Context) error {
+	to := j.now()
+	_, err := j.RunRange(ctx, to.Add(-j.window), to)
+	return err
+}
+
+// RunRange reconciles the gateway payments created between from and to and
+// returns the path of the report
+func (j *ReconciliationJob) RunRange(ctx context.Context, from, to time.Time) (string, error) {
+	report, err := j.reconciler.Run(ctx, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Reconciled %d gateway transaction(s) from %s to %s: %d matched, %d fixed, %d discrepancies",
+		report.Transactions, from.Format(time.RFC3339), to.Format(time.RFC3339),
+		report.Matched, len(report.Fixes), len(report.Discrepancies))
+
+	path, err := writeReport(j.reportDir, to, report)
+	if err != nil {
+		return "", fmt.Errorf("failed to write reconciliation report: %w", err)
+	}
+	return path, nil
+}
+
+// writeReport stores the report as JSON named after the end of its window
+func writeReport(dir string, to time.Time, report *services.ReconciliationReport) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "reconciliation-"+to.UTC().Format("20060102T150405Z")+".json")
+	return path, os.WriteFile(path, data, 0o644)
+}
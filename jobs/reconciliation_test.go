@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestReconciliationJob_Run(t *testing.T) {
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	gateway := gateways.NewFakeGateway()
+
+	now := time.Date(2025, 3, 2, 1, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	reconciler := services.NewReconciler(mockPaymentRepo, new(repositories.MockRentalRepository), new(repositories.MockUserRepository), gateway)
+	job := NewReconciliationJob(reconciler, 48*time.Hour, dir)
+	job.now = func() time.Time { return now }
+
+	gateway.Transactions = []gateways.Transaction{
+		{ID: "txn-1", ProductID: "ewc-1", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 20000, Created: now.Add(-time.Hour)},
+	}
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-1").Return(nil, gorm.ErrRecordNotFound)
+	mockPaymentRepo.On("FindWithFilter", mock.Anything, mock.Anything, 0).
+		Return([]models.Payment{{ID: uuid.New(), PaymentStatus: models.PaymentStatusRefunded}}, int64(1), nil)
+
+	assert.NoError(t, job.Run(context.Background()))
+	assert.Equal(t, now.Add(-48*time.Hour), gateway.TransactionListRequests[0].CreatedFrom)
+
+	data, err := os.ReadFile(filepath.Join(dir, "reconciliation-20250302T010000Z.json"))
+	assert.NoError(t, err)
+	var report services.ReconciliationReport
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, 1, report.Transactions)
+	assert.Len(t, report.Discrepancies, 2)
+}
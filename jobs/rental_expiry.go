@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/services"
+	"log"
+	"time"
+)
+
+// expiryBatchSize limits how many rentals are expired in a single run
+const expiryBatchSize = 100
+
+// RentalExpiryJob moves unpaid PENDING rentals and extensions to EXPIRED once
+// they are older than the TTL, releasing the stock they were holding.
+type RentalExpiryJob struct {
+	rentalRepo  repositories.RentalRepository
+	paymentRepo repositories.PaymentRepository
+	lifecycle   *services.RentalLifecycle
+	ttl         time.Duration
+	now         func() time.Time
+}
+
+// NewRentalExpiryJob creates a new RentalExpiryJob
+func NewRentalExpiryJob(rentalRepo repositories.RentalRepository, paymentRepo repositories.PaymentRepository, ttl time.Duration) *RentalExpiryJob {
+	return &RentalExpiryJob{
+		rentalRepo:  rentalRepo,
+		paymentRepo: paymentRepo,
+		lifecycle:   services.NewRentalLifecycle(rentalRepo),
+		ttl:         ttl,
+		now:         time.Now,
+	}
+}
+
+// Run expires one batch of stale PENDING rentals and their pending payments
+func (j *RentalExpiryJob) Run(ctx context.Context) error {
+	now := j.now()
+	rentals, err := j.rentalRepo.FindPendingCreatedBefore(now.Add(-j.ttl), expiryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	expired := 0
+	for i := range rentals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rental := &rentals[i]
+		if err := j.lifecycle.Transition(rental, models.RentalStatusExpired, nil); err != nil {
+			// The rental was paid or cancelled since it was loaded
+			if errors.Is(err, repositories.ErrRentalStatusChanged) {
+				continue
+			}
+			log.Printf("Failed to expire rental %s: %v", rental.ID, err)
+			continue
+		}
+		if err := j.paymentRepo.ExpirePendingByRentalID(rental.ID, now); err != nil {
+			log.Printf("Failed to expire payments of rental %s: %v", rental.ID, err)
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		log.Printf("Expired %d pending rental(s)", expired)
+	}
+
+	// Unpaid extensions hold the extra days of their rental in the same way
+	extensions, err := j.rentalRepo.ExpireExtensionsCreatedBefore(now.Add(-j.ttl))
+	if err != nil {
+		return err
+	}
+	if extensions > 0 {
+		log.Printf("Expired %d pending rental extension(s)", extensions)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRentalExpiryJob_Run(t *testing.T) {
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	job := NewRentalExpiryJob(mockRentalRepo, mockPaymentRepo, time.Hour)
+	job.now = func() time.Time { return now }
+
+	stale := models.Rental{ID: uuid.New(), Status: models.RentalStatusPending}
+	paidMeanwhile := models.Rental{ID: uuid.New(), Status: models.RentalStatusPending}
+
+	mockRentalRepo.On("FindPendingCreatedBefore", now.Add(-time.Hour), expiryBatchSize).
+		Return([]models.Rental{stale, paidMeanwhile}, nil)
+	mockRentalRepo.On("Transition", stale.ID, models.RentalStatusPending, mock.MatchedBy(func(updates map[string]interface{}) bool {
+		return updates["status"] == models.RentalStatusExpired
+	})).Return(nil)
+	mockRentalRepo.On("Transition", paidMeanwhile.ID, models.RentalStatusPending, mock.Anything).
+		Return(repositories.ErrRentalStatusChanged)
+	mockPaymentRepo.On("ExpirePendingByRentalID", stale.ID, now).Return(nil)
+	mockRentalRepo.On("ExpireExtensionsCreatedBefore", now.Add(-time.Hour)).Return(int64(0), nil)
+
+	assert.NoError(t, job.Run(context.Background()))
+
+	mockRentalRepo.AssertExpectations(t)
+	mockPaymentRepo.AssertExpectations(t)
+	mockPaymentRepo.AssertNotCalled(t, "ExpirePendingByRentalID", paidMeanwhile.ID, now)
+}
+
+type fakeLocker struct {
+	held bool
+}
+
+func (l *fakeLocker) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	if l.held {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func TestScheduler_RunOnceSkipsWhenLocked(t *testing.T) {
+	runs := 0
+	job := Job{Name: "test", Interval: time.Minute, Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}
+
+	locker := &fakeLocker{held: true}
+	scheduler := NewScheduler(locker)
+	scheduler.RunOnce(context.Background(), job)
+	assert.Equal(t, 0, runs)
+
+	locker.held = false
+	scheduler.RunOnce(context.Background(), job)
+	assert.Equal(t, 1, runs)
+}
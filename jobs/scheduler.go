@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job is a unit of background work that runs on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Locker makes sure a job runs on only one app instance at a time
+type Locker interface {
+	// WithLock runs fn while holding the named lock. It reports false without
+	// running fn when another instance already holds the lock.
+	WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+}
+
+// AdvisoryLocker implements Locker with Postgres session-level advisory
+// locks. The lock is taken on a connection set aside for it, so the job can
+// run for as long as it needs on the pool without keeping a transaction
+// open, and is released explicitly before that connection goes back.
+type AdvisoryLocker struct {
+	db *gorm.DB
+}
+
+// NewAdvisoryLocker creates a new AdvisoryLocker
+func NewAdvisoryLocker(db *gorm.DB) *AdvisoryLocker {
+	return &AdvisoryLocker{db}
+}
+
+func (l *AdvisoryLocker) WithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	key := lockKey(name)
+	acquired := false
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer unlock(conn, name, key)
+	return true, fn(ctx)
+}
+
+// unlock releases the advisory lock held on conn. It runs after the job, when
+// its context may be done. A connection that could not be unlocked is
+// discarded, closing its session releases the lock.
+func unlock(conn *sql.Conn, name string, key int64) {
+	released := false
+	err := conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", key).Scan(&released)
+	if err == nil && released {
+		return
+	}
+	log.Printf("Failed to release lock of job %s, closing its connection: %v", name, err)
+	conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+}
+
+// lockKey turns a job name into the bigint key used by the advisory lock
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("invitified-go:" + name))
+	return int64(h.Sum64())
+}
+
+// Scheduler runs registered jobs on their intervals until its context ends
+type Scheduler struct {
+	locker Locker
+	jobs   []Job
+}
+
+// NewScheduler creates a new Scheduler
+func NewScheduler(locker Locker) *Scheduler {
+	return &Scheduler{locker: locker}
+}
+
+// Register adds a job to the scheduler. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job in its own goroutine
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx, job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs the job a single time if no other instance is running it
+func (s *Scheduler) RunOnce(ctx context.Context, job Job) {
+	acquired, err := s.locker.WithLock(ctx, job.Name, job.Run)
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.Name, err)
+		return
+	}
+	if !acquired {
+		log.Printf("Job %s skipped: already running on another instance", job.Name)
+	}
+}
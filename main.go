@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"invitified-go/config"
 	_ "invitified-go/docs"
+	"invitified-go/jobs"
 	"invitified-go/routes"
 	"log"
 	"os"
@@ -42,6 +44,9 @@ func main() {
 	// Initialize routes
 	routes.InitRoutes(e)
 
+	// Start background jobs
+	jobs.InitJobs(context.Background())
+
 	// Swagger
 	// Swagger
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the client's key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a stored key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency replays the stored response when a user repeats a request with
+// the same Idempotency-Key header. Requests without the header are passed
+// through. It must run after JWTMiddleware.
+func Idempotency(repo repositories.IdempotencyRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return c.JSON(http.StatusBadRequest, map[string]string{"message": "Idempotency-Key is too long"})
+			}
+
+			userIDStr, ok := c.Get("userID").(string)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+			}
+			userID, err := uuid.Parse(userIDStr)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID"})
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			record := &models.IdempotencyKey{
+				UserID:      userID,
+				Key:         key,
+				Method:      c.Request().Method,
+				Path:        c.Request().URL.Path,
+				RequestHash: requestHash(c.Request().Method, c.Request().URL.Path, body),
+			}
+			reserved, err := repo.Reserve(record)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to store idempotency key"})
+			}
+			if !reserved {
+				return replay(c, repo, record)
+			}
+
+			// Keep a copy of everything the handler writes
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			if err := next(c); err != nil {
+				releaseKey(repo, record.ID)
+				return err
+			}
+
+			// Server errors are not stored so the client can retry them
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				releaseKey(repo, record.ID)
+				return nil
+			}
+			if err := repo.Complete(record.ID, status, recorder.body.Bytes()); err != nil {
+				log.Printf("Failed to store response for idempotency key %s: %v", record.ID, err)
+			}
+			return nil
+		}
+	}
+}
+
+// replay answers a repeated request from the stored response of the first one
+func replay(c echo.Context, repo repositories.IdempotencyRepository, record *models.IdempotencyKey) error {
+	stored, err := repo.Find(record.UserID, record.Key)
+	if err != nil {
+		// The first request failed and released the key in the meantime
+		return c.JSON(http.StatusConflict, map[string]string{"message": "Request with this Idempotency-Key failed, please retry"})
+	}
+	if stored.RequestHash != record.RequestHash {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"message": "Idempotency-Key was already used for a different request"})
+	}
+	if stored.CompletedAt == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"message": "A request with this Idempotency-Key is still being processed"})
+	}
+
+	c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	return c.Blob(stored.StatusCode, echo.MIMEApplicationJSONCharsetUTF8, stored.ResponseBody)
+}
+
+func releaseKey(repo repositories.IdempotencyRepository, id uuid.UUID) {
+	if err := repo.Release(id); err != nil {
+		log.Printf("Failed to release idempotency key %s: %v", id, err)
+	}
+}
+
+// requestHash identifies a request so a key cannot be reused for another one
+func requestHash(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder writes the response through and keeps a copy of the body
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
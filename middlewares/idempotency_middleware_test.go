@@ -0,0 +1,147 @@
+package middlewares
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIdempotency(t *testing.T) {
+	e := echo.New()
+	mockRepo := new(repositories.MockIdempotencyRepository)
+	userID := uuid.New()
+	body := `{"rental_id":"1"}`
+	completedAt := time.Now()
+
+	tests := []struct {
+		name        string
+		key         string
+		body        string
+		handlerCode int
+		setupMocks  func()
+		wantCode    int
+		wantCalled  bool
+		wantBody    string
+		wantReplay  bool
+	}{
+		{
+			name:        "without key",
+			body:        body,
+			handlerCode: http.StatusCreated,
+			setupMocks:  func() {},
+			wantCode:    http.StatusCreated,
+			wantCalled:  true,
+		},
+		{
+			name:        "first request stores the response",
+			key:         "key-1",
+			body:        body,
+			handlerCode: http.StatusCreated,
+			setupMocks: func() {
+				mockRepo.On("Reserve", mock.AnythingOfType("*models.IdempotencyKey")).Return(true, nil)
+				mockRepo.On("Complete", mock.AnythingOfType("uuid.UUID"), http.StatusCreated, mock.MatchedBy(func(b []byte) bool {
+					return strings.Contains(string(b), `"handled":true`)
+				})).Return(nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantCalled: true,
+		},
+		{
+			name: "retry is replayed",
+			key:  "key-1",
+			body: body,
+			setupMocks: func() {
+				mockRepo.On("Reserve", mock.AnythingOfType("*models.IdempotencyKey")).Return(false, nil)
+				mockRepo.On("Find", userID, "key-1").Return(&models.IdempotencyKey{
+					RequestHash:  requestHash(http.MethodPost, "/payments", []byte(body)),
+					StatusCode:   http.StatusCreated,
+					ResponseBody: []byte(`{"stored":true}`),
+					CompletedAt:  &completedAt,
+				}, nil)
+			},
+			wantCode:   http.StatusCreated,
+			wantBody:   `{"stored":true}`,
+			wantReplay: true,
+		},
+		{
+			name: "key reused for another request",
+			key:  "key-1",
+			body: `{"rental_id":"2"}`,
+			setupMocks: func() {
+				mockRepo.On("Reserve", mock.AnythingOfType("*models.IdempotencyKey")).Return(false, nil)
+				mockRepo.On("Find", userID, "key-1").Return(&models.IdempotencyKey{
+					RequestHash: requestHash(http.MethodPost, "/payments", []byte(body)),
+					CompletedAt: &completedAt,
+				}, nil)
+			},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "first request still running",
+			key:  "key-1",
+			body: body,
+			setupMocks: func() {
+				mockRepo.On("Reserve", mock.AnythingOfType("*models.IdempotencyKey")).Return(false, nil)
+				mockRepo.On("Find", userID, "key-1").Return(&models.IdempotencyKey{
+					RequestHash: requestHash(http.MethodPost, "/payments", []byte(body)),
+				}, nil)
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:        "server error releases the key",
+			key:         "key-2",
+			body:        body,
+			handlerCode: http.StatusInternalServerError,
+			setupMocks: func() {
+				mockRepo.On("Reserve", mock.AnythingOfType("*models.IdempotencyKey")).Return(true, nil)
+				mockRepo.On("Release", mock.AnythingOfType("uuid.UUID")).Return(nil)
+			},
+			wantCode:   http.StatusInternalServerError,
+			wantCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			tt.setupMocks()
+
+			called := false
+			handler := Idempotency(mockRepo)(func(c echo.Context) error {
+				called = true
+				return c.JSON(tt.handlerCode, map[string]bool{"handled": true})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("userID", userID.String())
+
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantCalled, called)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+			if tt.wantReplay {
+				assert.Equal(t, "true", rec.Header().Get(IdempotentReplayedHeader))
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
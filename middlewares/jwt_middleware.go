@@ -1,13 +1,20 @@
 package middlewares
 
 import (
+	"errors"
 	"invitified-go/repositories"
 	"invitified-go/utils"
+	"log"
 	"net/http"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+// JWTMiddleware accepts access tokens that are signed, not expired and whose
+// session has not been logged out. It sets the userID and sessionID of the
+// token on the context.
 func JWTMiddleware(tokenRepo repositories.TokenRepository) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -17,12 +24,30 @@ func JWTMiddleware(tokenRepo repositories.TokenRepository) echo.MiddlewareFunc {
 			}
 
 			claims, err := utils.ValidateJWT(token)
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Token expired"})
+			}
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid token"})
+			}
+
+			// Tokens issued before sessions were introduced carry no session
+			sessionID, err := uuid.Parse(claims.SessionID)
 			if err != nil {
 				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid token"})
 			}
+			active, err := tokenRepo.IsSessionActive(sessionID)
+			if err != nil {
+				log.Printf("Failed to check session %s: %v", sessionID, err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to check token"})
+			}
+			if !active {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Token has been revoked"})
+			}
 
 			userID := claims.UserID
 			c.Set("userID", userID)
+			c.Set("sessionID", claims.SessionID)
 
 			return next(c)
 		}
@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTMiddleware(t *testing.T) {
+	e := echo.New()
+	mockRepo := new(repositories.MockTokenRepository)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token := func(expiresAt time.Time) string {
+		signed, err := utils.GenerateJWT(userID, sessionID, expiresAt)
+		assert.NoError(t, err)
+		return signed
+	}
+	// Issued before access tokens belonged to a session
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{
+		UserID:           userID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		token       string
+		setupMocks  func()
+		wantCode    int
+		wantMessage string
+	}{
+		{
+			name:  "active session",
+			token: token(time.Now().Add(time.Minute)),
+			setupMocks: func() {
+				mockRepo.On("IsSessionActive", sessionID).Return(true, nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "logged out",
+			token: token(time.Now().Add(time.Minute)),
+			setupMocks: func() {
+				mockRepo.On("IsSessionActive", sessionID).Return(false, nil)
+			},
+			wantCode:    http.StatusUnauthorized,
+			wantMessage: "Token has been revoked",
+		},
+		{
+			name:        "expired",
+			token:       token(time.Now().Add(-time.Minute)),
+			setupMocks:  func() {},
+			wantCode:    http.StatusUnauthorized,
+			wantMessage: "Token expired",
+		},
+		{
+			name:        "without session",
+			token:       legacy,
+			setupMocks:  func() {},
+			wantCode:    http.StatusUnauthorized,
+			wantMessage: "Invalid token",
+		},
+		{
+			name:        "missing",
+			setupMocks:  func() {},
+			wantCode:    http.StatusUnauthorized,
+			wantMessage: "Missing token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			tt.setupMocks()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			handler := JWTMiddleware(mockRepo)(func(c echo.Context) error {
+				assert.Equal(t, userID.String(), c.Get("userID"))
+				assert.Equal(t, sessionID.String(), c.Get("sessionID"))
+				return c.NoContent(http.StatusOK)
+			})
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.wantCode, rec.Code)
+
+			if tt.wantMessage != "" {
+				var response map[string]string
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.Equal(t, tt.wantMessage, response["message"])
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
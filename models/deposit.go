@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DepositEntry is an entry in the append-only ledger of security deposits.
+// Amounts are in the settlement currency, positive when a deposit is
+// collected and negative when it is released or retained.
+type DepositEntry struct {
+	ID           uuid.UUID  `json:"id" gorm:"column:deposit_entry_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	RentalID     uuid.UUID  `json:"rental_id" gorm:"type:uuid;not null"`
+	PaymentID    uuid.UUID  `json:"payment_id" gorm:"type:uuid;not null"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	Type         string     `json:"type" gorm:"type:varchar(20);not null"`
+	Amount       Money      `json:"amount" gorm:"not null"`
+	BalanceAfter Money      `json:"balance_after" gorm:"not null"`
+	Currency     Currency   `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
+	Reason       string     `json:"reason" gorm:"type:varchar(255)"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" gorm:"type:uuid"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+const (
+	// DepositEntryHold records a deposit collected with the rental payment
+	DepositEntryHold = "HOLD"
+	// DepositEntryRelease records deposit money given back to the customer
+	DepositEntryRelease = "RELEASE"
+	// DepositEntryRetain records deposit money kept for damage
+	DepositEntryRetain = "RETAIN"
+)
+
+const (
+	DepositStatusNone              = "NONE"
+	DepositStatusPending           = "PENDING"
+	DepositStatusHeld              = "HELD"
+	DepositStatusReleased          = "RELEASED"
+	DepositStatusPartiallyRetained = "PARTIALLY_RETAINED"
+	DepositStatusRetained          = "RETAINED"
+)
+
+// DepositSummary is the state of a rental's security deposit. Required is in
+// the currency of the rental, the other amounts in the settlement currency.
+type DepositSummary struct {
+	RentalID uuid.UUID      `json:"rental_id"`
+	Status   string         `json:"status"`
+	Required Money          `json:"required"`
+	Currency Currency       `json:"currency"`
+	Held     Money          `json:"held"`
+	Released Money          `json:"released"`
+	Retained Money          `json:"retained"`
+	Entries  []DepositEntry `json:"entries"`
+}
+
+// NewDepositSummary adds up the deposit ledger entries of a rental
+func NewDepositSummary(rental *Rental, entries []DepositEntry) DepositSummary {
+	summary := DepositSummary{
+		RentalID: rental.ID,
+		Required: rental.DepositAmount,
+		Currency: rental.Currency.OrDefault(),
+		Entries:  entries,
+	}
+	var collected Money
+	for _, entry := range entries {
+		switch entry.Type {
+		case DepositEntryHold:
+			collected += entry.Amount
+		case DepositEntryRelease:
+			summary.Released -= entry.Amount
+		case DepositEntryRetain:
+			summary.Retained -= entry.Amount
+		}
+	}
+	summary.Held = collected - summary.Released - summary.Retained
+
+	switch {
+	case collected == 0 && rental.DepositAmount == 0:
+		summary.Status = DepositStatusNone
+	case collected == 0:
+		summary.Status = DepositStatusPending
+	case summary.Held > 0:
+		summary.Status = DepositStatusHeld
+	case summary.Retained == 0:
+		summary.Status = DepositStatusReleased
+	case summary.Released == 0:
+		summary.Status = DepositStatusRetained
+	default:
+		summary.Status = DepositStatusPartiallyRetained
+	}
+	return summary
+}
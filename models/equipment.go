@@ -12,6 +12,20 @@ type EquipmentCategory struct {
 	Slug        string    `json:"slug" gorm:"unique;not null"`
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Pricing defaults for equipment in the category. Rate factors are
+	// multiples of the equipment's daily rental price, zero means unset.
+	WeekendRateFactor float64 `json:"weekend_rate_factor" gorm:"default:0"`
+	WeeklyRateFactor  float64 `json:"weekly_rate_factor" gorm:"default:0"`
+	MonthlyRateFactor float64 `json:"monthly_rate_factor" gorm:"default:0"`
+	MinRentalDays     int     `json:"min_rental_days" gorm:"default:0"`
+
+	// TaxExempt equipment is rented without sales tax
+	TaxExempt bool `json:"tax_exempt" gorm:"default:false"`
+
+	// DepositAmount is the refundable security deposit per unit of equipment
+	// in the category, in the currency of the equipment's prices
+	DepositAmount Money `json:"deposit_amount" gorm:"default:0"`
 }
 
 type Equipment struct {
@@ -19,9 +33,23 @@ type Equipment struct {
 	Name          string    `json:"name" gorm:"not null"`
 	Slug          string    `json:"slug" gorm:"unique;not null"`
 	StockQuantity int       `json:"stock_quantity" gorm:"not null;default:0"`
-	RentalPrice   float64   `json:"rental_price" gorm:"not null"`
+	RentalPrice   Money     `json:"rental_price" gorm:"not null"`
 	CategoryID    uuid.UUID `json:"category_id" gorm:"type:uuid"`
 	IsAvailable   bool      `json:"is_available" gorm:"default:true"`
 	CreatedBy     uuid.UUID `json:"created_by" gorm:"type:uuid"`
 	CreatedAt     time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Optional rates overriding the category defaults, zero means unset.
+	// RentalPrice is the daily rate.
+	WeekendRate   Money `json:"weekend_rate" gorm:"default:0"`
+	WeeklyRate    Money `json:"weekly_rate" gorm:"default:0"`
+	MonthlyRate   Money `json:"monthly_rate" gorm:"default:0"`
+	MinRentalDays int   `json:"min_rental_days" gorm:"default:0"`
+
+	// Currency the rates above are set in
+	Currency Currency `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
+
+	// DepositAmount is the refundable security deposit per unit, overriding
+	// the category's. Zero means unset.
+	DepositAmount Money `json:"deposit_amount" gorm:"default:0"`
 }
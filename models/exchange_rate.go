@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExchangeRate is the value of one unit of a currency in the settlement
+// currency, DefaultCurrency, from EffectiveFrom until the next rate of the
+// currency takes effect.
+type ExchangeRate struct {
+	ID            uuid.UUID `json:"id" gorm:"column:exchange_rate_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	Currency      Currency  `json:"currency" gorm:"type:varchar(3);not null"`
+	Rate          float64   `json:"rate" gorm:"type:decimal(18,8);not null"`
+	EffectiveFrom time.Time `json:"effective_from" gorm:"not null"`
+	CreatedBy     uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt     time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
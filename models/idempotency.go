@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey stores the first response to a request sent with an
+// Idempotency-Key header so retries of the same request can be replayed.
+type IdempotencyKey struct {
+	ID           uuid.UUID  `json:"id" gorm:"column:idempotency_key_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key"`
+	Key          string     `json:"key" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key"`
+	Method       string     `json:"method" gorm:"type:varchar(10);not null"`
+	Path         string     `json:"path" gorm:"type:varchar(255);not null"`
+	RequestHash  string     `json:"request_hash" gorm:"type:varchar(64);not null"`
+	StatusCode   int        `json:"status_code"`
+	ResponseBody []byte     `json:"-" gorm:"type:bytea"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
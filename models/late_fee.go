@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LateFee is the charge for returning a rental after its end date. It grows
+// by DailyFee for every day the equipment is late while the rental is
+// overdue. Amounts are in the settlement currency.
+type LateFee struct {
+	ID         uuid.UUID `json:"id" gorm:"column:late_fee_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	RentalID   uuid.UUID `json:"rental_id" gorm:"type:uuid;not null;unique"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	Status     string    `json:"status" gorm:"type:varchar(20);default:'ACCRUING'"`
+	DaysLate   int       `json:"days_late" gorm:"not null"`
+	DailyFee   Money     `json:"daily_fee" gorm:"not null"`
+	Amount     Money     `json:"amount" gorm:"not null"`
+	PaidAmount Money     `json:"paid_amount" gorm:"default:0"`
+	Currency   Currency  `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// A waived fee is no longer charged. The admin who waived it and why are
+	// kept for auditing.
+	WaivedAmount Money      `json:"waived_amount" gorm:"default:0"`
+	WaivedBy     *uuid.UUID `json:"waived_by,omitempty" gorm:"type:uuid"`
+	WaivedAt     *time.Time `json:"waived_at,omitempty"`
+	WaiveReason  string     `json:"waive_reason,omitempty" gorm:"type:text"`
+}
+
+const (
+	// LateFeeStatusAccruing is the status while the equipment is still out
+	LateFeeStatusAccruing = "ACCRUING"
+	// LateFeeStatusDue is the status of an unpaid fee once the equipment is back
+	LateFeeStatusDue    = "DUE"
+	LateFeeStatusPaid   = "PAID"
+	LateFeeStatusWaived = "WAIVED"
+)
+
+// Outstanding is the part of the fee that is neither paid nor waived
+func (f *LateFee) Outstanding() Money {
+	outstanding := f.Amount - f.PaidAmount - f.WaivedAmount
+	if outstanding < 0 {
+		return 0
+	}
+	return outstanding
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoyaltyPoints is the points balance of a user. It always equals the sum of
+// the user's points transactions.
+type LoyaltyPoints struct {
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primary_key"`
+	Points    int       `json:"points" gorm:"default:0"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// PointsTransaction is an entry in the append-only points ledger. Points are
+// positive when credited and negative when debited.
+type PointsTransaction struct {
+	ID           uuid.UUID  `json:"id" gorm:"column:points_transaction_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	Type         string     `json:"type" gorm:"type:varchar(20);not null"`
+	Points       int        `json:"points" gorm:"not null"`
+	BalanceAfter int        `json:"balance_after" gorm:"not null"`
+	PaymentID    *uuid.UUID `json:"payment_id,omitempty" gorm:"type:uuid"`
+	RefundID     *uuid.UUID `json:"refund_id,omitempty" gorm:"type:uuid"`
+	Description  string     `json:"description" gorm:"type:varchar(255)"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+const (
+	// PointsTypeEarn credits points for a completed payment
+	PointsTypeEarn = "EARN"
+	// PointsTypeRedeem debits points spent on a payment
+	PointsTypeRedeem = "REDEEM"
+	// PointsTypeRelease credits back points of a payment that was never paid
+	PointsTypeRelease = "RELEASE"
+	// PointsTypeRefund credits back points spent on a refunded payment
+	PointsTypeRefund = "REFUND"
+	// PointsTypeClawback debits points earned on a refunded payment
+	PointsTypeClawback = "CLAWBACK"
+)
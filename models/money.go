@@ -0,0 +1,244 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in hundredths of a currency unit, the precision of
+// the DECIMAL(10,2) columns it is stored in. Use Round to bring an amount to
+// the precision its currency is charged in.
+type Money int64
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+const (
+	CurrencyIDR Currency = "IDR"
+	CurrencyUSD Currency = "USD"
+	CurrencySGD Currency = "SGD"
+)
+
+// DefaultCurrency is the currency prices are charged in
+const DefaultCurrency = CurrencyIDR
+
+// ErrInvalidMoney is returned when an amount cannot be parsed
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// OrDefault returns the currency code in upper case, or DefaultCurrency for
+// records saved before they had a currency
+func (c Currency) OrDefault() Currency {
+	if c == "" {
+		return DefaultCurrency
+	}
+	return Currency(strings.ToUpper(string(c)))
+}
+
+// Decimals is the number of decimal places amounts in the currency are
+// charged with. The rupiah has no minor unit in use.
+func (c Currency) Decimals() int {
+	switch c.OrDefault() {
+	case CurrencyIDR, "JPY", "KRW", "VND":
+		return 0
+	}
+	return 2
+}
+
+// NewMoney converts an amount in currency units, rounding to hundredths
+func NewMoney(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// ParseMoney reads a decimal amount such as "150000" or "12.50" exactly.
+// Digits past the hundredths are rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" {
+		return 0, ErrInvalidMoney
+	}
+	if strings.ContainsAny(digits, "eE") {
+		// Exponent notation from JSON encoders, precise enough for prices
+		amount, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, ErrInvalidMoney
+		}
+		return NewMoney(amount), nil
+	}
+
+	var units int64
+	if whole != "" {
+		parsed, err := strconv.ParseUint(whole, 10, 63)
+		if err != nil {
+			return 0, ErrInvalidMoney
+		}
+		units = int64(parsed)
+	}
+	var hundredths int64
+	for i, r := range fraction {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidMoney
+		}
+		switch i {
+		case 0:
+			hundredths += int64(r-'0') * 10
+		case 1:
+			hundredths += int64(r - '0')
+		case 2:
+			if r >= '5' {
+				hundredths++
+			}
+		}
+	}
+	if units > (math.MaxInt64-hundredths)/100 {
+		return 0, ErrInvalidMoney
+	}
+
+	m := Money(units*100 + hundredths)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Float64 returns the amount in currency units, for APIs that take numbers
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul multiplies the amount by a rate or quantity, rounding to hundredths
+func (m Money) Mul(factor float64) Money {
+	return Money(math.Round(float64(m) * factor))
+}
+
+// Prorate returns the share part/whole of the amount, rounded to hundredths.
+// It returns zero when whole is not positive.
+func (m Money) Prorate(part, whole Money) Money {
+	if whole <= 0 {
+		return 0
+	}
+	return Money(math.Round(float64(m) * float64(part) / float64(whole)))
+}
+
+// Convert converts the amount at rate units of the target currency per unit,
+// rounded to the precision of the target currency
+func (m Money) Convert(rate float64, to Currency) Money {
+	return m.Mul(rate).Round(to)
+}
+
+// Round rounds the amount half away from zero to the precision the currency
+// is charged in, so that totals match what the payment gateway charges
+func (m Money) Round(currency Currency) Money {
+	unit := Money(1)
+	for i := currency.Decimals(); i < 2; i++ {
+		unit *= 10
+	}
+	if unit == 1 {
+		return m
+	}
+	if m < 0 {
+		return -(-m).Round(currency)
+	}
+	return (m + unit/2) / unit * unit
+}
+
+// String formats the amount with two decimals, such as "150000.00"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// Format formats the amount for customers in the precision of the currency,
+// such as "IDR 150,000" or "USD 12.50"
+func (m Money) Format(currency Currency) string {
+	m = m.Round(currency)
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+
+	whole := strconv.FormatInt(int64(m/100), 10)
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(r)
+	}
+	if currency.Decimals() > 0 {
+		fmt.Fprintf(&grouped, ".%02d", m%100)
+	}
+	return fmt.Sprintf("%s %s%s", currency.OrDefault(), sign, grouped.String())
+}
+
+// MarshalJSON writes the amount as a JSON number without trailing zeros
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := strings.TrimSuffix(strings.TrimRight(m.String(), "0"), ".")
+	if s == "" || s == "-" {
+		s = "0"
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalJSON reads the amount from a JSON number or string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		return nil
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalParam reads the amount from a form or query parameter
+func (m *Money) UnmarshalParam(param string) error {
+	parsed, err := ParseMoney(param)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as an exact decimal
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads the amount from a DECIMAL column
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case float64:
+		*m = NewMoney(v)
+	case int64:
+		*m = Money(v * 100)
+	default:
+		return fmt.Errorf("unsupported type %T for Money", value)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "150000", want: 15000000},
+		{input: "12.5", want: 1250},
+		{input: "0.1", want: 10},
+		{input: "-3.05", want: -305},
+		{input: "2.345", want: 235},
+		{input: "1e3", want: 100000},
+		{input: "", wantErr: true},
+		{input: "1.2.3", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMoney)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoney_Round(t *testing.T) {
+	assert.Equal(t, NewMoney(9910), NewMoney(9909.91).Round(CurrencyIDR))
+	assert.Equal(t, NewMoney(9909), NewMoney(9909.49).Round(CurrencyIDR))
+	assert.Equal(t, NewMoney(-10), NewMoney(-9.5).Round(CurrencyIDR))
+	assert.Equal(t, NewMoney(9909.91), NewMoney(9909.91).Round(CurrencyUSD))
+}
+
+func TestMoney_Format(t *testing.T) {
+	assert.Equal(t, "IDR 1,500,000", NewMoney(1499999.5).Format(CurrencyIDR))
+	assert.Equal(t, "IDR 0", Money(0).Format(CurrencyIDR))
+	assert.Equal(t, "USD -12.50", NewMoney(-12.5).Format(CurrencyUSD))
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var payload struct {
+		Amount Money `json:"amount"`
+		Price  Money `json:"price"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 0.1, "price": "250000"}`), &payload))
+	assert.Equal(t, Money(10), payload.Amount)
+	assert.Equal(t, NewMoney(250000), payload.Price)
+
+	data, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 0.1, "price": 250000}`, string(data))
+}
@@ -9,18 +9,111 @@ import (
 type Payment struct {
 	ID                   uuid.UUID  `json:"id" gorm:"column:payment_id;type:uuid;primary_key;default:gen_random_uuid()"`
 	RentalID             uuid.UUID  `json:"rental_id" gorm:"type:uuid;not null"`
+	ExtensionID          *uuid.UUID `json:"extension_id" gorm:"type:uuid"`
 	UserID               uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
-	Amount               float64    `json:"amount" gorm:"not null"`
+	Amount               Money      `json:"amount" gorm:"not null"` // Subtotal plus TaxAmount plus DepositAmount
+	Subtotal             Money      `json:"subtotal" gorm:"default:0"`
+	TaxAmount            Money      `json:"tax_amount" gorm:"default:0"`
+	Currency             Currency   `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
 	PointsUsed           int        `json:"points_used" gorm:"default:0"`
 	PointsEarned         int        `json:"points_earned" gorm:"default:0"`
 	PaymentMethod        string     `json:"payment_method" gorm:"type:varchar(50);not null"`
 	PaymentStatus        string     `json:"payment_status" gorm:"type:varchar(20);default:'PENDING'"`
 	XenditInvoiceID      string     `json:"xendit_invoice_id" gorm:"type:varchar(100)"`
+	XenditExternalID     string     `json:"xendit_external_id" gorm:"type:varchar(100)"`
+	XenditPaymentID      string     `json:"xendit_payment_id" gorm:"type:varchar(100)"`
 	XenditPaymentURL     string     `json:"xendit_payment_url" gorm:"type:varchar(255)"`
 	XenditPaymentChannel string     `json:"xendit_payment_channel" gorm:"type:varchar(50)"`
-	XenditPaidAmount     float64    `json:"xendit_paid_amount"`
+	XenditPaidAmount     Money      `json:"xendit_paid_amount"`
+	RefundedAmount       Money      `json:"refunded_amount" gorm:"default:0"`
+	AccountNumber        string     `json:"account_number" gorm:"type:varchar(50)"`
+	QRString             string     `json:"qr_string" gorm:"type:text"`
+	CheckoutURL          string     `json:"checkout_url" gorm:"type:varchar(512)"`
+	MobileCheckoutURL    string     `json:"mobile_checkout_url" gorm:"type:varchar(512)"`
+	DeeplinkURL          string     `json:"deeplink_url" gorm:"type:varchar(512)"`
 	PaidAt               *time.Time `json:"paid_at"`
 	ExpiredAt            *time.Time `json:"expired_at"`
 	CreatedAt            time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt            time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Amount and Currency are what the gateway charges. OriginalAmount is
+	// the same amount in OriginalCurrency, the currency of the rental.
+	OriginalAmount   Money    `json:"original_amount" gorm:"default:0"`
+	OriginalCurrency Currency `json:"original_currency" gorm:"type:varchar(3);default:'IDR'"`
+
+	// DepositAmount is the security deposit collected with the payment. It
+	// carries no tax and earns no points.
+	DepositAmount Money `json:"deposit_amount" gorm:"default:0"`
+
+	// LateFeeID is set on payments of a late fee instead of the rental
+	LateFeeID *uuid.UUID `json:"late_fee_id,omitempty" gorm:"type:uuid"`
+}
+
+const (
+	PaymentMethodVirtualAccount = "VIRTUAL_ACCOUNT"
+	PaymentMethodQRCode         = "QR_CODE"
+	PaymentMethodEWallet        = "EWALLET"
+)
+
+const (
+	PaymentStatusPending   = "PENDING"
+	PaymentStatusCompleted = "COMPLETED"
+	PaymentStatusExpired   = "EXPIRED"
+	PaymentStatusFailed    = "FAILED"
+
+	// PaymentStatusRefundPending marks a completed payment whose rental was
+	// cancelled and that is waiting to be refunded.
+	PaymentStatusRefundPending = "REFUND_PENDING"
+
+	PaymentStatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+	PaymentStatusRefunded          = "REFUNDED"
+
+	// PaymentStatusUnderpaid marks a payment the gateway received less than
+	// the amount due for. The money is recorded but the rental is not
+	// settled until an admin reviews it.
+	PaymentStatusUnderpaid = "UNDERPAID"
+)
+
+// PaymentRefundableStatuses are the statuses of payments that hold money
+// which can still be refunded
+var PaymentRefundableStatuses = []string{
+	PaymentStatusCompleted,
+	PaymentStatusRefundPending,
+	PaymentStatusPartiallyRefunded,
+}
+
+// PaidAmount is the amount the customer actually paid. It falls back to the
+// amount due for payments recorded without a paid amount.
+func (p *Payment) PaidAmount() Money {
+	if p.XenditPaidAmount > 0 {
+		return p.XenditPaidAmount
+	}
+	return p.Amount
+}
+
+// PaymentInstructions tells the customer how to pay. Only the fields of the
+// payment method are set.
+type PaymentInstructions struct {
+	Method            string `json:"method"`
+	ChannelCode       string `json:"channel_code"`
+	Amount            Money  `json:"amount"`
+	AccountNumber     string `json:"account_number,omitempty"`
+	QRString          string `json:"qr_string,omitempty"`
+	CheckoutURL       string `json:"checkout_url,omitempty"`
+	MobileCheckoutURL string `json:"mobile_checkout_url,omitempty"`
+	DeeplinkURL       string `json:"deeplink_url,omitempty"`
+}
+
+// Instructions returns the method specific payment details of the payment
+func (p *Payment) Instructions() PaymentInstructions {
+	return PaymentInstructions{
+		Method:            p.PaymentMethod,
+		ChannelCode:       p.XenditPaymentChannel,
+		Amount:            p.Amount,
+		AccountNumber:     p.AccountNumber,
+		QRString:          p.QRString,
+		CheckoutURL:       p.CheckoutURL,
+		MobileCheckoutURL: p.MobileCheckoutURL,
+		DeeplinkURL:       p.DeeplinkURL,
+	}
 }
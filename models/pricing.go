@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// PriceComponent is one part of a line's price, such as "2 weeks"
+type PriceComponent struct {
+	Label     string `json:"label"`
+	Units     int    `json:"units"`
+	UnitPrice Money  `json:"unit_price"`
+	Amount    Money  `json:"amount"`
+}
+
+// PriceLine is the price of one rental item for the whole rental period
+type PriceLine struct {
+	EquipmentID   uuid.UUID        `json:"equipment_id"`
+	EquipmentName string           `json:"equipment_name"`
+	Quantity      int              `json:"quantity"`
+	Days          int              `json:"days"`
+	UnitPrice     Money            `json:"unit_price"`
+	Components    []PriceComponent `json:"components"`
+	LineTotal     Money            `json:"line_total"`
+	// TaxExempt is set for equipment in a tax exempt category
+	TaxExempt bool `json:"tax_exempt,omitempty"`
+	// Deposit is the security deposit for all units of the line
+	Deposit Money `json:"deposit,omitempty"`
+}
+
+// PriceBreakdown is the itemized price of a rental. Total is the subtotal
+// less discounts, plus tax unless TaxInclusive is set and the line prices
+// already contain it. The deposit is held separately and not included.
+type PriceBreakdown struct {
+	Lines    []PriceLine `json:"lines"`
+	Subtotal Money       `json:"subtotal"`
+	Discount Money       `json:"discount"`
+	Tax      Money       `json:"tax"`
+	Deposit  Money       `json:"deposit"`
+	Total    Money       `json:"total"`
+
+	// PromotionID and PromoCode name the promotion behind the discount
+	PromotionID *uuid.UUID `json:"promotion_id,omitempty"`
+	PromoCode   string     `json:"promo_code,omitempty"`
+
+	// TaxName, TaxRate and TaxInclusive describe the tax that was applied
+	TaxName      string  `json:"tax_name,omitempty"`
+	TaxRate      float64 `json:"tax_rate"`
+	TaxInclusive bool    `json:"tax_inclusive"`
+
+	// Currency the amounts are in. ExchangeRate is the value of one unit of
+	// it in DefaultCurrency at the time of pricing.
+	Currency     Currency `json:"currency,omitempty"`
+	ExchangeRate float64  `json:"exchange_rate,omitempty"`
+}
+
+// FromDefaultCurrency converts an amount in DefaultCurrency, such as the
+// limits of a promotion, into the currency of the breakdown
+func (b *PriceBreakdown) FromDefaultCurrency(amount Money) Money {
+	if b.Currency.OrDefault() == DefaultCurrency || b.ExchangeRate <= 0 {
+		return amount
+	}
+	return amount.Convert(1/b.ExchangeRate, b.Currency)
+}
+
+// Value stores the breakdown as JSON
+func (b PriceBreakdown) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+// Scan reads the breakdown from a JSON column
+func (b *PriceBreakdown) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*b = PriceBreakdown{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, b)
+	case string:
+		return json.Unmarshal([]byte(v), b)
+	default:
+		return errors.New("unsupported type for PriceBreakdown")
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Promotion is a promo code customers enter at checkout for a discount.
+// CategoryID and EquipmentID limit the discount to matching items, zero
+// limits mean no limit.
+type Promotion struct {
+	ID             uuid.UUID  `json:"id" gorm:"column:promotion_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	Code           string     `json:"code" gorm:"type:varchar(50);unique;not null"`
+	Description    string     `json:"description" gorm:"type:varchar(255)"`
+	DiscountType   string     `json:"discount_type" gorm:"type:varchar(20);not null"`
+	DiscountValue  float64    `json:"discount_value" gorm:"not null"`
+	MaxDiscount    Money      `json:"max_discount" gorm:"default:0"`
+	MinOrderAmount Money      `json:"min_order_amount" gorm:"default:0"`
+	CategoryID     *uuid.UUID `json:"category_id" gorm:"type:uuid"`
+	EquipmentID    *uuid.UUID `json:"equipment_id" gorm:"type:uuid"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	UsageLimit     int        `json:"usage_limit" gorm:"default:0"`
+	PerUserLimit   int        `json:"per_user_limit" gorm:"default:0"`
+	IsActive       bool       `json:"is_active" gorm:"default:true"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+const (
+	// DiscountTypePercentage takes DiscountValue percent off, capped at
+	// MaxDiscount when set
+	DiscountTypePercentage = "PERCENTAGE"
+	// DiscountTypeFixed takes DiscountValue off
+	DiscountTypeFixed = "FIXED"
+)
+
+// PromotionRedemption records a promotion used on a rental. Redemptions of
+// cancelled and expired rentals do not count against the usage limits.
+type PromotionRedemption struct {
+	ID          uuid.UUID `json:"id" gorm:"column:promotion_redemption_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	PromotionID uuid.UUID `json:"promotion_id" gorm:"type:uuid;not null"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	RentalID    uuid.UUID `json:"rental_id" gorm:"type:uuid;not null"`
+	Amount      Money     `json:"amount" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
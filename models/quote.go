@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quote is a saved rental price that can be booked at that price until it
+// expires.
+type Quote struct {
+	ID             uuid.UUID       `json:"id" gorm:"column:quote_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID         uuid.UUID       `json:"user_id" gorm:"type:uuid;not null"`
+	CreatedBy      uuid.UUID       `json:"created_by" gorm:"type:uuid;not null"`
+	StartDate      time.Time       `json:"start_date" gorm:"not null"`
+	EndDate        time.Time       `json:"end_date" gorm:"not null"`
+	TotalCost      Money           `json:"total_cost" gorm:"not null"`
+	Currency       Currency        `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
+	PriceBreakdown *PriceBreakdown `json:"price_breakdown" gorm:"type:jsonb"`
+	Status         string          `json:"status" gorm:"type:varchar(20);default:'ACTIVE'"`
+	RentalID       *uuid.UUID      `json:"rental_id" gorm:"type:uuid"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+const (
+	QuoteStatusActive = "ACTIVE"
+	QuoteStatusBooked = "BOOKED"
+)
+
+// RentalItems returns the quoted items in the form used to book a rental
+func (q *Quote) RentalItems() []RentalItem {
+	if q.PriceBreakdown == nil {
+		return nil
+	}
+	items := make([]RentalItem, len(q.PriceBreakdown.Lines))
+	for i, line := range q.PriceBreakdown.Lines {
+		items[i] = RentalItem{
+			EquipmentID:   line.EquipmentID,
+			Quantity:      line.Quantity,
+			EquipmentName: line.EquipmentName,
+		}
+	}
+	return items
+}
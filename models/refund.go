@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refund returns all or part of a payment to the customer
+type Refund struct {
+	ID             uuid.UUID  `json:"id" gorm:"column:refund_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	PaymentID      uuid.UUID  `json:"payment_id" gorm:"type:uuid;not null"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	RequestedBy    uuid.UUID  `json:"requested_by" gorm:"type:uuid;not null"`
+	Amount         Money      `json:"amount" gorm:"not null"`
+	PointsReturned int        `json:"points_returned" gorm:"default:0"`
+	PointsClawback int        `json:"points_clawback" gorm:"default:0"`
+	Reason         string     `json:"reason" gorm:"type:varchar(255)"`
+	Status         string     `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	XenditRefundID string     `json:"xendit_refund_id" gorm:"type:varchar(100)"`
+	FailureCode    string     `json:"failure_code,omitempty" gorm:"type:varchar(100)"`
+	RefundedAt     *time.Time `json:"refunded_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// Deposit refunds give back a security deposit and leave the points of
+	// the payment alone
+	Deposit bool `json:"deposit" gorm:"default:false"`
+}
+
+const (
+	RefundStatusPending   = "PENDING"
+	RefundStatusSucceeded = "SUCCEEDED"
+	RefundStatusFailed    = "FAILED"
+)
@@ -11,21 +11,179 @@ type Rental struct {
 	UserID    uuid.UUID    `json:"user_id" gorm:"type:uuid;not null"`
 	StartDate time.Time    `json:"start_date" gorm:"not null"`
 	EndDate   time.Time    `json:"end_date" gorm:"not null"`
-	TotalCost float64      `json:"total_cost" gorm:"not null"`
+	TotalCost Money        `json:"total_cost" gorm:"not null"`
 	Status    string       `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
 	Items     []RentalItem `json:"items" gorm:"foreignKey:RentalID"`
+
+	// TotalCost is Subtotal plus TaxAmount. Subtotal is the price after
+	// discounts without tax.
+	Subtotal  Money `json:"subtotal" gorm:"default:0"`
+	TaxAmount Money `json:"tax_amount" gorm:"default:0"`
+
+	// Currency the rental is priced in. ExchangeRate is the value of one
+	// unit of it in DefaultCurrency when the rental was booked, payments
+	// are settled at that rate.
+	Currency     Currency `json:"currency" gorm:"type:varchar(3);default:'IDR'"`
+	ExchangeRate float64  `json:"exchange_rate" gorm:"type:decimal(18,8);default:1"`
+
+	// DepositAmount is the refundable security deposit collected with the
+	// rental payment on top of TotalCost
+	DepositAmount Money `json:"deposit_amount" gorm:"default:0"`
+
+	PriceBreakdown *PriceBreakdown `json:"price_breakdown,omitempty" gorm:"type:jsonb"`
+	// PromoCode is entered by the customer, the discount it gave is stored
+	// with it
+	PromoCode      string `json:"promo_code" gorm:"type:varchar(50)"`
+	DiscountAmount Money  `json:"discount_amount" gorm:"default:0"`
+
+	PickedUpAt  *time.Time `json:"picked_up_at"`
+	ReturnedAt  *time.Time `json:"returned_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	CancelledAt  *time.Time `json:"cancelled_at"`
+	CancelReason string     `json:"cancel_reason" gorm:"type:text"`
+	// RefundAmount is given back in RefundCurrency, the currency the
+	// payments were charged in
+	RefundAmount   Money    `json:"refund_amount" gorm:"default:0"`
+	RefundCurrency Currency `json:"refund_currency" gorm:"type:varchar(3);default:'IDR'"`
 }
 
+// RentalItem is one line of a rental. The equipment name and price are copied
+// at booking time so later catalog changes do not alter past rentals.
 type RentalItem struct {
 	ID            uuid.UUID `json:"id" gorm:"column:rental_item_id;type:uuid;primary_key;default:gen_random_uuid()"`
 	RentalID      uuid.UUID `json:"rental_id" gorm:"type:uuid;not null"`
 	EquipmentID   uuid.UUID `json:"equipment_id" gorm:"type:uuid;not null"`
 	Quantity      int       `json:"quantity" gorm:"not null"`
-	EquipmentName string    `json:"equipment_name" gorm:"-"`
+	EquipmentName string    `json:"equipment_name" gorm:"type:varchar(100)"`
+	UnitPrice     Money     `json:"unit_price" gorm:"default:0"`
+	Days          int       `json:"days" gorm:"default:0"`
+	LineTotal     Money     `json:"line_total" gorm:"default:0"`
+}
+
+// SnapshotPrices copies the name and price of each line of the price
+// breakdown onto the matching item. Lines are in the same order as the items.
+func (r *Rental) SnapshotPrices() {
+	if r.PriceBreakdown == nil || len(r.PriceBreakdown.Lines) != len(r.Items) {
+		return
+	}
+	for i, line := range r.PriceBreakdown.Lines {
+		r.Items[i].EquipmentName = line.EquipmentName
+		r.Items[i].UnitPrice = line.UnitPrice
+		r.Items[i].Days = line.Days
+		r.Items[i].LineTotal = line.LineTotal
+	}
+}
+
+// SetPrice takes the rental's total, tax, deposit, discount, promo code and
+// currency from its price breakdown and keeps the breakdown with it
+func (r *Rental) SetPrice(breakdown *PriceBreakdown) {
+	r.PriceBreakdown = breakdown
+	r.Currency = breakdown.Currency.OrDefault()
+	r.ExchangeRate = breakdown.ExchangeRate
+	if r.ExchangeRate <= 0 {
+		r.ExchangeRate = 1
+	}
+	r.TotalCost = breakdown.Total
+	r.TaxAmount = breakdown.Tax
+	r.Subtotal = breakdown.Total - breakdown.Tax
+	r.DepositAmount = breakdown.Deposit
+	r.PromoCode = breakdown.PromoCode
+	r.DiscountAmount = breakdown.Discount
+}
+
+// TaxOn returns the part of an amount charged for the rental that is tax,
+// splitting it in the same proportion as the rental's total
+func (r *Rental) TaxOn(amount Money) Money {
+	if r.TaxAmount <= 0 {
+		return 0
+	}
+	return amount.Prorate(r.TaxAmount, r.TotalCost).Round(DefaultCurrency)
+}
+
+// SettlementAmount converts an amount in the rental's currency into
+// DefaultCurrency at the rate the rental was booked at
+func (r *Rental) SettlementAmount(amount Money) Money {
+	if r.Currency.OrDefault() == DefaultCurrency || r.ExchangeRate <= 0 {
+		return amount
+	}
+	return amount.Convert(r.ExchangeRate, DefaultCurrency)
+}
+
+// OriginalAmount converts a settlement amount back into the rental's currency
+func (r *Rental) OriginalAmount(settlement Money) Money {
+	if r.Currency.OrDefault() == DefaultCurrency || r.ExchangeRate <= 0 {
+		return settlement
+	}
+	return settlement.Convert(1/r.ExchangeRate, r.Currency)
+}
+
+const (
+	RentalStatusPending   = "PENDING"
+	RentalStatusPaid      = "PAID"
+	RentalStatusPickedUp  = "PICKED_UP"
+	RentalStatusReturned  = "RETURNED"
+	RentalStatusComplete  = "COMPLETED"
+	RentalStatusCancelled = "CANCELLED"
+	RentalStatusExpired   = "EXPIRED"
+	RentalStatusOverdue   = "OVERDUE"
+)
+
+// RentalExtension is a request to move a rental's end date that takes effect
+// once its payment succeeds.
+type RentalExtension struct {
+	ID         uuid.UUID `json:"id" gorm:"column:rental_extension_id;type:uuid;primary_key;default:gen_random_uuid()"`
+	RentalID   uuid.UUID `json:"rental_id" gorm:"type:uuid;not null"`
+	OldEndDate time.Time `json:"old_end_date" gorm:"not null"`
+	NewEndDate time.Time `json:"new_end_date" gorm:"not null"`
+	ExtraCost  Money     `json:"extra_cost" gorm:"not null"`
+	Status     string    `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+
+	// ExtraCost is ExtraSubtotal plus ExtraTax
+	ExtraSubtotal Money `json:"extra_subtotal" gorm:"default:0"`
+	ExtraTax      Money `json:"extra_tax" gorm:"default:0"`
 }
 
 const (
-	RentalStatusPending  = "PENDING"
-	RentalStatusPaid     = "PAID"
-	RentalStatusComplete = "COMPLETED"
+	ExtensionStatusPending = "PENDING"
+	ExtensionStatusApplied = "APPLIED"
+	ExtensionStatusExpired = "EXPIRED"
 )
+
+// RentalHoldingStatuses lists the rental statuses whose items count against
+// equipment stock. PENDING rentals hold their units until they are paid.
+var RentalHoldingStatuses = []string{
+	RentalStatusPending,
+	RentalStatusPaid,
+	RentalStatusPickedUp,
+	RentalStatusOverdue,
+}
+
+// RentalOutStatuses lists the statuses of rentals whose units are with the
+// customer. Past their end date they keep holding stock until returned.
+var RentalOutStatuses = []string{
+	RentalStatusPickedUp,
+	RentalStatusOverdue,
+}
+
+// rentalTransitions maps each status to the statuses a rental may move to
+var rentalTransitions = map[string][]string{
+	RentalStatusPending:  {RentalStatusPaid, RentalStatusCancelled, RentalStatusExpired},
+	RentalStatusPaid:     {RentalStatusPickedUp, RentalStatusCancelled},
+	RentalStatusPickedUp: {RentalStatusReturned, RentalStatusOverdue},
+	RentalStatusOverdue:  {RentalStatusReturned},
+	RentalStatusReturned: {RentalStatusComplete},
+}
+
+// CanTransitionTo reports whether the rental may move from its current status
+// to the given one.
+func (r *Rental) CanTransitionTo(status string) bool {
+	for _, next := range rentalTransitions[r.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
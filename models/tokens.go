@@ -6,6 +6,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// Tokens is a refresh token. Token holds the SHA-256 hash of the token given
+// to the client. Each refresh rotates the token into a new one of the same
+// family, the login session the access tokens are issued for.
 type Tokens struct {
 	ID        uuid.UUID `json:"id" gorm:"column:token_id;type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid"`
@@ -14,4 +17,10 @@ type Tokens struct {
 	IsValid   bool      `json:"is_valid" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	User      User      `json:"user" gorm:"foreignKey:UserID;references:ID"`
+
+	FamilyID uuid.UUID `json:"family_id" gorm:"type:uuid"`
+	// RotatedAt is set once the token was exchanged for a new one. Using it
+	// again means it was stolen and revokes its family.
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
 }
@@ -71,4 +71,304 @@ CREATE TABLE payments (
     payment_method VARCHAR(50) NOT NULL,
     payment_status VARCHAR(20) DEFAULT 'PENDING',
     payment_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+-- Rental lifecycle timestamps
+ALTER TABLE rentals
+    ADD COLUMN picked_up_at TIMESTAMP,
+    ADD COLUMN returned_at TIMESTAMP,
+    ADD COLUMN completed_at TIMESTAMP;
+
+-- Pending rental expiry
+ALTER TABLE rentals
+    ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+CREATE INDEX idx_rentals_status_created_at ON rentals (status, created_at);
+
+-- Rental cancellation
+ALTER TABLE rentals
+    ADD COLUMN cancelled_at TIMESTAMP,
+    ADD COLUMN cancel_reason TEXT,
+    ADD COLUMN refund_amount DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN refund_currency VARCHAR(3) DEFAULT 'IDR';
+
+-- Rental extensions
+CREATE TABLE rental_extensions (
+    rental_extension_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rental_id UUID NOT NULL REFERENCES rentals(rental_id),
+    old_end_date TIMESTAMP NOT NULL,
+    new_end_date TIMESTAMP NOT NULL,
+    extra_cost DECIMAL(10,2) NOT NULL,
+    status VARCHAR(20) DEFAULT 'PENDING',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE payments
+    ADD COLUMN extension_id UUID REFERENCES rental_extensions(rental_extension_id);
+
+-- Rental pricing
+ALTER TABLE equipment_categories
+    ADD COLUMN weekend_rate_factor DECIMAL(6,3) DEFAULT 0,
+    ADD COLUMN weekly_rate_factor DECIMAL(6,3) DEFAULT 0,
+    ADD COLUMN monthly_rate_factor DECIMAL(6,3) DEFAULT 0,
+    ADD COLUMN min_rental_days INTEGER DEFAULT 0;
+ALTER TABLE equipment
+    ADD COLUMN weekend_rate DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN weekly_rate DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN monthly_rate DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN min_rental_days INTEGER DEFAULT 0;
+ALTER TABLE rentals
+    ADD COLUMN price_breakdown JSONB;
+
+-- Rental quotes
+CREATE TABLE quotes (
+    quote_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    created_by UUID NOT NULL REFERENCES users(user_id),
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP NOT NULL,
+    total_cost DECIMAL(10,2) NOT NULL,
+    price_breakdown JSONB,
+    status VARCHAR(20) DEFAULT 'ACTIVE',
+    rental_id UUID REFERENCES rentals(rental_id),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Rental item price snapshots
+ALTER TABLE rental_items
+    ADD COLUMN equipment_name VARCHAR(100),
+    ADD COLUMN unit_price DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN days INTEGER DEFAULT 0,
+    ADD COLUMN line_total DECIMAL(10,2) DEFAULT 0;
+UPDATE rental_items
+SET equipment_name = equipment.name
+FROM equipment
+WHERE equipment.equipment_id = rental_items.equipment_id;
+
+-- Xendit payment callbacks
+ALTER TABLE payments
+    ADD COLUMN xendit_external_id VARCHAR(100) UNIQUE,
+    ADD COLUMN xendit_payment_id VARCHAR(100);
+
+-- QR code and e-wallet payments
+ALTER TABLE payments
+    ADD COLUMN account_number VARCHAR(50),
+    ADD COLUMN qr_string TEXT,
+    ADD COLUMN checkout_url VARCHAR(512),
+    ADD COLUMN mobile_checkout_url VARCHAR(512),
+    ADD COLUMN deeplink_url VARCHAR(512);
+
+-- Idempotency keys
+CREATE TABLE idempotency_keys (
+    idempotency_key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER,
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    UNIQUE (user_id, key)
+);
+
+-- At most one open or completed payment per rental
+CREATE UNIQUE INDEX idx_payments_active_rental ON payments(rental_id)
+    WHERE extension_id IS NULL AND payment_status IN ('PENDING', 'COMPLETED');
+
+-- Refunds
+ALTER TABLE payments
+    ADD COLUMN refunded_amount DECIMAL(10,2) DEFAULT 0;
+
+CREATE TABLE refunds (
+    refund_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(payment_id),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    requested_by UUID NOT NULL REFERENCES users(user_id),
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    points_returned INTEGER DEFAULT 0,
+    reason VARCHAR(255),
+    status VARCHAR(20) DEFAULT 'PENDING',
+    xendit_refund_id VARCHAR(100),
+    failure_code VARCHAR(100),
+    refunded_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_refunds_payment ON refunds(payment_id);
+
+-- Loyalty points ledger. The original loyalty_points table keyed users by
+-- integer and was never written, so it is recreated.
+DROP TABLE IF EXISTS loyalty_points;
+CREATE TABLE loyalty_points (
+    user_id UUID PRIMARY KEY REFERENCES users(user_id),
+    points INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE points_transactions (
+    points_transaction_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    type VARCHAR(20) NOT NULL,
+    points INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    payment_id UUID REFERENCES payments(payment_id),
+    refund_id UUID REFERENCES refunds(refund_id),
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_points_transactions_user ON points_transactions(user_id, created_at);
+
+ALTER TABLE refunds
+    ADD COLUMN points_clawback INTEGER DEFAULT 0;
+
+-- Payment reconciliation
+CREATE INDEX idx_payments_xendit_invoice_id ON payments(xendit_invoice_id);
+CREATE INDEX idx_payments_paid_at ON payments(paid_at);
+
+-- Promotions
+CREATE TABLE promotions (
+    promotion_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(255),
+    discount_type VARCHAR(20) NOT NULL,
+    discount_value DECIMAL(10,2) NOT NULL CHECK (discount_value > 0),
+    max_discount DECIMAL(10,2) DEFAULT 0,
+    min_order_amount DECIMAL(10,2) DEFAULT 0,
+    category_id UUID REFERENCES equipment_categories(category_id),
+    equipment_id UUID REFERENCES equipment(equipment_id),
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    usage_limit INTEGER DEFAULT 0,
+    per_user_limit INTEGER DEFAULT 0,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE promotion_redemptions (
+    promotion_redemption_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    promotion_id UUID NOT NULL REFERENCES promotions(promotion_id),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    rental_id UUID NOT NULL REFERENCES rentals(rental_id),
+    amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_promotion_redemptions_promotion ON promotion_redemptions(promotion_id, user_id);
+
+ALTER TABLE rentals
+    ADD COLUMN promo_code VARCHAR(50),
+    ADD COLUMN discount_amount DECIMAL(10,2) DEFAULT 0;
+
+-- Tax
+ALTER TABLE equipment_categories
+    ADD COLUMN tax_exempt BOOLEAN DEFAULT false;
+ALTER TABLE rentals
+    ADD COLUMN subtotal DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN tax_amount DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE rental_extensions
+    ADD COLUMN extra_subtotal DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN extra_tax DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE payments
+    ADD COLUMN subtotal DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN tax_amount DECIMAL(10,2) DEFAULT 0;
+-- Rentals from before tax was charged
+UPDATE rentals SET subtotal = total_cost WHERE subtotal = 0;
+UPDATE payments SET subtotal = amount WHERE subtotal = 0;
+
+-- Currency of payments, amounts are charged in whole rupiah
+ALTER TABLE payments
+    ADD COLUMN currency VARCHAR(3) DEFAULT 'IDR';
+
+-- Multi-currency pricing. Rates are the value of one unit of a currency in
+-- IDR, rentals keep the rate they were booked at.
+CREATE TABLE exchange_rates (
+    exchange_rate_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    currency VARCHAR(3) NOT NULL,
+    rate DECIMAL(18,8) NOT NULL CHECK (rate > 0),
+    effective_from TIMESTAMP NOT NULL,
+    created_by UUID REFERENCES users(user_id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_exchange_rates_currency ON exchange_rates(currency, effective_from DESC);
+
+ALTER TABLE equipment
+    ADD COLUMN currency VARCHAR(3) DEFAULT 'IDR';
+ALTER TABLE rentals
+    ADD COLUMN currency VARCHAR(3) DEFAULT 'IDR',
+    ADD COLUMN exchange_rate DECIMAL(18,8) DEFAULT 1;
+ALTER TABLE quotes
+    ADD COLUMN currency VARCHAR(3) DEFAULT 'IDR';
+ALTER TABLE payments
+    ADD COLUMN original_amount DECIMAL(10,2) DEFAULT 0,
+    ADD COLUMN original_currency VARCHAR(3) DEFAULT 'IDR';
+UPDATE payments SET original_amount = amount WHERE original_amount = 0;
+
+-- Security deposits, held in the settlement currency
+ALTER TABLE equipment_categories
+    ADD COLUMN deposit_amount DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE equipment
+    ADD COLUMN deposit_amount DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE rentals
+    ADD COLUMN deposit_amount DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE payments
+    ADD COLUMN deposit_amount DECIMAL(10,2) DEFAULT 0;
+ALTER TABLE refunds
+    ADD COLUMN deposit BOOLEAN DEFAULT false;
+
+CREATE TABLE deposit_entries (
+    deposit_entry_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rental_id UUID NOT NULL REFERENCES rentals(rental_id),
+    payment_id UUID NOT NULL REFERENCES payments(payment_id),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    type VARCHAR(20) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    balance_after DECIMAL(10,2) NOT NULL,
+    currency VARCHAR(3) DEFAULT 'IDR',
+    reason VARCHAR(255),
+    created_by UUID REFERENCES users(user_id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_deposit_entries_rental ON deposit_entries(rental_id, created_at);
+
+-- Late fees of rentals returned after their end date
+CREATE TABLE late_fees (
+    late_fee_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rental_id UUID NOT NULL UNIQUE REFERENCES rentals(rental_id),
+    user_id UUID NOT NULL REFERENCES users(user_id),
+    status VARCHAR(20) DEFAULT 'ACCRUING',
+    days_late INT NOT NULL,
+    daily_fee DECIMAL(10,2) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    paid_amount DECIMAL(10,2) DEFAULT 0,
+    currency VARCHAR(3) DEFAULT 'IDR',
+    waived_amount DECIMAL(10,2) DEFAULT 0,
+    waived_by UUID REFERENCES users(user_id),
+    waived_at TIMESTAMP,
+    waive_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE payments
+    ADD COLUMN late_fee_id UUID REFERENCES late_fees(late_fee_id);
+
+-- Late fees are paid on top of the rental's completed payment
+DROP INDEX idx_payments_active_rental;
+CREATE UNIQUE INDEX idx_payments_active_rental ON payments(rental_id)
+    WHERE extension_id IS NULL AND late_fee_id IS NULL AND payment_status IN ('PENDING', 'COMPLETED');
+-- At most one open payment per late fee
+CREATE UNIQUE INDEX idx_payments_pending_late_fee ON payments(late_fee_id)
+    WHERE payment_status = 'PENDING';
+CREATE INDEX idx_rentals_status_end_date ON rentals (status, end_date);
+
+-- Refresh tokens are stored hashed and rotate within the family of their
+-- login session
+ALTER TABLE tokens
+    ADD COLUMN family_id UUID,
+    ADD COLUMN rotated_at TIMESTAMP,
+    ADD COLUMN revoked_at TIMESTAMP;
+UPDATE tokens SET is_valid = false;
+CREATE INDEX idx_tokens_token ON tokens (token);
+CREATE INDEX idx_tokens_family ON tokens (family_id, is_valid);
+CREATE INDEX idx_tokens_user ON tokens (user_id);
@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DepositRepository interface {
+	FindByRentalID(rentalID uuid.UUID) ([]models.DepositEntry, error)
+	Settle(rentalID uuid.UUID, retained models.Money, reason string, settledBy uuid.UUID) (*DepositSettlement, error)
+	Release(rentalID uuid.UUID, amount models.Money, reason string, releasedBy uuid.UUID) (*models.DepositEntry, error)
+}
+
+// ErrDepositNotHeld is returned when settling a rental that holds no deposit
+var ErrDepositNotHeld = errors.New("rental holds no deposit")
+
+// ErrDepositRetainExceedsHeld is returned when more than the deposit held
+// would be retained
+var ErrDepositRetainExceedsHeld = errors.New("retained amount exceeds the deposit held")
+
+// ErrDepositRefundPending is returned when settling a deposit while a refund
+// of it is still waiting for the gateway
+var ErrDepositRefundPending = errors.New("a refund of the deposit is pending")
+
+// DepositSettlement is the outcome of a return inspection. Retained is the
+// RETAIN entry, nil when nothing was kept. Release is the rest of the
+// deposit, to be refunded from the payment that collected it; it is recorded
+// once the refund succeeds.
+type DepositSettlement struct {
+	RentalID  uuid.UUID
+	PaymentID uuid.UUID
+	Retained  *models.DepositEntry
+	Release   models.Money
+}
+
+type depositRepository struct {
+	db *gorm.DB
+}
+
+func NewDepositRepository(db *gorm.DB) DepositRepository {
+	return &depositRepository{db}
+}
+
+// FindByRentalID returns the rental's deposit ledger entries, oldest first
+func (r *depositRepository) FindByRentalID(rentalID uuid.UUID) ([]models.DepositEntry, error) {
+	var entries []models.DepositEntry
+	err := r.db.Where("rental_id = ?", rentalID).Order("created_at ASC").Find(&entries).Error
+	return entries, err
+}
+
+// Settle records the retained amount of the deposit held for the rental and
+// returns the rest as the amount to release. The rental is locked while the
+// ledger is read so a deposit is only settled once, and a deposit with a
+// pending refund cannot be settled again.
+func (r *depositRepository) Settle(rentalID uuid.UUID, retained models.Money, reason string, settledBy uuid.UUID) (*DepositSettlement, error) {
+	var settlement *DepositSettlement
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		held, hold, err := lockDeposit(tx, rentalID)
+		if err != nil {
+			return err
+		}
+		if retained < 0 || retained > held {
+			return ErrDepositRetainExceedsHeld
+		}
+
+		settlement = &DepositSettlement{RentalID: rentalID, PaymentID: hold.PaymentID, Release: held - retained}
+		if retained == 0 {
+			return nil
+		}
+		settlement.Retained = &models.DepositEntry{
+			RentalID:     rentalID,
+			PaymentID:    hold.PaymentID,
+			UserID:       hold.UserID,
+			Type:         models.DepositEntryRetain,
+			Amount:       -retained,
+			BalanceAfter: held - retained,
+			Currency:     hold.Currency,
+			Reason:       reason,
+			CreatedBy:    &settledBy,
+		}
+		return appendDepositEntry(tx, settlement.Retained)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// Release records deposit money given back outside the payment gateway, such
+// as by bank transfer
+func (r *depositRepository) Release(rentalID uuid.UUID, amount models.Money, reason string, releasedBy uuid.UUID) (*models.DepositEntry, error) {
+	var entry *models.DepositEntry
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		held, hold, err := lockDeposit(tx, rentalID)
+		if err != nil {
+			return err
+		}
+		if amount <= 0 || amount > held {
+			return ErrDepositNotHeld
+		}
+		entry = &models.DepositEntry{
+			RentalID:     rentalID,
+			PaymentID:    hold.PaymentID,
+			UserID:       hold.UserID,
+			Type:         models.DepositEntryRelease,
+			Amount:       -amount,
+			BalanceAfter: held - amount,
+			Currency:     hold.Currency,
+			Reason:       reason,
+			CreatedBy:    &releasedBy,
+		}
+		return appendDepositEntry(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// lockDeposit locks the rental and returns the deposit it still holds with
+// the entry that collected it
+func lockDeposit(tx *gorm.DB, rentalID uuid.UUID) (models.Money, *models.DepositEntry, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("rental_id").
+		First(&models.Rental{}, "rental_id = ?", rentalID).Error; err != nil {
+		return 0, nil, err
+	}
+
+	held, err := depositBalance(tx, rentalID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if held <= 0 {
+		return 0, nil, ErrDepositNotHeld
+	}
+	pending, err := pendingDepositRefunds(tx, rentalID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if pending > 0 {
+		return 0, nil, ErrDepositRefundPending
+	}
+
+	var hold models.DepositEntry
+	if err := tx.Where("rental_id = ? AND type = ?", rentalID, models.DepositEntryHold).
+		Order("created_at DESC").
+		First(&hold).Error; err != nil {
+		return 0, nil, err
+	}
+	return held, &hold, nil
+}
+
+// releaseDeposit records the deposit given back by a refund that succeeded
+// inside tx
+func releaseDeposit(tx *gorm.DB, refund *models.Refund, payment *models.Payment) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("rental_id").
+		First(&models.Rental{}, "rental_id = ?", payment.RentalID).Error; err != nil {
+		return err
+	}
+	held, err := depositBalance(tx, payment.RentalID)
+	if err != nil {
+		return err
+	}
+	return appendDepositEntry(tx, &models.DepositEntry{
+		RentalID:     payment.RentalID,
+		PaymentID:    payment.ID,
+		UserID:       payment.UserID,
+		Type:         models.DepositEntryRelease,
+		Amount:       -refund.Amount,
+		BalanceAfter: held - refund.Amount,
+		Currency:     payment.Currency.OrDefault(),
+		Reason:       refund.Reason,
+		CreatedBy:    &refund.RequestedBy,
+	})
+}
+
+// pendingDepositRefunds adds up the deposit refunds of the rental's payments
+// that are waiting for the gateway
+func pendingDepositRefunds(tx *gorm.DB, rentalID uuid.UUID) (models.Money, error) {
+	var pending models.Money
+	err := tx.Model(&models.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("deposit AND status = ? AND payment_id IN (?)", models.RefundStatusPending,
+			tx.Model(&models.Payment{}).Select("payment_id").Where("rental_id = ?", rentalID)).
+		Scan(&pending).Error
+	return pending, err
+}
+
+// holdDeposit records the security deposit collected with a rental payment
+// inside tx. Extension payments carry no deposit.
+func holdDeposit(tx *gorm.DB, payment *models.Payment) error {
+	if payment.DepositAmount <= 0 || payment.ExtensionID != nil {
+		return nil
+	}
+	held, err := depositBalance(tx, payment.RentalID)
+	if err != nil {
+		return err
+	}
+	return appendDepositEntry(tx, &models.DepositEntry{
+		RentalID:     payment.RentalID,
+		PaymentID:    payment.ID,
+		UserID:       payment.UserID,
+		Type:         models.DepositEntryHold,
+		Amount:       payment.DepositAmount,
+		BalanceAfter: held + payment.DepositAmount,
+		Currency:     payment.Currency.OrDefault(),
+		Reason:       "Collected with rental payment",
+	})
+}
+
+// depositBalance is the deposit the rental still holds
+func depositBalance(tx *gorm.DB, rentalID uuid.UUID) (models.Money, error) {
+	var held models.Money
+	err := tx.Model(&models.DepositEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("rental_id = ?", rentalID).
+		Scan(&held).Error
+	return held, err
+}
+
+func appendDepositEntry(tx *gorm.DB, entry *models.DepositEntry) error {
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	return tx.Create(entry).Error
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateRepository interface {
+	Create(rate *models.ExchangeRate) error
+	FindByID(id uuid.UUID) (*models.ExchangeRate, error)
+	FindAll(currency models.Currency, limit, offset int) ([]models.ExchangeRate, int64, error)
+	FindEffective(currency models.Currency, at time.Time) (*models.ExchangeRate, error)
+	Delete(id uuid.UUID) error
+}
+
+type exchangeRateRepository struct {
+	db *gorm.DB
+}
+
+func NewExchangeRateRepository(db *gorm.DB) ExchangeRateRepository {
+	return &exchangeRateRepository{db}
+}
+
+func (r *exchangeRateRepository) Create(rate *models.ExchangeRate) error {
+	return r.db.Create(rate).Error
+}
+
+func (r *exchangeRateRepository) FindByID(id uuid.UUID) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	if err := r.db.First(&rate, "exchange_rate_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// FindAll returns a page of rates, optionally of one currency, latest
+// effective date first
+func (r *exchangeRateRepository) FindAll(currency models.Currency, limit, offset int) ([]models.ExchangeRate, int64, error) {
+	var rates []models.ExchangeRate
+	var total int64
+	query := r.db.Model(&models.ExchangeRate{})
+	if currency != "" {
+		query = query.Where("currency = ?", currency)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("effective_from DESC, created_at DESC").Limit(limit).Offset(offset).Find(&rates).Error
+	return rates, total, err
+}
+
+// FindEffective returns the rate of the currency in force at the given time.
+// Of two rates taking effect at the same time the one entered last wins.
+func (r *exchangeRateRepository) FindEffective(currency models.Currency, at time.Time) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := r.db.Where("currency = ? AND effective_from <= ?", currency, at).
+		Order("effective_from DESC, created_at DESC").
+		First(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (r *exchangeRateRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.ExchangeRate{}, "exchange_rate_id = ?", id).Error
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository interface {
+	Reserve(record *models.IdempotencyKey) (bool, error)
+	Find(userID uuid.UUID, key string) (*models.IdempotencyKey, error)
+	Complete(id uuid.UUID, statusCode int, body []byte) error
+	Release(id uuid.UUID) error
+	DeleteCreatedBefore(before time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db}
+}
+
+// Reserve stores the key unless the user already used it. It reports whether
+// the caller now owns the key and has to process the request.
+func (r *idempotencyRepository) Reserve(record *models.IdempotencyKey) (bool, error) {
+	record.ID = uuid.New()
+	record.CreatedAt = time.Now()
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *idempotencyRepository) Find(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	if err := r.db.First(&record, "user_id = ? AND key = ?", userID, key).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Complete stores the response that is replayed for later requests
+func (r *idempotencyRepository) Complete(id uuid.UUID, statusCode int, body []byte) error {
+	return r.db.Model(&models.IdempotencyKey{}).
+		Where("idempotency_key_id = ?", id).
+		Updates(map[string]interface{}{
+			"status_code":   statusCode,
+			"response_body": body,
+			"completed_at":  time.Now(),
+		}).Error
+}
+
+// Release removes a reservation whose request failed so it can be retried
+func (r *idempotencyRepository) Release(id uuid.UUID) error {
+	return r.db.Delete(&models.IdempotencyKey{}, "idempotency_key_id = ?", id).Error
+}
+
+// DeleteCreatedBefore removes keys that are too old to be replayed
+func (r *idempotencyRepository) DeleteCreatedBefore(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
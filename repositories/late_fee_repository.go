@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LateFeeRepository interface {
+	FindByRentalID(rentalID uuid.UUID) (*models.LateFee, error)
+	Accrue(fee *models.LateFee) (bool, error)
+	Waive(rentalID uuid.UUID, reason string, waivedBy uuid.UUID) (*models.LateFee, error)
+}
+
+// ErrLateFeeWaived is returned when accruing a fee that was waived
+var ErrLateFeeWaived = errors.New("late fee was waived")
+
+// ErrLateFeeSettled is returned when waiving a fee with nothing outstanding
+var ErrLateFeeSettled = errors.New("late fee has nothing outstanding")
+
+// ErrLateFeePaymentPending is returned when waiving a fee the customer is
+// paying at the moment
+var ErrLateFeePaymentPending = errors.New("late fee has a pending payment")
+
+type lateFeeRepository struct {
+	db *gorm.DB
+}
+
+func NewLateFeeRepository(db *gorm.DB) LateFeeRepository {
+	return &lateFeeRepository{db}
+}
+
+func (r *lateFeeRepository) FindByRentalID(rentalID uuid.UUID) (*models.LateFee, error) {
+	var fee models.LateFee
+	err := r.db.First(&fee, "rental_id = ?", rentalID).Error
+	return &fee, err
+}
+
+// Accrue stores the days late, daily fee, amount and status set on the fee.
+// The rental's fee is created on the first call. Later calls only raise the
+// amount, so running the overdue job twice on the same day charges one day.
+// It reports whether the stored fee changed and fills fee with it.
+func (r *lateFeeRepository) Accrue(fee *models.LateFee) (bool, error) {
+	changed := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.LateFee
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&stored, "rental_id = ?", fee.RentalID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fee.ID = uuid.New()
+			fee.PaidAmount, fee.WaivedAmount = 0, 0
+			fee.CreatedAt = time.Now()
+			fee.UpdatedAt = fee.CreatedAt
+			changed = true
+			return tx.Create(fee).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if stored.Status == models.LateFeeStatusWaived {
+			*fee = stored
+			return ErrLateFeeWaived
+		}
+		status := stored.Status
+		if status == models.LateFeeStatusAccruing {
+			status = fee.Status
+		}
+		if fee.DaysLate > stored.DaysLate {
+			stored.DaysLate = fee.DaysLate
+			stored.DailyFee = fee.DailyFee
+			stored.Amount = fee.Amount
+			changed = true
+		}
+		if status == models.LateFeeStatusDue && stored.Outstanding() <= 0 {
+			status = models.LateFeeStatusPaid
+		}
+		if status != stored.Status {
+			stored.Status = status
+			changed = true
+		}
+		if !changed {
+			*fee = stored
+			return nil
+		}
+
+		stored.UpdatedAt = time.Now()
+		if err := tx.Model(&models.LateFee{}).
+			Where("late_fee_id = ?", stored.ID).
+			Updates(map[string]interface{}{
+				"days_late":  stored.DaysLate,
+				"daily_fee":  stored.DailyFee,
+				"amount":     stored.Amount,
+				"status":     stored.Status,
+				"updated_at": stored.UpdatedAt,
+			}).Error; err != nil {
+			return err
+		}
+		*fee = stored
+		return nil
+	})
+	return changed, err
+}
+
+// Waive writes off what is left of the rental's fee and records who waived it
+// and why. A waived fee stops accruing. Fees with a pending payment cannot be
+// waived so money is not received for a fee that was written off.
+func (r *lateFeeRepository) Waive(rentalID uuid.UUID, reason string, waivedBy uuid.UUID) (*models.LateFee, error) {
+	var fee models.LateFee
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&fee, "rental_id = ?", rentalID).Error; err != nil {
+			return err
+		}
+		if fee.Status == models.LateFeeStatusWaived || fee.Status == models.LateFeeStatusPaid || fee.Outstanding() <= 0 {
+			return ErrLateFeeSettled
+		}
+
+		var pending int64
+		if err := tx.Model(&models.Payment{}).
+			Where("late_fee_id = ? AND payment_status = ?", fee.ID, models.PaymentStatusPending).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrLateFeePaymentPending
+		}
+
+		now := time.Now()
+		fee.WaivedAmount += fee.Outstanding()
+		fee.Status = models.LateFeeStatusWaived
+		fee.WaivedBy = &waivedBy
+		fee.WaivedAt = &now
+		fee.WaiveReason = reason
+		fee.UpdatedAt = now
+		return tx.Model(&models.LateFee{}).
+			Where("late_fee_id = ?", fee.ID).
+			Updates(map[string]interface{}{
+				"waived_amount": fee.WaivedAmount,
+				"status":        fee.Status,
+				"waived_by":     fee.WaivedBy,
+				"waived_at":     fee.WaivedAt,
+				"waive_reason":  fee.WaiveReason,
+				"updated_at":    fee.UpdatedAt,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fee, nil
+}
+
+// payLateFee adds a completed late fee payment to the fee it pays inside tx.
+// A fee whose equipment is back is paid once nothing is outstanding.
+func payLateFee(tx *gorm.DB, payment *models.Payment) error {
+	if payment.LateFeeID == nil {
+		return nil
+	}
+	var fee models.LateFee
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&fee, "late_fee_id = ?", *payment.LateFeeID).Error; err != nil {
+		return err
+	}
+
+	fee.PaidAmount += payment.Amount
+	if fee.Status == models.LateFeeStatusDue && fee.Outstanding() <= 0 {
+		fee.Status = models.LateFeeStatusPaid
+	}
+	return tx.Model(&models.LateFee{}).
+		Where("late_fee_id = ?", fee.ID).
+		Updates(map[string]interface{}{
+			"paid_amount": fee.PaidAmount,
+			"status":      fee.Status,
+			"updated_at":  time.Now(),
+		}).Error
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoyaltyRepository interface {
+	FindBalance(userID uuid.UUID) (*models.LoyaltyPoints, error)
+	FindTransactions(userID uuid.UUID, limit, offset int) ([]models.PointsTransaction, int64, error)
+}
+
+// ErrInsufficientPoints is returned when a user spends more points than the
+// balance holds
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+type loyaltyRepository struct {
+	db *gorm.DB
+}
+
+func NewLoyaltyRepository(db *gorm.DB) LoyaltyRepository {
+	return &loyaltyRepository{db}
+}
+
+// FindBalance returns the user's balance, which is zero for users that never
+// earned points
+func (r *loyaltyRepository) FindBalance(userID uuid.UUID) (*models.LoyaltyPoints, error) {
+	balance := models.LoyaltyPoints{UserID: userID}
+	err := r.db.First(&balance, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &balance, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// FindTransactions returns the user's ledger entries, newest first
+func (r *loyaltyRepository) FindTransactions(userID uuid.UUID, limit, offset int) ([]models.PointsTransaction, int64, error) {
+	var transactions []models.PointsTransaction
+	var total int64
+	query := r.db.Model(&models.PointsTransaction{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&transactions).Error
+	return transactions, total, err
+}
+
+// applyPoints appends the entry to the ledger and moves the user's balance by
+// its points inside tx. The balance row is locked so concurrent entries see
+// each other. Debits that would make the balance negative fail with
+// ErrInsufficientPoints unless allowNegative is set, which is used to take
+// back points the user may already have spent.
+func applyPoints(tx *gorm.DB, entry *models.PointsTransaction, allowNegative bool) error {
+	now := time.Now()
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoyaltyPoints{UserID: entry.UserID, UpdatedAt: now}).Error; err != nil {
+		return err
+	}
+
+	var balance models.LoyaltyPoints
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&balance, "user_id = ?", entry.UserID).Error; err != nil {
+		return err
+	}
+	points := balance.Points + entry.Points
+	if points < 0 && entry.Points < 0 && !allowNegative {
+		return ErrInsufficientPoints
+	}
+
+	if err := tx.Model(&models.LoyaltyPoints{}).
+		Where("user_id = ?", entry.UserID).
+		Updates(map[string]interface{}{
+			"points":     points,
+			"updated_at": now,
+		}).Error; err != nil {
+		return err
+	}
+
+	entry.ID = uuid.New()
+	entry.BalanceAfter = points
+	entry.CreatedAt = now
+	return tx.Create(entry).Error
+}
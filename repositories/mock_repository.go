@@ -107,6 +107,26 @@ func (m *MockTokenRepository) UpdateToken(token *models.Tokens) error {
 	return args.Error(0)
 }
 
+func (m *MockTokenRepository) Rotate(current *models.Tokens, next *models.Tokens) error {
+	args := m.Called(current, next)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	args := m.Called(familyID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RevokeUser(userID uuid.UUID) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) IsSessionActive(familyID uuid.UUID) (bool, error) {
+	args := m.Called(familyID)
+	return args.Bool(0), args.Error(1)
+}
+
 // Mock Equipment Repository
 type MockEquipmentRepository struct {
 	mock.Mock
@@ -221,11 +241,29 @@ func (m *MockRentalRepository) FindAll() ([]models.Rental, error) {
 	return args.Get(0).([]models.Rental), args.Error(1)
 }
 
+func (m *MockRentalRepository) FindWithFilter(filter RentalFilter, limit, offset int) ([]models.Rental, int64, error) {
+	args := m.Called(filter, limit, offset)
+	return args.Get(0).([]models.Rental), args.Get(1).(int64), args.Error(2)
+}
+
 func (m *MockRentalRepository) CheckOverlap(equipmentID uuid.UUID, startDate, endDate time.Time) (bool, error) {
 	args := m.Called(equipmentID, startDate, endDate)
 	return args.Get(0).(bool), args.Error(1)
 }
 
+func (m *MockRentalRepository) SumBookedQuantity(equipmentID uuid.UUID, startDate, endDate time.Time) (int, error) {
+	args := m.Called(equipmentID, startDate, endDate)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRentalRepository) FindBookedPeriods(equipmentID uuid.UUID, startDate, endDate time.Time) ([]BookedPeriod, error) {
+	args := m.Called(equipmentID, startDate, endDate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]BookedPeriod), args.Error(1)
+}
+
 func (m *MockRentalRepository) Update(rental *models.Rental) error {
 	args := m.Called(rental)
 	return args.Error(0)
@@ -236,6 +274,52 @@ func (m *MockRentalRepository) UpdateStatus(id uuid.UUID, status string) error {
 	return args.Error(0)
 }
 
+func (m *MockRentalRepository) Transition(id uuid.UUID, fromStatus string, updates map[string]interface{}) error {
+	args := m.Called(id, fromStatus, updates)
+	return args.Error(0)
+}
+
+func (m *MockRentalRepository) FindPendingCreatedBefore(before time.Time, limit int) ([]models.Rental, error) {
+	args := m.Called(before, limit)
+	return args.Get(0).([]models.Rental), args.Error(1)
+}
+
+func (m *MockRentalRepository) FindEndedBefore(before time.Time) ([]models.Rental, error) {
+	args := m.Called(before)
+	return args.Get(0).([]models.Rental), args.Error(1)
+}
+
+func (m *MockRentalRepository) CreateExtension(extension *models.RentalExtension, payment *models.Payment) error {
+	args := m.Called(extension, payment)
+	return args.Error(0)
+}
+
+func (m *MockRentalRepository) FindExtensionByID(id uuid.UUID) (*models.RentalExtension, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RentalExtension), args.Error(1)
+}
+
+func (m *MockRentalRepository) FindPendingExtension(rentalID uuid.UUID) (*models.RentalExtension, error) {
+	args := m.Called(rentalID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RentalExtension), args.Error(1)
+}
+
+func (m *MockRentalRepository) ApplyExtension(extension *models.RentalExtension) error {
+	args := m.Called(extension)
+	return args.Error(0)
+}
+
+func (m *MockRentalRepository) ExpireExtensionsCreatedBefore(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockRentalRepository) Delete(id uuid.UUID) error {
 	args := m.Called(id)
 	return args.Error(0)
@@ -259,12 +343,9 @@ func (m *MockPaymentRepository) FindByID(id uuid.UUID) (*models.Payment, error)
 	return args.Get(0).(*models.Payment), args.Error(1)
 }
 
-func (m *MockPaymentRepository) FindByRentalID(rentalID uuid.UUID) (*models.Payment, error) {
+func (m *MockPaymentRepository) FindByRentalID(rentalID uuid.UUID) ([]models.Payment, error) {
 	args := m.Called(rentalID)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*models.Payment), args.Error(1)
+	return args.Get(0).([]models.Payment), args.Error(1)
 }
 
 func (m *MockPaymentRepository) Update(payment *models.Payment) error {
@@ -278,3 +359,279 @@ func (m *MockPaymentRepository) FindByExternalID(externalID string) (*models.Pay
 	}
 	return args.Get(0).(*models.Payment), args.Error(1)
 }
+
+func (m *MockPaymentRepository) FindByInvoiceID(invoiceID string) (*models.Payment, error) {
+	args := m.Called(invoiceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) ExpirePendingByRentalID(rentalID uuid.UUID, expiredAt time.Time) error {
+	args := m.Called(rentalID, expiredAt)
+	return args.Error(0)
+}
+
+func (m *MockPaymentRepository) MarkPaid(payment *models.Payment) error {
+	args := m.Called(payment)
+	return args.Error(0)
+}
+
+func (m *MockPaymentRepository) FindWithFilter(filter PaymentFilter, limit, offset int) ([]models.Payment, int64, error) {
+	args := m.Called(filter, limit, offset)
+	return args.Get(0).([]models.Payment), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockPaymentRepository) MarkFailed(payment *models.Payment) error {
+	args := m.Called(payment)
+	return args.Error(0)
+}
+
+func (m *MockPaymentRepository) MarkUnderpaid(payment *models.Payment) error {
+	args := m.Called(payment)
+	return args.Error(0)
+}
+
+// Mock Quote Repository
+type MockQuoteRepository struct {
+	mock.Mock
+}
+
+func (m *MockQuoteRepository) Create(quote *models.Quote) error {
+	args := m.Called(quote)
+	return args.Error(0)
+}
+
+func (m *MockQuoteRepository) FindByID(id uuid.UUID) (*models.Quote, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Quote), args.Error(1)
+}
+
+func (m *MockQuoteRepository) Book(quote *models.Quote, rental *models.Rental) error {
+	args := m.Called(quote, rental)
+	return args.Error(0)
+}
+
+// Mock Idempotency Repository
+type MockIdempotencyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepository) Reserve(record *models.IdempotencyKey) (bool, error) {
+	args := m.Called(record)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyRepository) Find(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
+	args := m.Called(userID, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockIdempotencyRepository) Complete(id uuid.UUID, statusCode int, body []byte) error {
+	args := m.Called(id, statusCode, body)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) Release(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteCreatedBefore(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Mock Refund Repository
+type MockRefundRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefundRepository) Create(refund *models.Refund) error {
+	args := m.Called(refund)
+	return args.Error(0)
+}
+
+func (m *MockRefundRepository) FindByID(id uuid.UUID) (*models.Refund, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Refund), args.Error(1)
+}
+
+func (m *MockRefundRepository) FindByPaymentID(paymentID uuid.UUID) ([]models.Refund, error) {
+	args := m.Called(paymentID)
+	return args.Get(0).([]models.Refund), args.Error(1)
+}
+
+func (m *MockRefundRepository) SetXenditRefundID(refund *models.Refund) error {
+	args := m.Called(refund)
+	return args.Error(0)
+}
+
+func (m *MockRefundRepository) MarkSucceeded(refund *models.Refund, payment *models.Payment) error {
+	args := m.Called(refund, payment)
+	return args.Error(0)
+}
+
+func (m *MockRefundRepository) MarkFailed(refund *models.Refund) error {
+	args := m.Called(refund)
+	return args.Error(0)
+}
+
+// Mock Loyalty Repository
+type MockLoyaltyRepository struct {
+	mock.Mock
+}
+
+func (m *MockLoyaltyRepository) FindBalance(userID uuid.UUID) (*models.LoyaltyPoints, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoyaltyPoints), args.Error(1)
+}
+
+func (m *MockLoyaltyRepository) FindTransactions(userID uuid.UUID, limit, offset int) ([]models.PointsTransaction, int64, error) {
+	args := m.Called(userID, limit, offset)
+	return args.Get(0).([]models.PointsTransaction), args.Get(1).(int64), args.Error(2)
+}
+
+// Mock Promotion Repository
+type MockPromotionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPromotionRepository) Create(promotion *models.Promotion) error {
+	args := m.Called(promotion)
+	return args.Error(0)
+}
+
+func (m *MockPromotionRepository) FindByID(id uuid.UUID) (*models.Promotion, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Promotion), args.Error(1)
+}
+
+func (m *MockPromotionRepository) FindByCode(code string) (*models.Promotion, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Promotion), args.Error(1)
+}
+
+func (m *MockPromotionRepository) FindAll(limit, offset int) ([]models.Promotion, int64, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]models.Promotion), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockPromotionRepository) Update(promotion *models.Promotion) error {
+	args := m.Called(promotion)
+	return args.Error(0)
+}
+
+func (m *MockPromotionRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockPromotionRepository) CountRedemptions(promotionID, userID uuid.UUID) (int64, int64, error) {
+	args := m.Called(promotionID, userID)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+type MockExchangeRateRepository struct {
+	mock.Mock
+}
+
+func (m *MockExchangeRateRepository) Create(rate *models.ExchangeRate) error {
+	args := m.Called(rate)
+	return args.Error(0)
+}
+
+func (m *MockExchangeRateRepository) FindByID(id uuid.UUID) (*models.ExchangeRate, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExchangeRate), args.Error(1)
+}
+
+func (m *MockExchangeRateRepository) FindAll(currency models.Currency, limit, offset int) ([]models.ExchangeRate, int64, error) {
+	args := m.Called(currency, limit, offset)
+	return args.Get(0).([]models.ExchangeRate), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockExchangeRateRepository) FindEffective(currency models.Currency, at time.Time) (*models.ExchangeRate, error) {
+	args := m.Called(currency, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExchangeRate), args.Error(1)
+}
+
+func (m *MockExchangeRateRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockDepositRepository struct {
+	mock.Mock
+}
+
+func (m *MockDepositRepository) FindByRentalID(rentalID uuid.UUID) ([]models.DepositEntry, error) {
+	args := m.Called(rentalID)
+	return args.Get(0).([]models.DepositEntry), args.Error(1)
+}
+
+func (m *MockDepositRepository) Settle(rentalID uuid.UUID, retained models.Money, reason string, settledBy uuid.UUID) (*DepositSettlement, error) {
+	args := m.Called(rentalID, retained, reason, settledBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*DepositSettlement), args.Error(1)
+}
+
+func (m *MockDepositRepository) Release(rentalID uuid.UUID, amount models.Money, reason string, releasedBy uuid.UUID) (*models.DepositEntry, error) {
+	args := m.Called(rentalID, amount, reason, releasedBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.DepositEntry), args.Error(1)
+}
+
+type MockLateFeeRepository struct {
+	mock.Mock
+}
+
+func (m *MockLateFeeRepository) FindByRentalID(rentalID uuid.UUID) (*models.LateFee, error) {
+	args := m.Called(rentalID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LateFee), args.Error(1)
+}
+
+func (m *MockLateFeeRepository) Accrue(fee *models.LateFee) (bool, error) {
+	args := m.Called(fee)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockLateFeeRepository) Waive(rentalID uuid.UUID, reason string, waivedBy uuid.UUID) (*models.LateFee, error) {
+	args := m.Called(rentalID, reason, waivedBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LateFee), args.Error(1)
+}
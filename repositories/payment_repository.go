@@ -1,19 +1,47 @@
 package repositories
 
 import (
+	"errors"
 	"invitified-go/models"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepository interface {
 	Create(payment *models.Payment) error
 	FindByID(id uuid.UUID) (*models.Payment, error)
 	FindByExternalID(externalID string) (*models.Payment, error)
+	FindByInvoiceID(invoiceID string) (*models.Payment, error)
+	FindByRentalID(rentalID uuid.UUID) ([]models.Payment, error)
+	FindWithFilter(filter PaymentFilter, limit, offset int) ([]models.Payment, int64, error)
 	Update(payment *models.Payment) error
+	ExpirePendingByRentalID(rentalID uuid.UUID, expiredAt time.Time) error
+	MarkPaid(payment *models.Payment) error
+	MarkFailed(payment *models.Payment) error
+	MarkUnderpaid(payment *models.Payment) error
 }
 
+// PaymentFilter narrows down a payment listing. Zero values are ignored.
+type PaymentFilter struct {
+	UserID   uuid.UUID
+	RentalID uuid.UUID
+	Status   string
+	Method   string
+	// From and To select payments created within the window
+	From time.Time
+	To   time.Time
+	// PaidFrom and PaidTo select payments paid within the window
+	PaidFrom time.Time
+	PaidTo   time.Time
+}
+
+// ErrPaymentNotPending is returned when marking a payment as paid that was
+// already completed or refunded.
+var ErrPaymentNotPending = errors.New("payment is no longer pending")
+
 type paymentRepository struct {
 	db *gorm.DB
 }
@@ -22,8 +50,25 @@ func NewPaymentRepository(db *gorm.DB) PaymentRepository {
 	return &paymentRepository{db}
 }
 
+// Create stores the payment. Points redeemed on it are taken from the user's
+// balance in the same transaction and ErrInsufficientPoints is returned when
+// the balance is too low.
 func (r *paymentRepository) Create(payment *models.Payment) error {
-	return r.db.Create(payment).Error
+	if payment.PointsUsed == 0 {
+		return r.db.Create(payment).Error
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return applyPoints(tx, &models.PointsTransaction{
+			UserID:      payment.UserID,
+			Type:        models.PointsTypeRedeem,
+			Points:      -payment.PointsUsed,
+			PaymentID:   &payment.ID,
+			Description: "Redeemed on payment",
+		}, false)
+	})
 }
 
 func (r *paymentRepository) FindByID(id uuid.UUID) (*models.Payment, error) {
@@ -36,12 +81,226 @@ func (r *paymentRepository) FindByID(id uuid.UUID) (*models.Payment, error) {
 
 func (r *paymentRepository) FindByExternalID(externalID string) (*models.Payment, error) {
 	var payment models.Payment
-	if err := r.db.First(&payment, "xendit_invoice_id = ?", externalID).Error; err != nil {
+	if err := r.db.First(&payment, "xendit_external_id = ?", externalID).Error; err != nil {
 		return nil, err
 	}
 	return &payment, nil
 }
 
+// FindByInvoiceID returns the payment of a gateway charge, QR code or virtual
+// account
+func (r *paymentRepository) FindByInvoiceID(invoiceID string) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.db.First(&payment, "xendit_invoice_id = ?", invoiceID).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) FindByRentalID(rentalID uuid.UUID) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("rental_id = ?", rentalID).Order("created_at").Find(&payments).Error
+	return payments, err
+}
+
+// FindWithFilter returns a page of the payments matching the filter, newest
+// first, with the total number of matches
+func (r *paymentRepository) FindWithFilter(filter PaymentFilter, limit, offset int) ([]models.Payment, int64, error) {
+	query := r.db.Model(&models.Payment{})
+	if filter.UserID != uuid.Nil {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.RentalID != uuid.Nil {
+		query = query.Where("rental_id = ?", filter.RentalID)
+	}
+	if filter.Status != "" {
+		query = query.Where("payment_status = ?", filter.Status)
+	}
+	if filter.Method != "" {
+		query = query.Where("payment_method = ?", filter.Method)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if !filter.PaidFrom.IsZero() {
+		query = query.Where("paid_at >= ?", filter.PaidFrom)
+	}
+	if !filter.PaidTo.IsZero() {
+		query = query.Where("paid_at < ?", filter.PaidTo)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var payments []models.Payment
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&payments).Error
+	return payments, total, err
+}
+
 func (r *paymentRepository) Update(payment *models.Payment) error {
 	return r.db.Save(payment).Error
 }
+
+// ExpirePendingByRentalID marks every PENDING payment of the rental as EXPIRED
+// and gives back the points redeemed on them
+func (r *paymentRepository) ExpirePendingByRentalID(rentalID uuid.UUID, expiredAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payments []models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("rental_id = ? AND payment_status = ?", rentalID, models.PaymentStatusPending).
+			Find(&payments).Error; err != nil {
+			return err
+		}
+
+		for i := range payments {
+			if err := tx.Model(&models.Payment{}).
+				Where("payment_id = ?", payments[i].ID).
+				Updates(map[string]interface{}{
+					"payment_status": models.PaymentStatusExpired,
+					"expired_at":     expiredAt,
+					"updated_at":     expiredAt,
+				}).Error; err != nil {
+				return err
+			}
+			if err := releasePoints(tx, &payments[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarkPaid stores the paid fields of the payment and moves it to COMPLETED
+// while it is still PENDING or EXPIRED. A payment that arrives after expiry is
+// still money received and has to be recorded, so the points released at
+// expiry are taken again even if the balance goes negative. The points earned
+// set on the payment are credited to the user, the security deposit it
+// collected is recorded as held and a late fee it pays is credited.
+func (r *paymentRepository) MarkPaid(payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("payment_id = ? AND payment_status IN ?", payment.ID, []string{models.PaymentStatusPending, models.PaymentStatusExpired}).
+			First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentNotPending
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Payment{}).
+			Where("payment_id = ?", payment.ID).
+			Updates(map[string]interface{}{
+				"payment_status":         models.PaymentStatusCompleted,
+				"xendit_paid_amount":     payment.XenditPaidAmount,
+				"xendit_payment_channel": payment.XenditPaymentChannel,
+				"xendit_payment_id":      payment.XenditPaymentID,
+				"points_earned":          payment.PointsEarned,
+				"paid_at":                payment.PaidAt,
+				"updated_at":             time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+
+		if stored.PaymentStatus == models.PaymentStatusExpired && stored.PointsUsed > 0 {
+			if err := applyPoints(tx, &models.PointsTransaction{
+				UserID:      stored.UserID,
+				Type:        models.PointsTypeRedeem,
+				Points:      -stored.PointsUsed,
+				PaymentID:   &stored.ID,
+				Description: "Redeemed on payment received after expiry",
+			}, true); err != nil {
+				return err
+			}
+		}
+		if payment.PointsEarned > 0 {
+			if err := applyPoints(tx, &models.PointsTransaction{
+				UserID:      stored.UserID,
+				Type:        models.PointsTypeEarn,
+				Points:      payment.PointsEarned,
+				PaymentID:   &stored.ID,
+				Description: "Earned on payment",
+			}, false); err != nil {
+				return err
+			}
+		}
+		if err := holdDeposit(tx, &stored); err != nil {
+			return err
+		}
+		if err := payLateFee(tx, &stored); err != nil {
+			return err
+		}
+
+		payment.PaymentStatus = models.PaymentStatusCompleted
+		return nil
+	})
+}
+
+// MarkFailed moves a PENDING payment to FAILED and gives back the points
+// redeemed on it. It returns ErrPaymentNotPending for any other payment.
+func (r *paymentRepository) MarkFailed(payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).
+			Where("payment_id = ? AND payment_status = ?", payment.ID, models.PaymentStatusPending).
+			Updates(map[string]interface{}{
+				"payment_status":    models.PaymentStatusFailed,
+				"xendit_payment_id": payment.XenditPaymentID,
+				"updated_at":        time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentNotPending
+		}
+		if err := releasePoints(tx, payment); err != nil {
+			return err
+		}
+		payment.PaymentStatus = models.PaymentStatusFailed
+		return nil
+	})
+}
+
+// MarkUnderpaid records the paid fields of a pending or expired payment that
+// received less than the amount due, without settling it
+func (r *paymentRepository) MarkUnderpaid(payment *models.Payment) error {
+	result := r.db.Model(&models.Payment{}).
+		Where("payment_id = ? AND payment_status IN ?", payment.ID, []string{models.PaymentStatusPending, models.PaymentStatusExpired}).
+		Updates(map[string]interface{}{
+			"payment_status":         models.PaymentStatusUnderpaid,
+			"xendit_paid_amount":     payment.XenditPaidAmount,
+			"xendit_payment_channel": payment.XenditPaymentChannel,
+			"xendit_payment_id":      payment.XenditPaymentID,
+			"paid_at":                payment.PaidAt,
+			"updated_at":             time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPaymentNotPending
+	}
+	payment.PaymentStatus = models.PaymentStatusUnderpaid
+	return nil
+}
+
+// releasePoints gives back the points redeemed on a payment that will never
+// be paid
+func releasePoints(tx *gorm.DB, payment *models.Payment) error {
+	if payment.PointsUsed == 0 {
+		return nil
+	}
+	return applyPoints(tx, &models.PointsTransaction{
+		UserID:      payment.UserID,
+		Type:        models.PointsTypeRelease,
+		Points:      payment.PointsUsed,
+		PaymentID:   &payment.ID,
+		Description: "Released from unpaid payment",
+	}, false)
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// errRollback undoes what an integration test wrote to the database
+var errRollback = errors.New("rollback")
+
+// withTestDB runs fn in a transaction on the database of TEST_DATABASE_DSN,
+// migrated with query.sql, and rolls it back afterwards. The test is skipped
+// when no database is configured.
+func withTestDB(t *testing.T, fn func(tx *gorm.DB)) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		fn(tx)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+}
+
+func TestPaymentRepository_CreateLateFeePaymentOnPaidRental(t *testing.T) {
+	withTestDB(t, func(tx *gorm.DB) {
+		var role models.Role
+		require.NoError(t, tx.First(&role).Error)
+		suffix := uuid.NewString()[:8]
+		user := &models.User{
+			Username: "late-fee-" + suffix,
+			Email:    "late-fee-" + suffix + "@example.com",
+			Password: "x",
+			FullName: "Late Fee",
+			RoleID:   role.ID,
+		}
+		require.NoError(t, tx.Create(user).Error)
+
+		now := time.Now()
+		rental := &models.Rental{
+			UserID:    user.ID,
+			StartDate: now.AddDate(0, 0, -5),
+			EndDate:   now.AddDate(0, 0, -2),
+			TotalCost: models.NewMoney(300000),
+			Status:    models.RentalStatusOverdue,
+		}
+		require.NoError(t, tx.Omit("Items").Create(rental).Error)
+
+		repo := NewPaymentRepository(tx)
+		paid := &models.Payment{
+			ID:            uuid.New(),
+			RentalID:      rental.ID,
+			UserID:        user.ID,
+			Amount:        rental.TotalCost,
+			PaymentMethod: models.PaymentMethodEWallet,
+			PaymentStatus: models.PaymentStatusCompleted,
+		}
+		require.NoError(t, repo.Create(paid))
+
+		fee := &models.LateFee{
+			ID:       uuid.New(),
+			RentalID: rental.ID,
+			UserID:   user.ID,
+			Status:   models.LateFeeStatusAccruing,
+			DaysLate: 2,
+			DailyFee: models.NewMoney(100000),
+			Amount:   models.NewMoney(200000),
+		}
+		require.NoError(t, tx.Create(fee).Error)
+
+		lateFeePayment := &models.Payment{
+			ID:            uuid.New(),
+			RentalID:      rental.ID,
+			UserID:        user.ID,
+			Amount:        fee.Outstanding(),
+			PaymentMethod: models.PaymentMethodEWallet,
+			PaymentStatus: models.PaymentStatusPending,
+			LateFeeID:     &fee.ID,
+		}
+		assert.NoError(t, repo.Create(lateFeePayment))
+
+		// A second rental payment is still refused
+		again := *paid
+		again.ID = uuid.New()
+		again.PaymentStatus = models.PaymentStatusPending
+		assert.Error(t, tx.Transaction(func(tx *gorm.DB) error {
+			return NewPaymentRepository(tx).Create(&again)
+		}))
+	})
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PromotionRepository interface {
+	Create(promotion *models.Promotion) error
+	FindByID(id uuid.UUID) (*models.Promotion, error)
+	FindByCode(code string) (*models.Promotion, error)
+	FindAll(limit, offset int) ([]models.Promotion, int64, error)
+	Update(promotion *models.Promotion) error
+	Delete(id uuid.UUID) error
+	CountRedemptions(promotionID, userID uuid.UUID) (total int64, byUser int64, err error)
+}
+
+var (
+	// ErrPromotionUsedUp is returned when a promotion reached its usage limit
+	ErrPromotionUsedUp = errors.New("promotion has reached its usage limit")
+	// ErrPromotionUserLimit is returned when the user already used the
+	// promotion as often as allowed
+	ErrPromotionUserLimit = errors.New("promotion has already been used by this user")
+	// ErrPromotionInUse is returned when deleting a promotion that was
+	// redeemed on a rental
+	ErrPromotionInUse = errors.New("promotion has been redeemed")
+)
+
+type promotionRepository struct {
+	db *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) PromotionRepository {
+	return &promotionRepository{db}
+}
+
+func (r *promotionRepository) Create(promotion *models.Promotion) error {
+	return r.db.Create(promotion).Error
+}
+
+func (r *promotionRepository) FindByID(id uuid.UUID) (*models.Promotion, error) {
+	var promotion models.Promotion
+	if err := r.db.First(&promotion, "promotion_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// FindByCode looks a promotion up by its code, ignoring case
+func (r *promotionRepository) FindByCode(code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	if err := r.db.First(&promotion, "code = ?", strings.ToUpper(strings.TrimSpace(code))).Error; err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// FindAll returns a page of promotions, newest first, with the total count
+func (r *promotionRepository) FindAll(limit, offset int) ([]models.Promotion, int64, error) {
+	var promotions []models.Promotion
+	var total int64
+	query := r.db.Model(&models.Promotion{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&promotions).Error
+	return promotions, total, err
+}
+
+func (r *promotionRepository) Update(promotion *models.Promotion) error {
+	promotion.UpdatedAt = time.Now()
+	return r.db.Save(promotion).Error
+}
+
+// Delete removes a promotion that was never redeemed. Redeemed promotions
+// are kept for the rentals that used them and can be deactivated instead.
+func (r *promotionRepository) Delete(id uuid.UUID) error {
+	var redemptions int64
+	if err := r.db.Model(&models.PromotionRedemption{}).Where("promotion_id = ?", id).Count(&redemptions).Error; err != nil {
+		return err
+	}
+	if redemptions > 0 {
+		return ErrPromotionInUse
+	}
+	return r.db.Delete(&models.Promotion{}, "promotion_id = ?", id).Error
+}
+
+// CountRedemptions returns how often the promotion was used in total and by
+// the user, leaving out cancelled and expired rentals
+func (r *promotionRepository) CountRedemptions(promotionID, userID uuid.UUID) (int64, int64, error) {
+	return countRedemptions(r.db, promotionID, userID)
+}
+
+func countRedemptions(tx *gorm.DB, promotionID, userID uuid.UUID) (int64, int64, error) {
+	schema := os.Getenv("DB_SCHEMA")
+	var counts struct {
+		Total  int64
+		ByUser int64
+	}
+	err := tx.Model(&models.PromotionRedemption{}).
+		Select("COUNT(*) AS total, COUNT(*) FILTER (WHERE promotion_redemptions.user_id = ?) AS by_user", userID).
+		Joins("JOIN \""+schema+"\".rentals ON rentals.rental_id = promotion_redemptions.rental_id").
+		Where("promotion_redemptions.promotion_id = ? AND rentals.status NOT IN ?", promotionID,
+			[]string{models.RentalStatusCancelled, models.RentalStatusExpired}).
+		Scan(&counts).Error
+	return counts.Total, counts.ByUser, err
+}
+
+// redeemPromotion records the promotion of the rental's price inside tx. The
+// promotion row is locked so concurrent bookings cannot both take the last use.
+func redeemPromotion(tx *gorm.DB, rental *models.Rental) error {
+	breakdown := rental.PriceBreakdown
+	if breakdown == nil || breakdown.PromotionID == nil {
+		return nil
+	}
+
+	var promotion models.Promotion
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&promotion, "promotion_id = ?", *breakdown.PromotionID).Error; err != nil {
+		return err
+	}
+	total, byUser, err := countRedemptions(tx, promotion.ID, rental.UserID)
+	if err != nil {
+		return err
+	}
+	if promotion.UsageLimit > 0 && total >= int64(promotion.UsageLimit) {
+		return ErrPromotionUsedUp
+	}
+	if promotion.PerUserLimit > 0 && byUser >= int64(promotion.PerUserLimit) {
+		return ErrPromotionUserLimit
+	}
+
+	return tx.Create(&models.PromotionRedemption{
+		PromotionID: promotion.ID,
+		UserID:      rental.UserID,
+		RentalID:    rental.ID,
+		Amount:      breakdown.Discount,
+	}).Error
+}
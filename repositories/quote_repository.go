@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type QuoteRepository interface {
+	Create(quote *models.Quote) error
+	FindByID(id uuid.UUID) (*models.Quote, error)
+	Book(quote *models.Quote, rental *models.Rental) error
+}
+
+// ErrQuoteNotActive is returned when booking a quote that was already booked
+// or has expired.
+var ErrQuoteNotActive = errors.New("quote is no longer active")
+
+type quoteRepository struct {
+	db *gorm.DB
+}
+
+func NewQuoteRepository(db *gorm.DB) QuoteRepository {
+	return &quoteRepository{db}
+}
+
+func (r *quoteRepository) Create(quote *models.Quote) error {
+	quote.ID = uuid.New()
+	quote.Status = models.QuoteStatusActive
+	quote.CreatedAt = time.Now()
+	return r.db.Create(quote).Error
+}
+
+func (r *quoteRepository) FindByID(id uuid.UUID) (*models.Quote, error) {
+	var quote models.Quote
+	err := r.db.First(&quote, "quote_id = ?", id).Error
+	return &quote, err
+}
+
+// Book creates the rental and marks the quote as booked in one transaction.
+// Only an active quote that has not expired can be booked, and only once.
+func (r *quoteRepository) Book(quote *models.Quote, rental *models.Rental) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := createRental(tx, rental); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Quote{}).
+			Where("quote_id = ? AND status = ? AND expires_at > ?", quote.ID, models.QuoteStatusActive, time.Now()).
+			Updates(map[string]interface{}{"status": models.QuoteStatusBooked, "rental_id": rental.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrQuoteNotActive
+		}
+
+		quote.Status = models.QuoteStatusBooked
+		quote.RentalID = &rental.ID
+		return nil
+	})
+}
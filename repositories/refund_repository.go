@@ -0,0 +1,258 @@
+package repositories
+
+import (
+	"errors"
+	"invitified-go/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundRepository interface {
+	Create(refund *models.Refund) error
+	FindByID(id uuid.UUID) (*models.Refund, error)
+	FindByPaymentID(paymentID uuid.UUID) ([]models.Refund, error)
+	SetXenditRefundID(refund *models.Refund) error
+	MarkSucceeded(refund *models.Refund, payment *models.Payment) error
+	MarkFailed(refund *models.Refund) error
+}
+
+var (
+	// ErrPaymentNotRefundable is returned when refunding a payment that holds
+	// no money, such as a pending or fully refunded one.
+	ErrPaymentNotRefundable = errors.New("payment cannot be refunded")
+	// ErrRefundExceedsPayment is returned when a refund would bring the total
+	// refunded above the amount paid.
+	ErrRefundExceedsPayment = errors.New("refunds would exceed the amount paid")
+	// ErrRefundNotPending is returned when settling a refund that already
+	// succeeded or failed.
+	ErrRefundNotPending = errors.New("refund is no longer pending")
+	// ErrRefundExceedsDeposit is returned when a deposit refund would give
+	// back more than the rental's deposit still holds.
+	ErrRefundExceedsDeposit = errors.New("refund exceeds the deposit held")
+)
+
+type refundRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundRepository(db *gorm.DB) RefundRepository {
+	return &refundRepository{db}
+}
+
+// Create stores a pending refund for its payment. The payment is locked while
+// the refunds that are pending or succeeded are added up, so concurrent
+// refunds can never exceed the amount paid. A refund without an amount
+// refunds whatever is left. The points used on the payment are returned and
+// the points earned on it taken back in proportion to the amount, the last
+// refund settling the remainder. Deposit refunds move no points and cannot
+// exceed the deposit held less the deposit refunds already pending.
+func (r *refundRepository) Create(refund *models.Refund) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&payment, "payment_id = ?", refund.PaymentID).Error; err != nil {
+			return err
+		}
+		if !refundable(payment.PaymentStatus) {
+			return ErrPaymentNotRefundable
+		}
+
+		var reserved struct {
+			Amount   models.Money
+			Points   int
+			Clawback int
+		}
+		if err := tx.Model(&models.Refund{}).
+			Select("COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(points_returned), 0) AS points, COALESCE(SUM(points_clawback), 0) AS clawback").
+			Where("payment_id = ? AND status IN ?", payment.ID, []string{models.RefundStatusPending, models.RefundStatusSucceeded}).
+			Scan(&reserved).Error; err != nil {
+			return err
+		}
+
+		paid := payment.PaidAmount()
+		remaining := paid - reserved.Amount
+		if refund.Amount == 0 {
+			refund.Amount = remaining
+		}
+		amount := refund.Amount
+		if amount <= 0 || amount > remaining {
+			return ErrRefundExceedsPayment
+		}
+
+		if refund.Deposit {
+			held, err := depositBalance(tx, payment.RentalID)
+			if err != nil {
+				return err
+			}
+			pending, err := pendingDepositRefunds(tx, payment.RentalID)
+			if err != nil {
+				return err
+			}
+			if amount > held-pending {
+				return ErrRefundExceedsDeposit
+			}
+		}
+
+		switch {
+		case refund.Deposit:
+			refund.PointsReturned, refund.PointsClawback = 0, 0
+		case amount == remaining:
+			refund.PointsReturned = payment.PointsUsed - reserved.Points
+			refund.PointsClawback = payment.PointsEarned - reserved.Clawback
+		default:
+			refund.PointsReturned = int(int64(payment.PointsUsed) * int64(amount) / int64(paid))
+			refund.PointsClawback = int(int64(payment.PointsEarned) * int64(amount) / int64(paid))
+		}
+
+		now := time.Now()
+		refund.ID = uuid.New()
+		refund.UserID = payment.UserID
+		refund.Status = models.RefundStatusPending
+		refund.CreatedAt = now
+		refund.UpdatedAt = now
+		return tx.Create(refund).Error
+	})
+}
+
+func (r *refundRepository) FindByID(id uuid.UUID) (*models.Refund, error) {
+	var refund models.Refund
+	if err := r.db.First(&refund, "refund_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *refundRepository) FindByPaymentID(paymentID uuid.UUID) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := r.db.Where("payment_id = ?", paymentID).Order("created_at").Find(&refunds).Error
+	return refunds, err
+}
+
+// SetXenditRefundID stores the gateway's ID of the refund without touching
+// its status, which a callback may already have changed.
+func (r *refundRepository) SetXenditRefundID(refund *models.Refund) error {
+	return r.db.Model(&models.Refund{}).
+		Where("refund_id = ?", refund.ID).
+		Update("xendit_refund_id", refund.XenditRefundID).Error
+}
+
+// MarkSucceeded records a pending refund as paid out. The refunded amount and
+// status of the payment are updated and the refund's points are returned and
+// taken back in the same transaction, a deposit refund releases the deposit.
+// The payment is refreshed with the stored values.
+func (r *refundRepository) MarkSucceeded(refund *models.Refund, payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Refund{}).
+			Where("refund_id = ? AND status = ?", refund.ID, models.RefundStatusPending).
+			Updates(map[string]interface{}{
+				"status":           models.RefundStatusSucceeded,
+				"xendit_refund_id": refund.XenditRefundID,
+				"refunded_at":      now,
+				"updated_at":       now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundNotPending
+		}
+
+		var stored models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&stored, "payment_id = ?", refund.PaymentID).Error; err != nil {
+			return err
+		}
+		refunded := stored.RefundedAmount + refund.Amount
+		status := models.PaymentStatusPartiallyRefunded
+		if refunded >= stored.PaidAmount() {
+			status = models.PaymentStatusRefunded
+		}
+		stored.RefundedAmount = refunded
+		stored.PaymentStatus = status
+		stored.UpdatedAt = now
+		if err := tx.Model(&models.Payment{}).
+			Where("payment_id = ?", stored.ID).
+			Updates(map[string]interface{}{
+				"refunded_amount": stored.RefundedAmount,
+				"payment_status":  stored.PaymentStatus,
+				"updated_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+		if refund.Deposit {
+			if err := releaseDeposit(tx, refund, &stored); err != nil {
+				return err
+			}
+		}
+
+		if refund.PointsReturned > 0 {
+			if err := applyPoints(tx, &models.PointsTransaction{
+				UserID:      refund.UserID,
+				Type:        models.PointsTypeRefund,
+				Points:      refund.PointsReturned,
+				PaymentID:   &refund.PaymentID,
+				RefundID:    &refund.ID,
+				Description: "Returned with refund",
+			}, false); err != nil {
+				return err
+			}
+		}
+		// Earned points may already be spent, so the balance can go negative
+		if refund.PointsClawback > 0 {
+			if err := applyPoints(tx, &models.PointsTransaction{
+				UserID:      refund.UserID,
+				Type:        models.PointsTypeClawback,
+				Points:      -refund.PointsClawback,
+				PaymentID:   &refund.PaymentID,
+				RefundID:    &refund.ID,
+				Description: "Taken back with refund",
+			}, true); err != nil {
+				return err
+			}
+		}
+
+		refund.Status = models.RefundStatusSucceeded
+		refund.RefundedAt = &now
+		refund.UpdatedAt = now
+		if payment != nil {
+			*payment = stored
+		}
+		return nil
+	})
+}
+
+// MarkFailed records that the gateway rejected a pending refund. The amount
+// it reserved becomes available to refund again.
+func (r *refundRepository) MarkFailed(refund *models.Refund) error {
+	now := time.Now()
+	result := r.db.Model(&models.Refund{}).
+		Where("refund_id = ? AND status = ?", refund.ID, models.RefundStatusPending).
+		Updates(map[string]interface{}{
+			"status":           models.RefundStatusFailed,
+			"xendit_refund_id": refund.XenditRefundID,
+			"failure_code":     refund.FailureCode,
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefundNotPending
+	}
+	refund.Status = models.RefundStatusFailed
+	refund.UpdatedAt = now
+	return nil
+}
+
+func refundable(status string) bool {
+	for _, s := range models.PaymentRefundableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
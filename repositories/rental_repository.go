@@ -1,24 +1,85 @@
 package repositories
 
 import (
+	"errors"
 	"invitified-go/models"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RentalRepository interface {
 	Create(rental *models.Rental) error
 	FindByID(id uuid.UUID) (*models.Rental, error)
 	FindAll() ([]models.Rental, error)
+	FindWithFilter(filter RentalFilter, limit, offset int) ([]models.Rental, int64, error)
 	Update(rental *models.Rental) error
 	Delete(id uuid.UUID) error
 	CheckOverlap(equipmentID uuid.UUID, startDate, endDate time.Time) (bool, error)
+	SumBookedQuantity(equipmentID uuid.UUID, startDate, endDate time.Time) (int, error)
+	FindBookedPeriods(equipmentID uuid.UUID, startDate, endDate time.Time) ([]BookedPeriod, error)
 	UpdateStatus(id uuid.UUID, status string) error
+	Transition(id uuid.UUID, fromStatus string, updates map[string]interface{}) error
+	FindPendingCreatedBefore(before time.Time, limit int) ([]models.Rental, error)
+	FindEndedBefore(before time.Time) ([]models.Rental, error)
+
+	CreateExtension(extension *models.RentalExtension, payment *models.Payment) error
+	FindExtensionByID(id uuid.UUID) (*models.RentalExtension, error)
+	FindPendingExtension(rentalID uuid.UUID) (*models.RentalExtension, error)
+	ApplyExtension(extension *models.RentalExtension) error
+	ExpireExtensionsCreatedBefore(before time.Time) (int64, error)
+}
+
+// RentalFilter narrows down a rental listing. Zero values are ignored.
+type RentalFilter struct {
+	UserID      uuid.UUID
+	EquipmentID uuid.UUID
+	Status      string
+	// From and To select rentals whose period overlaps the window
+	From time.Time
+	To   time.Time
+	// Sort is a column name, prefixed with "-" for descending order
+	Sort string
+}
+
+// BookedPeriod is a stretch of time during which a booking holds units of a
+// piece of equipment
+type BookedPeriod struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Quantity  int
+}
+
+// rentalSortColumns lists the columns a rental listing may be sorted by
+var rentalSortColumns = map[string]bool{
+	"start_date": true,
+	"end_date":   true,
+	"created_at": true,
+	"total_cost": true,
 }
 
+// ValidRentalSort reports whether the sort option can be used in a RentalFilter
+func ValidRentalSort(sort string) bool {
+	return sort == "" || rentalSortColumns[strings.TrimPrefix(sort, "-")]
+}
+
+// ErrRentalStatusChanged is returned when a rental no longer has the status a
+// transition was started from.
+var ErrRentalStatusChanged = errors.New("rental status was changed by another request")
+
+// ErrExtensionNotPending is returned when applying an extension that was
+// already applied or expired.
+var ErrExtensionNotPending = errors.New("rental extension is no longer pending")
+
+// ErrInsufficientStock is returned when a booking would hold more units of
+// equipment than are free, usually because another request booked them after
+// availability was checked.
+var ErrInsufficientStock = errors.New("equipment is no longer available for the requested dates")
+
 type rentalRepository struct {
 	db *gorm.DB
 }
@@ -29,54 +90,85 @@ func NewRentalRepository(db *gorm.DB) RentalRepository {
 
 func (r *rentalRepository) Create(rental *models.Rental) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		// Generate IDs
-		rental.ID = uuid.New()
-		rental.Status = "PENDING"
-
-		// Store equipment names before creating items
-		equipmentNames := make(map[uuid.UUID]string)
-		for _, item := range rental.Items {
-			var equipment models.Equipment
-			if err := tx.First(&equipment, "equipment_id = ?", item.EquipmentID).Error; err != nil {
-				return err
-			}
-			equipmentNames[item.EquipmentID] = equipment.Name
-		}
-
-		// Create rental
-		if err := tx.Create(&models.Rental{
-			ID:        rental.ID,
-			UserID:    rental.UserID,
-			StartDate: rental.StartDate,
-			EndDate:   rental.EndDate,
-			TotalCost: rental.TotalCost,
-			Status:    rental.Status,
-		}).Error; err != nil {
+		return createRental(tx, rental)
+	})
+}
+
+// createRental stores a new PENDING rental and its items inside tx
+func createRental(tx *gorm.DB, rental *models.Rental) error {
+	// Generate IDs
+	rental.ID = uuid.New()
+	rental.Status = "PENDING"
+	rental.CreatedAt = time.Now()
+
+	// Copy the equipment name and price onto each item, looking up the name
+	// for items that were not priced
+	rental.SnapshotPrices()
+	if err := reserveStock(tx, rental.Items, rental.StartDate, rental.EndDate); err != nil {
+		return err
+	}
+	for i, item := range rental.Items {
+		if item.EquipmentName != "" {
+			continue
+		}
+		var equipment models.Equipment
+		if err := tx.First(&equipment, "equipment_id = ?", item.EquipmentID).Error; err != nil {
 			return err
 		}
+		rental.Items[i].EquipmentName = equipment.Name
+	}
 
-		// Create rental items
-		items := make([]models.RentalItem, len(rental.Items))
-		for i, item := range rental.Items {
-			items[i] = models.RentalItem{
-				ID:            uuid.New(),
-				RentalID:      rental.ID,
-				EquipmentID:   item.EquipmentID,
-				Quantity:      item.Quantity,
-				EquipmentName: equipmentNames[item.EquipmentID],
-			}
-		}
+	// Create rental
+	if err := tx.Create(&models.Rental{
+		ID:        rental.ID,
+		UserID:    rental.UserID,
+		StartDate: rental.StartDate,
+		EndDate:   rental.EndDate,
+		TotalCost: rental.TotalCost,
+		Subtotal:  rental.Subtotal,
+		TaxAmount: rental.TaxAmount,
+		Status:    rental.Status,
+		CreatedAt: rental.CreatedAt,
 
-		// Batch create items
-		if err := tx.Create(&items).Error; err != nil {
-			return err
+		Currency:      rental.Currency.OrDefault(),
+		ExchangeRate:  rental.ExchangeRate,
+		DepositAmount: rental.DepositAmount,
+
+		PriceBreakdown: rental.PriceBreakdown,
+		PromoCode:      rental.PromoCode,
+		DiscountAmount: rental.DiscountAmount,
+	}).Error; err != nil {
+		return err
+	}
+	if err := redeemPromotion(tx, rental); err != nil {
+		return err
+	}
+
+	// Create rental items
+	items := make([]models.RentalItem, len(rental.Items))
+	for i, item := range rental.Items {
+		items[i] = models.RentalItem{
+			ID:            uuid.New(),
+			RentalID:      rental.ID,
+			EquipmentID:   item.EquipmentID,
+			Quantity:      item.Quantity,
+			EquipmentName: item.EquipmentName,
+			UnitPrice:     item.UnitPrice,
+			Days:          item.Days,
+			LineTotal:     item.LineTotal,
 		}
+	}
 
-		// Update rental object with created items
-		rental.Items = items
-		return nil
-	})
+	// Batch create items
+	if err := tx.Create(&items).Error; err != nil {
+		return err
+	}
+
+	// Update rental object with created items
+	rental.Items = items
+	return nil
 }
+
 func (r *rentalRepository) FindByID(id uuid.UUID) (*models.Rental, error) {
 	var rental models.Rental
 	err := r.db.Preload("Items").First(&rental, "rental_id = ?", id).Error
@@ -89,6 +181,44 @@ func (r *rentalRepository) FindAll() ([]models.Rental, error) {
 	return rentals, err
 }
 
+func (r *rentalRepository) FindWithFilter(filter RentalFilter, limit, offset int) ([]models.Rental, int64, error) {
+	query := r.db.Model(&models.Rental{})
+	if filter.UserID != uuid.Nil {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.EquipmentID != uuid.Nil {
+		schema := os.Getenv("DB_SCHEMA")
+		query = query.Where("rental_id IN (SELECT rental_id FROM \""+schema+"\".rental_items WHERE equipment_id = ?)", filter.EquipmentID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("end_date > ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("start_date < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "created_at DESC"
+	if ValidRentalSort(filter.Sort) && filter.Sort != "" {
+		if strings.HasPrefix(filter.Sort, "-") {
+			order = strings.TrimPrefix(filter.Sort, "-") + " DESC"
+		} else {
+			order = filter.Sort + " ASC"
+		}
+	}
+
+	var rentals []models.Rental
+	err := query.Preload("Items").Order(order).Limit(limit).Offset(offset).Find(&rentals).Error
+	return rentals, total, err
+}
+
 func (r *rentalRepository) Update(rental *models.Rental) error {
 	return r.db.Save(rental).Error
 }
@@ -101,6 +231,41 @@ func (r *rentalRepository) UpdateStatus(id uuid.UUID, status string) error {
 	return r.db.Model(&models.Rental{}).Where("rental_id = ?", id).Update("status", status).Error
 }
 
+// Transition applies the updates only while the rental still has fromStatus,
+// so two concurrent transitions cannot both succeed.
+func (r *rentalRepository) Transition(id uuid.UUID, fromStatus string, updates map[string]interface{}) error {
+	result := r.db.Model(&models.Rental{}).Where("rental_id = ? AND status = ?", id, fromStatus).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRentalStatusChanged
+	}
+	return nil
+}
+
+// FindPendingCreatedBefore returns the oldest PENDING rentals created before
+// the given time.
+func (r *rentalRepository) FindPendingCreatedBefore(before time.Time, limit int) ([]models.Rental, error) {
+	var rentals []models.Rental
+	err := r.db.Where("status = ? AND created_at < ?", models.RentalStatusPending, before).
+		Order("created_at").
+		Limit(limit).
+		Find(&rentals).Error
+	return rentals, err
+}
+
+// FindEndedBefore returns the PICKED_UP and OVERDUE rentals whose end date is
+// before the given time, with their items
+func (r *rentalRepository) FindEndedBefore(before time.Time) ([]models.Rental, error) {
+	var rentals []models.Rental
+	err := r.db.Preload("Items").
+		Where("status IN ? AND end_date < ?", []string{models.RentalStatusPickedUp, models.RentalStatusOverdue}, before).
+		Order("end_date").
+		Find(&rentals).Error
+	return rentals, err
+}
+
 func (r *rentalRepository) CheckOverlap(equipmentID uuid.UUID, startDate, endDate time.Time) (bool, error) {
 	var count int64
 	schema := os.Getenv("DB_SCHEMA")
@@ -110,3 +275,215 @@ func (r *rentalRepository) CheckOverlap(equipmentID uuid.UUID, startDate, endDat
 		Count(&count).Error
 	return count > 0, err
 }
+
+// notReturnedSQL matches rentals past their end date whose units have not
+// been returned. They overlap every later window and FindBookedPeriods
+// returns them as ending with the window.
+const notReturnedSQL = "(rentals.status IN ? AND rentals.end_date <= now())"
+
+// SumBookedQuantity returns how many units of the equipment are held by
+// rentals overlapping the given window, including the extra days of pending
+// extensions. Picked up rentals past their end date hold their units until
+// they are returned.
+func (r *rentalRepository) SumBookedQuantity(equipmentID uuid.UUID, startDate, endDate time.Time) (int, error) {
+	return sumBookedQuantity(r.db, equipmentID, startDate, endDate)
+}
+
+func sumBookedQuantity(db *gorm.DB, equipmentID uuid.UUID, startDate, endDate time.Time) (int, error) {
+	var booked, extended int
+	schema := os.Getenv("DB_SCHEMA")
+	err := db.Model(&models.Rental{}).
+		Select("COALESCE(SUM(rental_items.quantity), 0)").
+		Joins("JOIN \""+schema+"\".rental_items ON rentals.rental_id = rental_items.rental_id").
+		Where("rental_items.equipment_id = ? AND rentals.status IN ? AND rentals.start_date < ? AND (rentals.end_date > ? OR "+notReturnedSQL+")", equipmentID, models.RentalHoldingStatuses, endDate, startDate, models.RentalOutStatuses).
+		Scan(&booked).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.Model(&models.RentalExtension{}).
+		Select("COALESCE(SUM(rental_items.quantity), 0)").
+		Joins("JOIN \""+schema+"\".rentals ON rentals.rental_id = rental_extensions.rental_id").
+		Joins("JOIN \""+schema+"\".rental_items ON rentals.rental_id = rental_items.rental_id").
+		Where("rental_items.equipment_id = ? AND rental_extensions.status = ? AND rentals.status IN ? AND rental_extensions.new_end_date > ? AND rental_extensions.old_end_date < ?", equipmentID, models.ExtensionStatusPending, models.RentalHoldingStatuses, startDate, endDate).
+		Scan(&extended).Error
+	return booked + extended, err
+}
+
+// FindBookedPeriods returns the bookings of the equipment overlapping the
+// window, the same ones SumBookedQuantity adds up. Pending extensions are
+// returned as their extra days.
+func (r *rentalRepository) FindBookedPeriods(equipmentID uuid.UUID, startDate, endDate time.Time) ([]BookedPeriod, error) {
+	var booked, extended []BookedPeriod
+	schema := os.Getenv("DB_SCHEMA")
+	err := r.db.Model(&models.Rental{}).
+		Select("rentals.start_date, CASE WHEN "+notReturnedSQL+" THEN GREATEST(rentals.end_date, ?) ELSE rentals.end_date END AS end_date, rental_items.quantity", models.RentalOutStatuses, endDate).
+		Joins("JOIN \""+schema+"\".rental_items ON rentals.rental_id = rental_items.rental_id").
+		Where("rental_items.equipment_id = ? AND rentals.status IN ? AND rentals.start_date < ? AND (rentals.end_date > ? OR "+notReturnedSQL+")", equipmentID, models.RentalHoldingStatuses, endDate, startDate, models.RentalOutStatuses).
+		Scan(&booked).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Model(&models.RentalExtension{}).
+		Select("rental_extensions.old_end_date AS start_date, rental_extensions.new_end_date AS end_date, rental_items.quantity").
+		Joins("JOIN \""+schema+"\".rentals ON rentals.rental_id = rental_extensions.rental_id").
+		Joins("JOIN \""+schema+"\".rental_items ON rentals.rental_id = rental_items.rental_id").
+		Where("rental_items.equipment_id = ? AND rental_extensions.status = ? AND rentals.status IN ? AND rental_extensions.new_end_date > ? AND rental_extensions.old_end_date < ?", equipmentID, models.ExtensionStatusPending, models.RentalHoldingStatuses, startDate, endDate).
+		Scan(&extended).Error
+	return append(booked, extended...), err
+}
+
+// reserveStock locks the equipment of the items and checks under the lock
+// that the bookings overlapping the window leave enough units for them. A
+// concurrent booking of the same equipment waits until tx ends, so two
+// bookings cannot both take the last unit.
+func reserveStock(tx *gorm.DB, items []models.RentalItem, startDate, endDate time.Time) error {
+	requested := make(map[uuid.UUID]int)
+	var ids []uuid.UUID
+	for _, item := range items {
+		if _, seen := requested[item.EquipmentID]; !seen {
+			ids = append(ids, item.EquipmentID)
+		}
+		requested[item.EquipmentID] += item.Quantity
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Locked in the same order by every booking so they cannot deadlock
+	var equipment []models.Equipment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("equipment_id IN ?", ids).
+		Order("equipment_id").
+		Find(&equipment).Error; err != nil {
+		return err
+	}
+	if len(equipment) != len(ids) {
+		return gorm.ErrRecordNotFound
+	}
+
+	for _, eq := range equipment {
+		if !eq.IsAvailable {
+			return ErrInsufficientStock
+		}
+		booked, err := sumBookedQuantity(tx, eq.ID, startDate, endDate)
+		if err != nil {
+			return err
+		}
+		if booked+requested[eq.ID] > eq.StockQuantity {
+			return ErrInsufficientStock
+		}
+	}
+	return nil
+}
+
+// CreateExtension stores the extension together with the pending payment
+// that has to be settled before it is applied, or without one when there is
+// nothing to pay. The extra days are checked against the stock under lock,
+// see reserveStock.
+func (r *rentalRepository) CreateExtension(extension *models.RentalExtension, payment *models.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var items []models.RentalItem
+		if err := tx.Where("rental_id = ?", extension.RentalID).Find(&items).Error; err != nil {
+			return err
+		}
+		if err := reserveStock(tx, items, extension.OldEndDate, extension.NewEndDate); err != nil {
+			return err
+		}
+
+		extension.ID = uuid.New()
+		extension.Status = models.ExtensionStatusPending
+		extension.CreatedAt = time.Now()
+		if err := tx.Create(extension).Error; err != nil {
+			return err
+		}
+		if payment == nil {
+			return nil
+		}
+
+		payment.ExtensionID = &extension.ID
+		return tx.Create(payment).Error
+	})
+}
+
+func (r *rentalRepository) FindExtensionByID(id uuid.UUID) (*models.RentalExtension, error) {
+	var extension models.RentalExtension
+	err := r.db.First(&extension, "rental_extension_id = ?", id).Error
+	return &extension, err
+}
+
+func (r *rentalRepository) FindPendingExtension(rentalID uuid.UUID) (*models.RentalExtension, error) {
+	var extension models.RentalExtension
+	err := r.db.Where("rental_id = ? AND status = ?", rentalID, models.ExtensionStatusPending).First(&extension).Error
+	return &extension, err
+}
+
+// ApplyExtension moves the rental's end date and adds the extra cost, as long
+// as the extension is still pending and the rental has not been changed.
+func (r *rentalRepository) ApplyExtension(extension *models.RentalExtension) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RentalExtension{}).
+			Where("rental_extension_id = ? AND status = ?", extension.ID, models.ExtensionStatusPending).
+			Update("status", models.ExtensionStatusApplied)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrExtensionNotPending
+		}
+
+		result = tx.Model(&models.Rental{}).
+			Where("rental_id = ? AND end_date = ? AND status IN ?", extension.RentalID, extension.OldEndDate, models.RentalHoldingStatuses).
+			Updates(map[string]interface{}{
+				"end_date":   extension.NewEndDate,
+				"total_cost": gorm.Expr("total_cost + ?", extension.ExtraCost),
+				"subtotal":   gorm.Expr("subtotal + ?", extension.ExtraSubtotal),
+				"tax_amount": gorm.Expr("tax_amount + ?", extension.ExtraTax),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRentalStatusChanged
+		}
+
+		extension.Status = models.ExtensionStatusApplied
+		return nil
+	})
+}
+
+// ExpireExtensionsCreatedBefore expires unpaid extensions older than the given
+// time along with their pending payments.
+func (r *rentalRepository) ExpireExtensionsCreatedBefore(before time.Time) (int64, error) {
+	var expired int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Model(&models.RentalExtension{}).
+			Where("status = ? AND created_at < ?", models.ExtensionStatusPending, before).
+			Pluck("rental_extension_id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.RentalExtension{}).
+			Where("rental_extension_id IN ? AND status = ?", ids, models.ExtensionStatusPending).
+			Update("status", models.ExtensionStatusExpired)
+		if result.Error != nil {
+			return result.Error
+		}
+		expired = result.RowsAffected
+
+		return tx.Model(&models.Payment{}).
+			Where("extension_id IN ? AND payment_status = ?", ids, models.PaymentStatusPending).
+			Updates(map[string]interface{}{
+				"payment_status": models.PaymentStatusExpired,
+				"expired_at":     now,
+				"updated_at":     now,
+			}).Error
+	})
+	return expired, err
+}
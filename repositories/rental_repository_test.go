@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"invitified-go/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRentalRepository_CreateRefusesTakenStock(t *testing.T) {
+	withTestDB(t, func(tx *gorm.DB) {
+		var role models.Role
+		require.NoError(t, tx.First(&role).Error)
+		suffix := uuid.NewString()[:8]
+		user := &models.User{
+			Username: "stock-" + suffix,
+			Email:    "stock-" + suffix + "@example.com",
+			Password: "x",
+			FullName: "Stock",
+			RoleID:   role.ID,
+		}
+		require.NoError(t, tx.Create(user).Error)
+		equipment := &models.Equipment{
+			ID:            uuid.New(),
+			Name:          "Projector",
+			Slug:          "projector-" + suffix,
+			StockQuantity: 1,
+			RentalPrice:   models.NewMoney(100000),
+			IsAvailable:   true,
+		}
+		require.NoError(t, tx.Create(equipment).Error)
+
+		repo := NewRentalRepository(tx)
+		start := time.Now().AddDate(0, 0, 7)
+		booking := func() *models.Rental {
+			return &models.Rental{
+				UserID:    user.ID,
+				StartDate: start,
+				EndDate:   start.AddDate(0, 0, 2),
+				TotalCost: models.NewMoney(200000),
+				Items:     []models.RentalItem{{EquipmentID: equipment.ID, Quantity: 1}},
+			}
+		}
+		require.NoError(t, repo.Create(booking()))
+
+		// The last unit is taken, even when availability was checked before
+		assert.ErrorIs(t, tx.Transaction(func(tx *gorm.DB) error {
+			return NewRentalRepository(tx).Create(booking())
+		}), ErrInsufficientStock)
+	})
+}
+
+func TestRentalRepository_OverdueRentalHoldsStock(t *testing.T) {
+	withTestDB(t, func(tx *gorm.DB) {
+		var role models.Role
+		require.NoError(t, tx.First(&role).Error)
+		suffix := uuid.NewString()[:8]
+		user := &models.User{
+			Username: "overdue-" + suffix,
+			Email:    "overdue-" + suffix + "@example.com",
+			Password: "x",
+			FullName: "Overdue",
+			RoleID:   role.ID,
+		}
+		require.NoError(t, tx.Create(user).Error)
+		equipment := &models.Equipment{
+			ID:            uuid.New(),
+			Name:          "Speaker",
+			Slug:          "speaker-" + suffix,
+			StockQuantity: 1,
+			RentalPrice:   models.NewMoney(100000),
+			IsAvailable:   true,
+		}
+		require.NoError(t, tx.Create(equipment).Error)
+
+		// The only unit should have come back yesterday
+		now := time.Now()
+		overdue := &models.Rental{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			StartDate: now.AddDate(0, 0, -5),
+			EndDate:   now.AddDate(0, 0, -1),
+			TotalCost: models.NewMoney(400000),
+			Status:    models.RentalStatusOverdue,
+		}
+		require.NoError(t, tx.Omit("Items").Create(overdue).Error)
+		require.NoError(t, tx.Create(&models.RentalItem{RentalID: overdue.ID, EquipmentID: equipment.ID, Quantity: 1}).Error)
+
+		repo := NewRentalRepository(tx)
+		start := now.AddDate(0, 0, 3)
+		end := start.AddDate(0, 0, 2)
+
+		booked, err := repo.SumBookedQuantity(equipment.ID, start, end)
+		require.NoError(t, err)
+		assert.Equal(t, 1, booked)
+
+		periods, err := repo.FindBookedPeriods(equipment.ID, start, end)
+		require.NoError(t, err)
+		require.Len(t, periods, 1)
+		assert.False(t, periods[0].EndDate.Before(end))
+
+		assert.ErrorIs(t, tx.Transaction(func(tx *gorm.DB) error {
+			return NewRentalRepository(tx).Create(&models.Rental{
+				UserID:    user.ID,
+				StartDate: start,
+				EndDate:   end,
+				TotalCost: models.NewMoney(200000),
+				Items:     []models.RentalItem{{EquipmentID: equipment.ID, Quantity: 1}},
+			})
+		}), ErrInsufficientStock)
+	})
+}
@@ -1,7 +1,9 @@
 package repositories
 
 import (
+	"errors"
 	"invitified-go/models"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -14,8 +16,16 @@ type TokenRepository interface {
 	FindByID(id uuid.UUID) (*models.Tokens, error)
 	FindValidToken(userID uuid.UUID) (*models.Tokens, error)
 	InvalidateToken(id uuid.UUID) error
+	Rotate(current *models.Tokens, next *models.Tokens) error
+	RevokeFamily(familyID uuid.UUID) error
+	RevokeUser(userID uuid.UUID) error
+	IsSessionActive(familyID uuid.UUID) (bool, error)
 }
 
+// ErrTokenNotActive is returned when rotating a token that was rotated or
+// revoked by another request
+var ErrTokenNotActive = errors.New("token was already rotated or revoked")
+
 type tokenRepository struct {
 	db *gorm.DB
 }
@@ -32,9 +42,11 @@ func (r *tokenRepository) UpdateToken(token *models.Tokens) error {
 	return r.db.Save(token).Error
 }
 
+// FindToken returns the token with the given hash whether it is still valid
+// or not, so a rotated token that is used again can be recognized
 func (r *tokenRepository) FindToken(token string) (*models.Tokens, error) {
 	var tokenModel models.Tokens
-	err := r.db.Where("token = ? AND is_valid = ? AND expires_at > NOW()", token, true).First(&tokenModel).Error
+	err := r.db.Where("token = ?", token).First(&tokenModel).Error
 	return &tokenModel, err
 }
 
@@ -53,3 +65,56 @@ func (r *tokenRepository) FindValidToken(userID uuid.UUID) (*models.Tokens, erro
 func (r *tokenRepository) InvalidateToken(id uuid.UUID) error {
 	return r.db.Model(&models.Tokens{}).Where("token_id = ?", id).Update("is_valid", false).Error
 }
+
+// Rotate marks the current token as rotated and stores the next token of its
+// family. Only one of two requests rotating the same token succeeds, the
+// other gets ErrTokenNotActive.
+func (r *tokenRepository) Rotate(current *models.Tokens, next *models.Tokens) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Tokens{}).
+			Where("token_id = ? AND is_valid = ? AND rotated_at IS NULL", current.ID, true).
+			Updates(map[string]interface{}{
+				"is_valid":   false,
+				"rotated_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenNotActive
+		}
+		current.IsValid = false
+		current.RotatedAt = &now
+		return tx.Create(next).Error
+	})
+}
+
+// RevokeFamily revokes every token of a login session
+func (r *tokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	return r.revoke(r.db.Where("family_id = ?", familyID))
+}
+
+// RevokeUser revokes every token of every session of the user
+func (r *tokenRepository) RevokeUser(userID uuid.UUID) error {
+	return r.revoke(r.db.Where("user_id = ?", userID))
+}
+
+func (r *tokenRepository) revoke(query *gorm.DB) error {
+	return query.Model(&models.Tokens{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{
+			"is_valid":   false,
+			"revoked_at": time.Now(),
+		}).Error
+}
+
+// IsSessionActive reports whether the login session still has a valid token
+// that has not expired
+func (r *tokenRepository) IsSessionActive(familyID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Tokens{}).
+		Where("family_id = ? AND is_valid = ? AND expires_at > NOW()", familyID, true).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"invitified-go/config"
 	"invitified-go/controllers"
+	"invitified-go/gateways"
 	"invitified-go/middlewares"
 	"invitified-go/repositories"
 
@@ -16,20 +17,42 @@ func InitRoutes(e *echo.Echo) {
 	equipmentRepo := repositories.NewEquipmentRepository(config.DB)
 	rentalRepo := repositories.NewRentalRepository(config.DB)
 	paymentRepo := repositories.NewPaymentRepository(config.DB)
+	quoteRepo := repositories.NewQuoteRepository(config.DB)
+	idempotencyRepo := repositories.NewIdempotencyRepository(config.DB)
+	refundRepo := repositories.NewRefundRepository(config.DB)
+	loyaltyRepo := repositories.NewLoyaltyRepository(config.DB)
+	promotionRepo := repositories.NewPromotionRepository(config.DB)
+	exchangeRateRepo := repositories.NewExchangeRateRepository(config.DB)
+	depositRepo := repositories.NewDepositRepository(config.DB)
+	lateFeeRepo := repositories.NewLateFeeRepository(config.DB)
+
+	// Initialize payment gateway
+	paymentGateway := gateways.NewXenditGateway(gateways.XenditConfigFromEnv())
 
 	// Initialize controllers
 	userController := controllers.NewUserController(userRepo, tokenRepo)
-	equipmentController := controllers.NewEquipmentController(equipmentRepo)
-	rentalController := controllers.NewRentalController(rentalRepo, equipmentRepo)
-	paymentController := controllers.NewPaymentController(paymentRepo, rentalRepo, userRepo)
+	equipmentController := controllers.NewEquipmentController(equipmentRepo, rentalRepo)
+	rentalController := controllers.NewRentalController(rentalRepo, equipmentRepo, paymentRepo, userRepo, promotionRepo, exchangeRateRepo, depositRepo, lateFeeRepo, refundRepo, paymentGateway)
+	quoteController := controllers.NewQuoteController(quoteRepo, rentalRepo, equipmentRepo, userRepo, promotionRepo, exchangeRateRepo)
+	paymentController := controllers.NewPaymentController(paymentRepo, rentalRepo, userRepo, loyaltyRepo, lateFeeRepo, paymentGateway)
+	refundController := controllers.NewRefundController(paymentRepo, refundRepo, userRepo, paymentGateway)
+	lateFeeController := controllers.NewLateFeeController(lateFeeRepo, rentalRepo, userRepo)
+	loyaltyController := controllers.NewLoyaltyController(loyaltyRepo)
+	promotionController := controllers.NewPromotionController(promotionRepo)
+	exchangeRateController := controllers.NewExchangeRateController(exchangeRateRepo)
+	depositController := controllers.NewDepositController(depositRepo, rentalRepo, paymentRepo, refundRepo, userRepo, paymentGateway)
 
 	// User routes
 	userGroup := e.Group("/users")
 	userGroup.POST("/register", userController.RegisterUser)
 	userGroup.POST("/login", userController.LoginUser)
+	userGroup.POST("/token/refresh", userController.RefreshToken)
 
 	// Protected routes
+	userGroup.POST("/logout", userController.Logout, middlewares.JWTMiddleware(tokenRepo))
+	userGroup.POST("/logout-all", userController.LogoutAll, middlewares.JWTMiddleware(tokenRepo))
 	userGroup.GET("/me", userController.GetUserProfile, middlewares.JWTMiddleware(tokenRepo))
+	userGroup.GET("/me/points", loyaltyController.GetMyPoints, middlewares.JWTMiddleware(tokenRepo))
 	userGroup.DELETE("/:id", userController.DeleteUser, middlewares.JWTMiddleware(tokenRepo))
 
 	// Equipment category routes
@@ -44,18 +67,54 @@ func InitRoutes(e *echo.Echo) {
 	equipmentGroup := e.Group("/equipment")
 	equipmentGroup.POST("", equipmentController.CreateEquipment, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
 	equipmentGroup.GET("/:slug", equipmentController.GetEquipmentBySlug)
+	equipmentGroup.GET("/:slug/availability", equipmentController.GetEquipmentAvailability)
 	equipmentGroup.GET("", equipmentController.GetAllEquipment)
 	equipmentGroup.PUT("/:slug", equipmentController.UpdateEquipment, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
 	equipmentGroup.DELETE("/:slug", equipmentController.DeleteEquipment, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
 
 	// Rental routes
 	rentalGroup := e.Group("/rentals")
-	rentalGroup.POST("", rentalController.CreateRental, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("", rentalController.CreateRental, middlewares.JWTMiddleware(tokenRepo), middlewares.Idempotency(idempotencyRepo))
+	rentalGroup.POST("/quote", quoteController.CreateQuote, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.GET("/quotes/:id", quoteController.GetQuoteByID, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/quotes/:id/book", quoteController.BookQuote, middlewares.JWTMiddleware(tokenRepo))
 	rentalGroup.GET("/:id", rentalController.GetRentalByID, middlewares.JWTMiddleware(tokenRepo))
 	rentalGroup.GET("", rentalController.GetAllRentals, middlewares.JWTMiddleware(tokenRepo))
 	rentalGroup.PUT("/:id", rentalController.UpdateRental, middlewares.JWTMiddleware(tokenRepo))
 	rentalGroup.DELETE("/:id", rentalController.DeleteRental, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.GET("/:id/payments", paymentController.GetRentalPayments, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/:id/extend", rentalController.ExtendRental, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/:id/cancel", rentalController.CancelRental, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/:id/pickup", rentalController.PickupRental, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	rentalGroup.POST("/:id/return", rentalController.ReturnRental, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	rentalGroup.POST("/:id/complete", rentalController.CompleteRental, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	rentalGroup.GET("/:id/deposit", depositController.GetRentalDeposit, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/:id/deposit/settle", depositController.SettleDeposit, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	rentalGroup.GET("/:id/late-fee", lateFeeController.GetRentalLateFee, middlewares.JWTMiddleware(tokenRepo))
+	rentalGroup.POST("/:id/late-fee/waive", lateFeeController.WaiveLateFee, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+
+	// Promotion routes
+	promotionGroup := e.Group("/promotions", middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	promotionGroup.POST("", promotionController.CreatePromotion)
+	promotionGroup.GET("", promotionController.GetAllPromotions)
+	promotionGroup.GET("/:id", promotionController.GetPromotionByID)
+	promotionGroup.PUT("/:id", promotionController.UpdatePromotion)
+	promotionGroup.DELETE("/:id", promotionController.DeletePromotion)
+
+	// Exchange rate routes
+	exchangeRateGroup := e.Group("/exchange-rates", middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	exchangeRateGroup.POST("", exchangeRateController.CreateExchangeRate)
+	exchangeRateGroup.GET("", exchangeRateController.GetAllExchangeRates)
+	exchangeRateGroup.GET("/:id", exchangeRateController.GetExchangeRateByID)
+	exchangeRateGroup.DELETE("/:id", exchangeRateController.DeleteExchangeRate)
 
 	paymentGroup := e.Group("/payments")
-	paymentGroup.POST("", paymentController.CreatePayment, middlewares.JWTMiddleware(tokenRepo))
+	paymentGroup.POST("", paymentController.CreatePayment, middlewares.JWTMiddleware(tokenRepo), middlewares.Idempotency(idempotencyRepo))
+	paymentGroup.GET("", paymentController.GetMyPayments, middlewares.JWTMiddleware(tokenRepo))
+	paymentGroup.GET("/all", paymentController.GetAllPayments, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo))
+	paymentGroup.GET("/:id", paymentController.GetPaymentByID, middlewares.JWTMiddleware(tokenRepo))
+	paymentGroup.GET("/:id/status", paymentController.GetPaymentStatus, middlewares.JWTMiddleware(tokenRepo))
+	paymentGroup.POST("/callbacks/xendit", paymentController.XenditCallback)
+	paymentGroup.POST("/callbacks/xendit/refunds", refundController.XenditRefundCallback)
+	paymentGroup.POST("/:id/refunds", refundController.CreateRefund, middlewares.JWTMiddleware(tokenRepo), middlewares.IsAdmin(userRepo), middlewares.Idempotency(idempotencyRepo))
 }
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DateLayout is the format used for calendar dates in requests and responses
+const DateLayout = "2006-01-02"
+
+// ItemAvailability describes how many units of a piece of equipment are free
+// for a rental window compared to how many were requested.
+type ItemAvailability struct {
+	EquipmentID   uuid.UUID `json:"equipment_id"`
+	EquipmentName string    `json:"equipment_name"`
+	Requested     int       `json:"requested"`
+	Available     int       `json:"available"`
+}
+
+// AvailabilityService checks equipment stock against existing bookings
+type AvailabilityService struct {
+	rentalRepo repositories.RentalRepository
+}
+
+// NewAvailabilityService creates a new AvailabilityService
+func NewAvailabilityService(rentalRepo repositories.RentalRepository) *AvailabilityService {
+	return &AvailabilityService{rentalRepo}
+}
+
+// AvailableQuantity returns how many units of the equipment are not held by
+// PENDING or PAID rentals overlapping the window.
+func (s *AvailabilityService) AvailableQuantity(equipment *models.Equipment, startDate, endDate time.Time) (int, error) {
+	if !equipment.IsAvailable {
+		return 0, nil
+	}
+
+	booked, err := s.rentalRepo.SumBookedQuantity(equipment.ID, startDate, endDate)
+	if err != nil {
+		return 0, err
+	}
+
+	available := equipment.StockQuantity - booked
+	if available < 0 {
+		available = 0
+	}
+	return available, nil
+}
+
+// ItemsAvailability returns the free stock of every piece of equipment in the
+// items for the window. Quantities for the same equipment are added together.
+// The equipment map must contain every item's equipment.
+func (s *AvailabilityService) ItemsAvailability(items []models.RentalItem, equipment map[uuid.UUID]*models.Equipment, startDate, endDate time.Time) ([]ItemAvailability, error) {
+	requested := make(map[uuid.UUID]int)
+	var order []uuid.UUID
+	for _, item := range items {
+		if _, seen := requested[item.EquipmentID]; !seen {
+			order = append(order, item.EquipmentID)
+		}
+		requested[item.EquipmentID] += item.Quantity
+	}
+
+	result := make([]ItemAvailability, 0, len(order))
+	for _, equipmentID := range order {
+		eq := equipment[equipmentID]
+		available, err := s.AvailableQuantity(eq, startDate, endDate)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ItemAvailability{
+			EquipmentID:   equipmentID,
+			EquipmentName: eq.Name,
+			Requested:     requested[equipmentID],
+			Available:     available,
+		})
+	}
+	return result, nil
+}
+
+// CheckItems returns the items that cannot be fulfilled for the window
+func (s *AvailabilityService) CheckItems(items []models.RentalItem, equipment map[uuid.UUID]*models.Equipment, startDate, endDate time.Time) ([]ItemAvailability, error) {
+	availability, err := s.ItemsAvailability(items, equipment, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []ItemAvailability
+	for _, item := range availability {
+		if item.Requested > item.Available {
+			conflicts = append(conflicts, item)
+		}
+	}
+	return conflicts, nil
+}
+
+// DayAvailability is the number of free units of equipment on one day
+type DayAvailability struct {
+	Date      string `json:"date"`
+	Available int    `json:"available"`
+}
+
+// Calendar returns the free units for every day from the first to the last
+// date, both inclusive. The bookings of the whole range are loaded once and
+// each day counts those overlapping it, like the check made when creating a
+// rental.
+func (s *AvailabilityService) Calendar(equipment *models.Equipment, from, to time.Time) ([]DayAvailability, error) {
+	var periods []repositories.BookedPeriod
+	if equipment.IsAvailable {
+		var err error
+		periods, err = s.rentalRepo.FindBookedPeriods(equipment.ID, from, to.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var days []DayAvailability
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		available := 0
+		if equipment.IsAvailable {
+			next := day.AddDate(0, 0, 1)
+			available = equipment.StockQuantity
+			for _, period := range periods {
+				if period.EndDate.After(day) && period.StartDate.Before(next) {
+					available -= period.Quantity
+				}
+			}
+			if available < 0 {
+				available = 0
+			}
+		}
+		days = append(days, DayAvailability{
+			Date:      day.Format(DateLayout),
+			Available: available,
+		})
+	}
+	return days, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"invitified-go/models"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefundTier refunds Percent of the amount paid when a rental is cancelled at
+// least MinNotice before it starts.
+type RefundTier struct {
+	MinNotice time.Duration
+	Percent   int
+}
+
+// CancellationPolicy decides how much of a payment is refunded on cancellation
+type CancellationPolicy struct {
+	tiers []RefundTier
+}
+
+// DefaultCancellationPolicy refunds everything when cancelled more than a week
+// ahead and half of it up to the start of the rental.
+func DefaultCancellationPolicy() CancellationPolicy {
+	return NewCancellationPolicy([]RefundTier{
+		{MinNotice: 7 * 24 * time.Hour, Percent: 100},
+		{MinNotice: 0, Percent: 50},
+	})
+}
+
+// NewCancellationPolicy creates a policy from its tiers in any order
+func NewCancellationPolicy(tiers []RefundTier) CancellationPolicy {
+	sorted := append([]RefundTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinNotice > sorted[j].MinNotice
+	})
+	return CancellationPolicy{sorted}
+}
+
+// ParseCancellationPolicy reads tiers written as "notice:percent" pairs, for
+// example "168h:100,48h:50,0s:25".
+func ParseCancellationPolicy(spec string) (CancellationPolicy, error) {
+	var tiers []RefundTier
+	for _, part := range strings.Split(spec, ",") {
+		notice, percent, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found {
+			return CancellationPolicy{}, fmt.Errorf("invalid refund tier %q", part)
+		}
+		d, err := time.ParseDuration(notice)
+		if err != nil {
+			return CancellationPolicy{}, fmt.Errorf("invalid notice in refund tier %q: %w", part, err)
+		}
+		p, err := strconv.Atoi(percent)
+		if err != nil || p < 0 || p > 100 {
+			return CancellationPolicy{}, fmt.Errorf("invalid percent in refund tier %q", part)
+		}
+		tiers = append(tiers, RefundTier{MinNotice: d, Percent: p})
+	}
+	return NewCancellationPolicy(tiers), nil
+}
+
+// CancellationPolicyFromEnv reads the policy from CANCELLATION_POLICY and
+// falls back to the default policy when it is unset or invalid.
+func CancellationPolicyFromEnv() CancellationPolicy {
+	spec := os.Getenv("CANCELLATION_POLICY")
+	if spec == "" {
+		return DefaultCancellationPolicy()
+	}
+	policy, err := ParseCancellationPolicy(spec)
+	if err != nil {
+		log.Printf("Invalid CANCELLATION_POLICY, using the default policy: %v", err)
+		return DefaultCancellationPolicy()
+	}
+	return policy
+}
+
+// RefundPercent returns the share of the payment refunded when the rental is
+// cancelled at the given time. Nothing is refunded once equipment is picked up.
+func (p CancellationPolicy) RefundPercent(rental *models.Rental, now time.Time) int {
+	if rental.PickedUpAt != nil {
+		return 0
+	}
+	notice := rental.StartDate.Sub(now)
+	for _, tier := range p.tiers {
+		if notice >= tier.MinNotice {
+			return tier.Percent
+		}
+	}
+	return 0
+}
+
+// RefundAmount applies the refund percent to the amount paid, rounded in the
+// currency it was paid in
+func (p CancellationPolicy) RefundAmount(rental *models.Rental, paid models.Money, currency models.Currency, now time.Time) models.Money {
+	percent := p.RefundPercent(rental, now)
+	return paid.Mul(float64(percent) / 100).Round(currency.OrDefault())
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"invitified-go/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCancellationPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		wantTiers []RefundTier
+		wantErr   bool
+	}{
+		{
+			name: "Tiers are sorted by notice",
+			spec: "0s:25, 168h:100,48h:50",
+			wantTiers: []RefundTier{
+				{MinNotice: 168 * time.Hour, Percent: 100},
+				{MinNotice: 48 * time.Hour, Percent: 50},
+				{MinNotice: 0, Percent: 25},
+			},
+		},
+		{
+			name:    "Missing percent",
+			spec:    "168h",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid notice",
+			spec:    "a week:100",
+			wantErr: true,
+		},
+		{
+			name:    "Percent above 100",
+			spec:    "168h:120",
+			wantErr: true,
+		},
+		{
+			name:    "Negative percent",
+			spec:    "168h:-5",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseCancellationPolicy(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTiers, policy.tiers)
+		})
+	}
+}
+
+func TestCancellationPolicy_RefundAmount(t *testing.T) {
+	policy := DefaultCancellationPolicy()
+	start := time.Date(2025, 6, 14, 9, 0, 0, 0, time.UTC)
+	pickedUp := start.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		pickedUpAt  *time.Time
+		currency    models.Currency
+		paid        float64
+		wantPercent int
+		wantRefund  float64
+	}{
+		{
+			name:        "Exactly a week ahead",
+			now:         start.Add(-168 * time.Hour),
+			paid:        200000,
+			wantPercent: 100,
+			wantRefund:  200000,
+		},
+		{
+			name:        "Just under a week ahead",
+			now:         start.Add(-168*time.Hour + time.Second),
+			paid:        200000,
+			wantPercent: 50,
+			wantRefund:  100000,
+		},
+		{
+			name:        "At the start",
+			now:         start,
+			paid:        200000,
+			wantPercent: 50,
+			wantRefund:  100000,
+		},
+		{
+			name:        "After the start",
+			now:         start.Add(time.Minute),
+			paid:        200000,
+			wantPercent: 0,
+			wantRefund:  0,
+		},
+		{
+			name:        "Picked up ahead of the start",
+			now:         start.Add(-time.Hour),
+			pickedUpAt:  &pickedUp,
+			paid:        200000,
+			wantPercent: 0,
+			wantRefund:  0,
+		},
+		{
+			name:        "Rounded in the currency paid",
+			now:         start.Add(-time.Hour),
+			currency:    "USD",
+			paid:        10.25,
+			wantPercent: 50,
+			wantRefund:  5.13,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rental := &models.Rental{StartDate: start, EndDate: start.Add(48 * time.Hour), PickedUpAt: tt.pickedUpAt}
+
+			assert.Equal(t, tt.wantPercent, policy.RefundPercent(rental, tt.now))
+			assert.Equal(t, models.NewMoney(tt.wantRefund), policy.RefundAmount(rental, models.NewMoney(tt.paid), tt.currency, tt.now))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoExchangeRate is returned when a currency has no exchange rate in force
+var ErrNoExchangeRate = errors.New("no exchange rate for currency")
+
+// ExchangeRates looks up the rates admins entered for foreign currencies.
+// Rates are the value of one unit of a currency in DefaultCurrency.
+type ExchangeRates struct {
+	repo repositories.ExchangeRateRepository
+}
+
+// NewExchangeRates creates a new ExchangeRates
+func NewExchangeRates(repo repositories.ExchangeRateRepository) *ExchangeRates {
+	return &ExchangeRates{repo}
+}
+
+// Rate returns the rate of the currency in force at the given time
+func (r *ExchangeRates) Rate(currency models.Currency, at time.Time) (float64, error) {
+	currency = currency.OrDefault()
+	if currency == models.DefaultCurrency {
+		return 1, nil
+	}
+	rate, err := r.repo.FindEffective(currency, at)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("%w %s", ErrNoExchangeRate, currency)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"log"
+	"time"
+)
+
+// defaultLateFeeGrace is how long after the end date equipment can come back
+// without a fee
+const defaultLateFeeGrace = 2 * time.Hour
+
+// LateFeePolicy decides what is charged for equipment returned late
+type LateFeePolicy struct {
+	// GracePeriod after the end date before the rental is overdue
+	GracePeriod time.Duration
+	// Rate is the share of the rental's daily rate charged per late day
+	Rate float64
+}
+
+// LateFeePolicyFromEnv reads LATE_FEE_GRACE_HOURS and LATE_FEE_RATE. By
+// default a late day costs the daily rate of the rental after two hours grace.
+func LateFeePolicyFromEnv() LateFeePolicy {
+	return LateFeePolicy{
+		GracePeriod: utils.HoursFromEnv("LATE_FEE_GRACE_HOURS", defaultLateFeeGrace),
+		Rate:        nonNegativeFloatFromEnv("LATE_FEE_RATE", 1),
+	}
+}
+
+// OverdueAt is when the rental becomes overdue if it has not been returned
+func (p LateFeePolicy) OverdueAt(rental *models.Rental) time.Time {
+	return rental.EndDate.Add(p.GracePeriod)
+}
+
+// DaysLate returns the number of days charged for equipment still out or
+// returned at the given time. Every started day after the end date counts
+// once the grace period is over.
+func (p LateFeePolicy) DaysLate(rental *models.Rental, at time.Time) int {
+	if !at.After(p.OverdueAt(rental)) {
+		return 0
+	}
+	late := at.Sub(rental.EndDate)
+	days := int(late / (24 * time.Hour))
+	if late%(24*time.Hour) > 0 {
+		days++
+	}
+	return days
+}
+
+// DailyFee returns the fee per late day in the settlement currency. It is
+// based on the daily rate each item was booked at, so discounts for longer
+// rentals carry over to the late days.
+func (p LateFeePolicy) DailyFee(rental *models.Rental) models.Money {
+	rentalDays := int(rental.EndDate.Sub(rental.StartDate).Hours()/24 + 0.5)
+	var daily models.Money
+	for _, item := range rental.Items {
+		days := item.Days
+		if days <= 0 {
+			days = rentalDays
+		}
+		if days <= 0 {
+			days = 1
+		}
+		daily += item.LineTotal.Mul(1 / float64(days))
+	}
+	return rental.SettlementAmount(daily.Mul(p.Rate)).Round(models.DefaultCurrency)
+}
+
+// LateFees charges the late fees of overdue rentals
+type LateFees struct {
+	repo     repositories.LateFeeRepository
+	userRepo repositories.UserRepository
+	policy   LateFeePolicy
+}
+
+// NewLateFees creates a new LateFees with the policy from the environment
+func NewLateFees(repo repositories.LateFeeRepository, userRepo repositories.UserRepository) *LateFees {
+	return &LateFees{repo, userRepo, LateFeePolicyFromEnv()}
+}
+
+// Policy returns the late fee policy in use
+func (f *LateFees) Policy() LateFeePolicy {
+	return f.policy
+}
+
+// Accrue charges the late days of the rental up to the given time, or up to
+// its return for rentals that are back. It returns nil when no fee is due.
+// The customer is emailed whenever the fee of equipment still out grows.
+func (f *LateFees) Accrue(rental *models.Rental, at time.Time) (*models.LateFee, error) {
+	status := models.LateFeeStatusAccruing
+	if rental.ReturnedAt != nil {
+		at = *rental.ReturnedAt
+		status = models.LateFeeStatusDue
+	}
+	days := f.policy.DaysLate(rental, at)
+	if days == 0 {
+		return nil, nil
+	}
+
+	daily := f.policy.DailyFee(rental)
+	fee := &models.LateFee{
+		RentalID: rental.ID,
+		UserID:   rental.UserID,
+		Status:   status,
+		DaysLate: days,
+		DailyFee: daily,
+		Amount:   daily * models.Money(days),
+		Currency: models.DefaultCurrency,
+	}
+	changed, err := f.repo.Accrue(fee)
+	if errors.Is(err, repositories.ErrLateFeeWaived) {
+		return fee, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if changed && status == models.LateFeeStatusAccruing {
+		f.notify(rental, fee)
+	}
+	return fee, nil
+}
+
+func (f *LateFees) notify(rental *models.Rental, fee *models.LateFee) {
+	user, err := f.userRepo.FindByID(rental.UserID)
+	if err != nil {
+		log.Printf("Failed to load user %s for late fee email: %v", rental.UserID, err)
+		return
+	}
+	htmlBody := utils.GetLateFeeEmail(rental.ID.String(), rental.EndDate.Format("2 January 2006 15:04"), fee.DaysLate,
+		fee.DailyFee.Format(fee.Currency), fee.Amount.Format(fee.Currency), fee.Outstanding().Format(fee.Currency))
+	if err := utils.SendHTMLEmail(user.Email, "Rental Overdue", htmlBody); err != nil {
+		log.Println("Failed to send email:", err)
+	}
+}
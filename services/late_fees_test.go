@@ -0,0 +1,58 @@
+package services
+
+import (
+	"invitified-go/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLateFeePolicy_DaysLate(t *testing.T) {
+	policy := LateFeePolicy{GracePeriod: 2 * time.Hour, Rate: 1}
+	end := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+	rental := &models.Rental{EndDate: end}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{name: "Before the end date", at: end.Add(-time.Hour), want: 0},
+		{name: "Within the grace period", at: end.Add(2 * time.Hour), want: 0},
+		{name: "Just after the grace period", at: end.Add(2*time.Hour + time.Minute), want: 1},
+		{name: "A full day late", at: end.Add(24 * time.Hour), want: 1},
+		{name: "Into the second day", at: end.Add(25 * time.Hour), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.DaysLate(rental, tt.at))
+		})
+	}
+}
+
+func TestLateFeePolicy_DailyFee(t *testing.T) {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	rental := &models.Rental{
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 7),
+		Items: []models.RentalItem{
+			// A week at the weekly rate of 600,000 for two units
+			{Quantity: 2, Days: 7, LineTotal: models.NewMoney(1200000)},
+			// Booked before items kept their days
+			{Quantity: 1, LineTotal: models.NewMoney(350000)},
+		},
+	}
+
+	policy := LateFeePolicy{Rate: 1}
+	assert.Equal(t, models.NewMoney(221429), policy.DailyFee(rental))
+
+	policy.Rate = 1.5
+	assert.Equal(t, models.NewMoney(332143), policy.DailyFee(rental))
+
+	rental.Currency = models.CurrencyUSD
+	rental.ExchangeRate = 16000
+	rental.Items = []models.RentalItem{{Quantity: 1, Days: 2, LineTotal: models.NewMoney(25)}}
+	assert.Equal(t, models.NewMoney(300000), policy.DailyFee(rental))
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"invitified-go/models"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+const (
+	// defaultPointsEarnRate earns one point per 10,000 paid
+	defaultPointsEarnRate = 0.0001
+	// defaultPointValue makes a point worth 100 when redeemed
+	defaultPointValue = 100
+)
+
+// LoyaltyRates converts between money and loyalty points
+type LoyaltyRates struct {
+	// EarnRate is the number of points earned per unit of currency paid
+	EarnRate float64
+	// PointValue is the amount one point takes off a payment
+	PointValue float64
+}
+
+// LoyaltyRatesFromEnv reads LOYALTY_EARN_RATE and LOYALTY_POINT_VALUE. By
+// default a customer earns one point per 10,000 paid and a point is worth 100.
+func LoyaltyRatesFromEnv() LoyaltyRates {
+	return LoyaltyRates{
+		EarnRate:   nonNegativeFloatFromEnv("LOYALTY_EARN_RATE", defaultPointsEarnRate),
+		PointValue: nonNegativeFloatFromEnv("LOYALTY_POINT_VALUE", defaultPointValue),
+	}
+}
+
+// PointsEarned returns the whole points earned by paying amount
+func (r LoyaltyRates) PointsEarned(amount models.Money) int {
+	if amount <= 0 {
+		return 0
+	}
+	// The epsilon keeps amounts like 30000 * 0.0001 from flooring to 2
+	return int(math.Floor(amount.Float64()*r.EarnRate + 1e-9))
+}
+
+// Value returns the amount the points take off a payment
+func (r LoyaltyRates) Value(points int) models.Money {
+	return models.NewMoney(float64(points) * r.PointValue).Round(models.DefaultCurrency)
+}
+
+func nonNegativeFloatFromEnv(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid %s %q, using %g", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"invitified-go/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoyaltyRates(t *testing.T) {
+	rates := LoyaltyRates{EarnRate: 0.0001, PointValue: 100}
+
+	assert.Equal(t, 3, rates.PointsEarned(models.NewMoney(30000)))
+	assert.Equal(t, 3, rates.PointsEarned(models.NewMoney(39999.99)))
+	assert.Equal(t, 0, rates.PointsEarned(models.NewMoney(9999)))
+	assert.Equal(t, 0, rates.PointsEarned(models.NewMoney(-10000)))
+	assert.Equal(t, models.NewMoney(20000), rates.Value(200))
+}
+
+func TestLoyaltyRatesFromEnv(t *testing.T) {
+	t.Setenv("LOYALTY_EARN_RATE", "0.001")
+	t.Setenv("LOYALTY_POINT_VALUE", "invalid")
+
+	rates := LoyaltyRatesFromEnv()
+	assert.Equal(t, 0.001, rates.EarnRate)
+	assert.Equal(t, float64(defaultPointValue), rates.PointValue)
+}
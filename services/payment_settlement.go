@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"log"
+	"time"
+)
+
+// Settlement is the outcome of recording a successful payment
+type Settlement struct {
+	Payment   *models.Payment
+	Rental    *models.Rental
+	Extension *models.RentalExtension
+	// Duplicate is set when the payment had already been recorded
+	Duplicate bool
+}
+
+// ErrUnderpaid is returned when the gateway reports less than the amount due
+var ErrUnderpaid = errors.New("paid amount is less than the amount due")
+
+// PaidDetails describes a successful payment reported by the gateway
+type PaidDetails struct {
+	Amount    models.Money
+	PaymentID string
+	Channel   string
+	PaidAt    time.Time
+}
+
+// PaymentSettlement records successful payments and moves the rental or
+// extension they pay for forward. Settling the same payment again is safe.
+type PaymentSettlement struct {
+	paymentRepo repositories.PaymentRepository
+	rentalRepo  repositories.RentalRepository
+	userRepo    repositories.UserRepository
+	lifecycle   *RentalLifecycle
+	rates       LoyaltyRates
+}
+
+// NewPaymentSettlement creates a new PaymentSettlement
+func NewPaymentSettlement(paymentRepo repositories.PaymentRepository, rentalRepo repositories.RentalRepository, userRepo repositories.UserRepository) *PaymentSettlement {
+	return &PaymentSettlement{
+		paymentRepo: paymentRepo,
+		rentalRepo:  rentalRepo,
+		userRepo:    userRepo,
+		lifecycle:   NewRentalLifecycle(rentalRepo),
+		rates:       LoyaltyRatesFromEnv(),
+	}
+}
+
+// Record stores a successful payment reported by the gateway and settles it.
+// A payment of less than the amount due is stored as UNDERPAID for review,
+// without settling its rental, and returns ErrUnderpaid.
+func (s *PaymentSettlement) Record(payment *models.Payment, paid PaidDetails) (*Settlement, error) {
+	paidAt := paid.PaidAt
+	if paidAt.IsZero() {
+		paidAt = time.Now()
+	}
+	payment.XenditPaidAmount = paid.Amount
+	payment.XenditPaymentID = paid.PaymentID
+	if paid.Channel != "" {
+		payment.XenditPaymentChannel = paid.Channel
+	}
+	payment.PaidAt = &paidAt
+
+	if paid.Amount < payment.Amount {
+		// A payment recorded before keeps its status, the callback may be
+		// delivered again
+		if err := s.paymentRepo.MarkUnderpaid(payment); err != nil && !errors.Is(err, repositories.ErrPaymentNotPending) {
+			return nil, err
+		}
+		return &Settlement{Payment: payment}, ErrUnderpaid
+	}
+	return s.MarkPaid(payment)
+}
+
+// MarkPaid records the paid fields already set on the payment and settles its
+// rental or extension. A payment that was recorded before is not stored again,
+// but its rental is still settled in case an earlier attempt stopped halfway.
+// The customer earns points on the amount that was due, less the deposit.
+// Late fees earn no points and are credited to the fee when the payment is
+// stored.
+func (s *PaymentSettlement) MarkPaid(payment *models.Payment) (*Settlement, error) {
+	settlement := &Settlement{Payment: payment}
+	if payment.LateFeeID == nil {
+		payment.PointsEarned = s.rates.PointsEarned(payment.Amount - payment.DepositAmount)
+	}
+	if err := s.paymentRepo.MarkPaid(payment); err != nil {
+		if !errors.Is(err, repositories.ErrPaymentNotPending) {
+			return nil, err
+		}
+		stored, err := s.paymentRepo.FindByID(payment.ID)
+		if err != nil {
+			return nil, err
+		}
+		settlement.Payment = stored
+		settlement.Duplicate = true
+		if stored.PaymentStatus != models.PaymentStatusCompleted {
+			// Refunded or waiting for a refund, nothing left to settle
+			return settlement, nil
+		}
+	}
+
+	rental, err := s.rentalRepo.FindByID(settlement.Payment.RentalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rental %s: %w", settlement.Payment.RentalID, err)
+	}
+	settlement.Rental = rental
+
+	if settlement.Payment.LateFeeID != nil {
+		return settlement, nil
+	}
+	if settlement.Payment.ExtensionID != nil {
+		return settlement, s.settleExtension(settlement)
+	}
+	return settlement, s.settleRental(settlement)
+}
+
+func (s *PaymentSettlement) settleRental(settlement *Settlement) error {
+	rental := settlement.Rental
+	if rental.Status != models.RentalStatusPending {
+		if rental.Status == models.RentalStatusCancelled || rental.Status == models.RentalStatusExpired {
+			return s.markForRefund(settlement.Payment, "rental is "+rental.Status)
+		}
+		return nil
+	}
+
+	if err := s.lifecycle.Transition(rental, models.RentalStatusPaid, nil); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(rental.UserID)
+	if err != nil {
+		log.Printf("Failed to load user %s for payment email: %v", rental.UserID, err)
+		return nil
+	}
+	subject := "Payment Completed"
+	// Amounts are shown in the rental's currency, followed by what was
+	// charged in the settlement currency when that differs
+	currency := rental.Currency.OrDefault()
+	order := utils.OrderConfirmation{
+		OrderNumber: rental.ID.String(),
+		Amount:      rental.TotalCost.Format(currency),
+		PromoCode:   rental.PromoCode,
+		Discount:    rental.DiscountAmount.Format(currency),
+		Subtotal:    rental.Subtotal.Format(currency),
+		TaxLabel:    TaxLabel(rental.PriceBreakdown),
+		Tax:         rental.TaxAmount.Format(currency),
+	}
+	if payment := settlement.Payment; payment.Currency.OrDefault() != currency {
+		order.Charged = payment.Amount.Format(payment.Currency)
+	}
+	if rental.DepositAmount > 0 {
+		order.Deposit = rental.DepositAmount.Format(currency)
+	}
+	htmlBody := utils.GetOrderConfirmationEmail(order)
+	if err := utils.SendHTMLEmail(user.Email, subject, htmlBody); err != nil {
+		log.Println("Failed to send email:", err)
+	}
+	return nil
+}
+
+func (s *PaymentSettlement) settleExtension(settlement *Settlement) error {
+	extension, err := s.rentalRepo.FindExtensionByID(*settlement.Payment.ExtensionID)
+	if err != nil {
+		return fmt.Errorf("failed to load extension %s: %w", *settlement.Payment.ExtensionID, err)
+	}
+	settlement.Extension = extension
+
+	switch extension.Status {
+	case models.ExtensionStatusApplied:
+		return nil
+	case models.ExtensionStatusExpired:
+		return s.markForRefund(settlement.Payment, "extension expired")
+	}
+
+	if err := s.rentalRepo.ApplyExtension(extension); err != nil {
+		if errors.Is(err, repositories.ErrExtensionNotPending) || errors.Is(err, repositories.ErrRentalStatusChanged) {
+			return s.markForRefund(settlement.Payment, err.Error())
+		}
+		return err
+	}
+	extension.Status = models.ExtensionStatusApplied
+	settlement.Rental.EndDate = extension.NewEndDate
+	settlement.Rental.TotalCost += extension.ExtraCost
+	settlement.Rental.Subtotal += extension.ExtraSubtotal
+	settlement.Rental.TaxAmount += extension.ExtraTax
+	return nil
+}
+
+// markForRefund flags money received for a rental or extension that can no
+// longer be fulfilled.
+func (s *PaymentSettlement) markForRefund(payment *models.Payment, reason string) error {
+	log.Printf("Payment %s received but cannot be applied (%s), marking for refund", payment.ID, reason)
+	payment.PaymentStatus = models.PaymentStatusRefundPending
+	return s.paymentRepo.Update(payment)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"strings"
+)
+
+// Payment states reported by LookupGatewayPayment, the same for every
+// payment method
+const (
+	GatewayPaymentPending = "PENDING"
+	GatewayPaymentPaid    = "PAID"
+	GatewayPaymentFailed  = "FAILED"
+)
+
+// GatewayPayment is what the gateway knows about a payment
+type GatewayPayment struct {
+	State string
+	// GatewayStatus is the status of the charge as the gateway reports it
+	GatewayStatus string
+	// Paid is set when the State is PAID
+	Paid PaidDetails
+}
+
+// LookupGatewayPayment asks the gateway for the current state of the
+// payment's charge. The gateway only reports virtual account payments through
+// callbacks, so those stay PENDING here and only the account's status is
+// returned.
+func LookupGatewayPayment(ctx context.Context, gateway gateways.PaymentGateway, payment *models.Payment) (*GatewayPayment, error) {
+	switch payment.PaymentMethod {
+	case models.PaymentMethodQRCode:
+		payments, err := gateway.GetQRCodePayments(ctx, payment.XenditInvoiceID)
+		if err != nil {
+			return nil, err
+		}
+		for _, qrPayment := range payments {
+			if qrPayment.Status == "SUCCEEDED" {
+				return &GatewayPayment{
+					State:         GatewayPaymentPaid,
+					GatewayStatus: qrPayment.Status,
+					Paid: PaidDetails{
+						Amount:    models.NewMoney(qrPayment.Amount),
+						PaymentID: qrPayment.ID,
+						PaidAt:    qrPayment.Created,
+					},
+				}, nil
+			}
+		}
+		return &GatewayPayment{State: GatewayPaymentPending, GatewayStatus: "ACTIVE"}, nil
+
+	case models.PaymentMethodEWallet:
+		charge, err := gateway.GetEWalletCharge(ctx, payment.XenditInvoiceID)
+		if err != nil {
+			return nil, err
+		}
+		result := &GatewayPayment{State: GatewayPaymentPending, GatewayStatus: charge.Status}
+		switch charge.Status {
+		case "SUCCEEDED":
+			result.State = GatewayPaymentPaid
+			result.Paid = PaidDetails{
+				Amount:    models.NewMoney(charge.CaptureAmount),
+				PaymentID: charge.ID,
+				Channel:   strings.TrimPrefix(charge.ChannelCode, "ID_"),
+				PaidAt:    charge.Updated,
+			}
+		case "FAILED", "VOIDED":
+			result.State = GatewayPaymentFailed
+		}
+		return result, nil
+	}
+
+	account, err := gateway.GetVirtualAccount(ctx, payment.XenditInvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	return &GatewayPayment{State: GatewayPaymentPending, GatewayStatus: account.Status}, nil
+}
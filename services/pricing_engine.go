@@ -0,0 +1,342 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRentalPeriod is returned when a rental does not end after it starts
+var ErrInvalidRentalPeriod = errors.New("end date must be after start date")
+
+const (
+	// RoundUp bills any started day beyond the grace period as a full day
+	RoundUp = "up"
+	// RoundNearest bills a partial day as a full day from twelve hours on
+	RoundNearest = "nearest"
+
+	daysPerWeek  = 7
+	daysPerMonth = 30
+)
+
+// DayRounding decides how a partial last day is billed
+type DayRounding struct {
+	Mode  string
+	Grace time.Duration
+}
+
+// DayRoundingFromEnv reads PRICING_ROUNDING ("up" or "nearest") and
+// PRICING_GRACE_HOURS. It defaults to rounding up without grace.
+func DayRoundingFromEnv() DayRounding {
+	rounding := DayRounding{Mode: RoundUp, Grace: utils.HoursFromEnv("PRICING_GRACE_HOURS", 0)}
+	if mode := os.Getenv("PRICING_ROUNDING"); mode == RoundUp || mode == RoundNearest {
+		rounding.Mode = mode
+	} else if mode != "" {
+		log.Printf("Invalid PRICING_ROUNDING %q, using %q", mode, RoundUp)
+	}
+	return rounding
+}
+
+// BillableDays returns the number of days charged for the period
+func (r DayRounding) BillableDays(startDate, endDate time.Time) int {
+	duration := endDate.Sub(startDate)
+	days := int(duration / (24 * time.Hour))
+	partial := duration - time.Duration(days)*24*time.Hour
+
+	switch r.Mode {
+	case RoundNearest:
+		if partial >= 12*time.Hour {
+			days++
+		}
+	default:
+		if partial > r.Grace {
+			days++
+		}
+	}
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+// rates are the prices used for one piece of equipment after category
+// defaults have been applied, in the currency of the rental. Zero weekly or
+// monthly rates are not offered.
+type rates struct {
+	daily, weekend, weekly, monthly models.Money
+	minDays                         int
+}
+
+// conversion converts equipment prices into the currency of the rental
+type conversion struct {
+	factor   float64
+	currency models.Currency
+}
+
+func (c conversion) convert(amount models.Money) models.Money {
+	if c.factor == 1 {
+		return amount
+	}
+	return amount.Convert(c.factor, c.currency)
+}
+
+// Pricer prices the items of a rental for a period, and the extra days of
+// extending a booked rental
+type Pricer interface {
+	PriceRental(items []models.RentalItem, equipment map[uuid.UUID]*models.Equipment, currency models.Currency, startDate, endDate time.Time) (*models.PriceBreakdown, error)
+	PriceExtension(rental *models.Rental, equipment map[uuid.UUID]*models.Equipment, newEnd time.Time) (*models.PriceBreakdown, error)
+}
+
+// PricingEngine prices rentals from the rates of their equipment
+type PricingEngine struct {
+	equipmentRepo repositories.EquipmentRepository
+	exchangeRates *ExchangeRates
+	rounding      DayRounding
+}
+
+// NewPricingEngine creates a new PricingEngine
+func NewPricingEngine(equipmentRepo repositories.EquipmentRepository, exchangeRateRepo repositories.ExchangeRateRepository) *PricingEngine {
+	return &PricingEngine{equipmentRepo, NewExchangeRates(exchangeRateRepo), DayRoundingFromEnv()}
+}
+
+// PriceRental prices every item for the period in the given currency,
+// converting equipment prices at the exchange rates in force now. The
+// equipment map must contain every item's equipment.
+func (e *PricingEngine) PriceRental(items []models.RentalItem, equipment map[uuid.UUID]*models.Equipment, currency models.Currency, startDate, endDate time.Time) (*models.PriceBreakdown, error) {
+	if !endDate.After(startDate) {
+		return nil, ErrInvalidRentalPeriod
+	}
+
+	now := time.Now()
+	currency = currency.OrDefault()
+	rate, err := e.exchangeRates.Rate(currency, now)
+	if err != nil {
+		return nil, err
+	}
+	exchangeRates := map[models.Currency]float64{currency: rate}
+
+	categories := make(map[uuid.UUID]*models.EquipmentCategory)
+	breakdown := &models.PriceBreakdown{Currency: currency, ExchangeRate: rate}
+	for _, item := range items {
+		eq := equipment[item.EquipmentID]
+		category, err := e.category(eq.CategoryID, categories)
+		if err != nil {
+			return nil, err
+		}
+		equipmentRate, ok := exchangeRates[eq.Currency.OrDefault()]
+		if !ok {
+			if equipmentRate, err = e.exchangeRates.Rate(eq.Currency, now); err != nil {
+				return nil, err
+			}
+			exchangeRates[eq.Currency.OrDefault()] = equipmentRate
+		}
+
+		conv := conversion{factor: equipmentRate / rate, currency: currency}
+		line := priceLine(eq, category, conv, item.Quantity, e.rounding.BillableDays(startDate, endDate), startDate)
+		line.TaxExempt = category != nil && category.TaxExempt
+		line.Deposit = unitDeposit(eq, category, conv) * models.Money(item.Quantity)
+		breakdown.Lines = append(breakdown.Lines, line)
+		breakdown.Subtotal += line.LineTotal
+		breakdown.Deposit += line.Deposit
+	}
+	breakdown.Total = breakdown.Subtotal
+	return breakdown, nil
+}
+
+// PriceExtension prices the extra days of moving the end of the rental to
+// newEnd at the unit prices snapshotted on its items, so each extra day costs
+// what a booked day did. Amounts are in the rental's currency at the rate it
+// was booked at. Items booked before prices were snapshotted are priced from
+// the current rates of their equipment.
+func (e *PricingEngine) PriceExtension(rental *models.Rental, equipment map[uuid.UUID]*models.Equipment, newEnd time.Time) (*models.PriceBreakdown, error) {
+	if !newEnd.After(rental.EndDate) {
+		return nil, ErrInvalidRentalPeriod
+	}
+
+	currency := rental.Currency.OrDefault()
+	rentalRate := rental.ExchangeRate
+	if rentalRate <= 0 {
+		rentalRate = 1
+	}
+	days := e.rounding.BillableDays(rental.StartDate, newEnd)
+
+	categories := make(map[uuid.UUID]*models.EquipmentCategory)
+	breakdown := &models.PriceBreakdown{Currency: currency, ExchangeRate: rentalRate}
+	for _, item := range rental.Items {
+		eq := equipment[item.EquipmentID]
+		category, err := e.category(eq.CategoryID, categories)
+		if err != nil {
+			return nil, err
+		}
+
+		unitPrice, bookedDays := item.UnitPrice, item.Days
+		if bookedDays == 0 {
+			equipmentRate, err := e.exchangeRates.Rate(eq.Currency, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			conv := conversion{factor: equipmentRate / rentalRate, currency: currency}
+			booked := priceLine(eq, category, conv, 1, e.rounding.BillableDays(rental.StartDate, rental.EndDate), rental.StartDate)
+			unitPrice, bookedDays = booked.UnitPrice, booked.Days
+		}
+		extraDays := days - bookedDays
+		if extraDays <= 0 {
+			continue
+		}
+
+		dayPrice := unitPrice.Mul(1 / float64(bookedDays)).Round(currency)
+		line := models.PriceLine{
+			EquipmentID:   item.EquipmentID,
+			EquipmentName: eq.Name,
+			Quantity:      item.Quantity,
+			Days:          extraDays,
+			UnitPrice:     dayPrice * models.Money(extraDays),
+			Components: []models.PriceComponent{{
+				Label:     "extra day",
+				Units:     extraDays,
+				UnitPrice: dayPrice,
+				Amount:    dayPrice * models.Money(extraDays),
+			}},
+			TaxExempt: category != nil && category.TaxExempt,
+		}
+		line.LineTotal = line.UnitPrice * models.Money(item.Quantity)
+		breakdown.Lines = append(breakdown.Lines, line)
+		breakdown.Subtotal += line.LineTotal
+	}
+	breakdown.Total = breakdown.Subtotal
+	return breakdown, nil
+}
+
+func (e *PricingEngine) category(id uuid.UUID, cache map[uuid.UUID]*models.EquipmentCategory) (*models.EquipmentCategory, error) {
+	if id == uuid.Nil {
+		return nil, nil
+	}
+	if category, ok := cache[id]; ok {
+		return category, nil
+	}
+	category, err := e.equipmentRepo.FindCategoryByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load category %s: %w", id, err)
+	}
+	cache[id] = category
+	return category, nil
+}
+
+// effectiveRates applies the category defaults to the equipment's own rates
+// and converts them into the currency of the rental
+func effectiveRates(equipment *models.Equipment, category *models.EquipmentCategory, conv conversion) rates {
+	r := rates{
+		daily:   conv.convert(equipment.RentalPrice),
+		weekend: conv.convert(equipment.WeekendRate),
+		weekly:  conv.convert(equipment.WeeklyRate),
+		monthly: conv.convert(equipment.MonthlyRate),
+		minDays: equipment.MinRentalDays,
+	}
+	if category != nil {
+		if r.weekend == 0 {
+			r.weekend = r.daily.Mul(category.WeekendRateFactor).Round(conv.currency)
+		}
+		if r.weekly == 0 {
+			r.weekly = r.daily.Mul(category.WeeklyRateFactor).Round(conv.currency)
+		}
+		if r.monthly == 0 {
+			r.monthly = r.daily.Mul(category.MonthlyRateFactor).Round(conv.currency)
+		}
+		if r.minDays == 0 {
+			r.minDays = category.MinRentalDays
+		}
+	}
+	if r.weekend == 0 {
+		r.weekend = r.daily
+	}
+	return r
+}
+
+// unitDeposit is the security deposit for one unit of the equipment in the
+// currency of the rental. The equipment's own deposit overrides the
+// category's.
+func unitDeposit(equipment *models.Equipment, category *models.EquipmentCategory, conv conversion) models.Money {
+	deposit := equipment.DepositAmount
+	if deposit == 0 && category != nil {
+		deposit = category.DepositAmount
+	}
+	return conv.convert(deposit)
+}
+
+// priceLine charges whole months first, then whole weeks, then single days at
+// the weekday or weekend rate. A remainder is replaced by the next larger
+// period whenever that period is cheaper.
+func priceLine(equipment *models.Equipment, category *models.EquipmentCategory, conv conversion, quantity, days int, startDate time.Time) models.PriceLine {
+	r := effectiveRates(equipment, category, conv)
+	if days < r.minDays {
+		days = r.minDays
+	}
+
+	months, weeks, remaining := 0, 0, days
+	if r.monthly > 0 {
+		months, remaining = remaining/daysPerMonth, remaining%daysPerMonth
+	}
+	if r.weekly > 0 {
+		weeks, remaining = remaining/daysPerWeek, remaining%daysPerWeek
+	}
+
+	offset := months*daysPerMonth + weeks*daysPerWeek
+	weekdays, weekendDays := 0, 0
+	for i := 0; i < remaining; i++ {
+		switch startDate.AddDate(0, 0, offset+i).Weekday() {
+		case time.Saturday, time.Sunday:
+			weekendDays++
+		default:
+			weekdays++
+		}
+	}
+	dayCost := r.daily*models.Money(weekdays) + r.weekend*models.Money(weekendDays)
+
+	if r.weekly > 0 && remaining > 0 && dayCost > r.weekly {
+		weeks++
+		weekdays, weekendDays, dayCost = 0, 0, 0
+	}
+	if r.monthly > 0 && r.weekly*models.Money(weeks)+dayCost > r.monthly {
+		months++
+		weeks, weekdays, weekendDays = 0, 0, 0
+	}
+
+	var components []models.PriceComponent
+	add := func(label string, units int, unitPrice models.Money) {
+		if units > 0 {
+			unitPrice = unitPrice.Round(conv.currency)
+			components = append(components, models.PriceComponent{
+				Label:     label,
+				Units:     units,
+				UnitPrice: unitPrice,
+				Amount:    unitPrice * models.Money(units),
+			})
+		}
+	}
+	add("month", months, r.monthly)
+	add("week", weeks, r.weekly)
+	add("weekday", weekdays, r.daily)
+	add("weekend day", weekendDays, r.weekend)
+
+	var unitPrice models.Money
+	for _, component := range components {
+		unitPrice += component.Amount
+	}
+
+	return models.PriceLine{
+		EquipmentID:   equipment.ID,
+		EquipmentName: equipment.Name,
+		Quantity:      quantity,
+		Days:          days,
+		UnitPrice:     unitPrice,
+		Components:    components,
+		LineTotal:     unitPrice * models.Money(quantity),
+	}
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestDayRounding_BillableDays(t *testing.T) {
+	start := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		rounding DayRounding
+		duration time.Duration
+		want     int
+	}{
+		{"one hour is a day", DayRounding{Mode: RoundUp}, time.Hour, 1},
+		{"started day rounds up", DayRounding{Mode: RoundUp}, 25 * time.Hour, 2},
+		{"grace period", DayRounding{Mode: RoundUp, Grace: 2 * time.Hour}, 25 * time.Hour, 1},
+		{"nearest rounds down", DayRounding{Mode: RoundNearest}, 35 * time.Hour, 1},
+		{"nearest rounds up", DayRounding{Mode: RoundNearest}, 36 * time.Hour, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rounding.BillableDays(start, start.Add(tt.duration)))
+		})
+	}
+}
+
+func TestPricingEngine_PriceRental(t *testing.T) {
+	mockRepo := new(repositories.MockEquipmentRepository)
+	engine := &PricingEngine{mockRepo, NewExchangeRates(new(repositories.MockExchangeRateRepository)), DayRounding{Mode: RoundUp}}
+
+	category := &models.EquipmentCategory{
+		ID:                uuid.New(),
+		WeekendRateFactor: 1.5,
+		WeeklyRateFactor:  5,
+		MinRentalDays:     2,
+	}
+	mockRepo.On("FindCategoryByID", category.ID).Return(category, nil)
+
+	// Monday
+	monday := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		equipment models.Equipment
+		quantity  int
+		start     time.Time
+		duration  time.Duration
+		want      float64
+	}{
+		{
+			name:      "weekdays at the daily rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100)},
+			quantity:  2,
+			start:     monday,
+			duration:  3 * day,
+			want:      600,
+		},
+		{
+			name:      "partial day is billed as a full day",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100)},
+			quantity:  1,
+			start:     monday,
+			duration:  day + time.Hour,
+			want:      200,
+		},
+		{
+			name:      "weekend rate from the category",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), CategoryID: category.ID},
+			quantity:  1,
+			start:     monday.AddDate(0, 0, 4),
+			duration:  3 * day,
+			want:      100 + 150 + 150,
+		},
+		{
+			name:      "minimum rental length from the category",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), CategoryID: category.ID},
+			quantity:  1,
+			start:     monday,
+			duration:  day,
+			want:      200,
+		},
+		{
+			name:      "weekly rate plus remaining days",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), WeeklyRate: models.NewMoney(500)},
+			quantity:  1,
+			start:     monday,
+			duration:  8 * day,
+			want:      600,
+		},
+		{
+			name:      "remaining days capped at the weekly rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), WeeklyRate: models.NewMoney(500)},
+			quantity:  1,
+			start:     monday,
+			duration:  6 * day,
+			want:      500,
+		},
+		{
+			name:      "monthly rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), WeeklyRate: models.NewMoney(500), MonthlyRate: models.NewMoney(1500)},
+			quantity:  1,
+			start:     monday,
+			duration:  31 * day,
+			want:      1600,
+		},
+		{
+			name:      "weeks capped at the monthly rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), WeeklyRate: models.NewMoney(500), MonthlyRate: models.NewMoney(1500)},
+			quantity:  1,
+			start:     monday,
+			duration:  28 * day,
+			want:      1500,
+		},
+		{
+			name:      "days capped at the monthly rate without a weekly rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), MonthlyRate: models.NewMoney(1500)},
+			quantity:  1,
+			start:     monday,
+			duration:  20 * day,
+			want:      1500,
+		},
+		{
+			name:      "monthly rate plus days without a weekly rate",
+			equipment: models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100), MonthlyRate: models.NewMoney(1500)},
+			quantity:  1,
+			start:     monday,
+			duration:  32 * day,
+			want:      1700,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []models.RentalItem{{EquipmentID: tt.equipment.ID, Quantity: tt.quantity}}
+			equipment := map[uuid.UUID]*models.Equipment{tt.equipment.ID: &tt.equipment}
+
+			breakdown, err := engine.PriceRental(items, equipment, models.DefaultCurrency, tt.start, tt.start.Add(tt.duration))
+
+			assert.NoError(t, err)
+			assert.Equal(t, models.NewMoney(tt.want), breakdown.Total)
+			assert.Len(t, breakdown.Lines, 1)
+		})
+	}
+
+	t.Run("invalid period", func(t *testing.T) {
+		_, err := engine.PriceRental(nil, nil, models.DefaultCurrency, monday, monday)
+		assert.ErrorIs(t, err, ErrInvalidRentalPeriod)
+	})
+}
+
+func TestPricingEngine_PriceRental_Currency(t *testing.T) {
+	mockRates := new(repositories.MockExchangeRateRepository)
+	engine := &PricingEngine{new(repositories.MockEquipmentRepository), NewExchangeRates(mockRates), DayRounding{Mode: RoundUp}}
+	mockRates.On("FindEffective", models.CurrencyUSD, mock.Anything).Return(&models.ExchangeRate{Currency: models.CurrencyUSD, Rate: 15000}, nil)
+	mockRates.On("FindEffective", models.CurrencySGD, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+
+	monday := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	rupiah := models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100000)}
+	dollar := models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(2.5), Currency: models.CurrencyUSD}
+	equipment := map[uuid.UUID]*models.Equipment{rupiah.ID: &rupiah, dollar.ID: &dollar}
+
+	t.Run("rupiah prices quoted in dollars", func(t *testing.T) {
+		items := []models.RentalItem{{EquipmentID: rupiah.ID, Quantity: 1}}
+		breakdown, err := engine.PriceRental(items, equipment, models.CurrencyUSD, monday, monday.Add(48*time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.CurrencyUSD, breakdown.Currency)
+		assert.Equal(t, 15000.0, breakdown.ExchangeRate)
+		// 100,000 / 15,000 = 6.67 a day
+		assert.Equal(t, models.NewMoney(13.34), breakdown.Total)
+	})
+
+	t.Run("dollar prices quoted in rupiah", func(t *testing.T) {
+		items := []models.RentalItem{{EquipmentID: dollar.ID, Quantity: 2}}
+		breakdown, err := engine.PriceRental(items, equipment, "", monday, monday.Add(24*time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.CurrencyIDR, breakdown.Currency)
+		assert.Equal(t, models.NewMoney(75000), breakdown.Total)
+	})
+
+	t.Run("currency without a rate", func(t *testing.T) {
+		items := []models.RentalItem{{EquipmentID: rupiah.ID, Quantity: 1}}
+		_, err := engine.PriceRental(items, equipment, models.CurrencySGD, monday, monday.Add(24*time.Hour))
+		assert.ErrorIs(t, err, ErrNoExchangeRate)
+	})
+}
+
+func TestPricingEngine_PriceRental_Deposit(t *testing.T) {
+	mockRepo := new(repositories.MockEquipmentRepository)
+	engine := &PricingEngine{mockRepo, NewExchangeRates(new(repositories.MockExchangeRateRepository)), DayRounding{Mode: RoundUp}}
+
+	category := &models.EquipmentCategory{ID: uuid.New(), DepositAmount: models.NewMoney(500000)}
+	mockRepo.On("FindCategoryByID", category.ID).Return(category, nil)
+
+	monday := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	camera := models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(100000), CategoryID: category.ID}
+	drone := models.Equipment{ID: uuid.New(), RentalPrice: models.NewMoney(300000), CategoryID: category.ID, DepositAmount: models.NewMoney(2000000)}
+	equipment := map[uuid.UUID]*models.Equipment{camera.ID: &camera, drone.ID: &drone}
+	items := []models.RentalItem{{EquipmentID: camera.ID, Quantity: 2}, {EquipmentID: drone.ID, Quantity: 1}}
+
+	breakdown, err := engine.PriceRental(items, equipment, models.DefaultCurrency, monday, monday.Add(24*time.Hour))
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1000000), breakdown.Lines[0].Deposit)
+	assert.Equal(t, models.NewMoney(2000000), breakdown.Lines[1].Deposit)
+	assert.Equal(t, models.NewMoney(3000000), breakdown.Deposit)
+	assert.Equal(t, models.NewMoney(500000), breakdown.Total)
+}
+
+func TestPricingEngine_PriceExtension(t *testing.T) {
+	mockRates := new(repositories.MockExchangeRateRepository)
+	engine := &PricingEngine{new(repositories.MockEquipmentRepository), NewExchangeRates(mockRates), DayRounding{Mode: RoundUp}}
+
+	monday := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	// The catalog price went up since the rental was booked
+	camera := models.Equipment{ID: uuid.New(), Name: "Camera", RentalPrice: models.NewMoney(150000)}
+	equipment := map[uuid.UUID]*models.Equipment{camera.ID: &camera}
+
+	t.Run("extra days at the booked price", func(t *testing.T) {
+		rental := &models.Rental{
+			StartDate:    monday,
+			EndDate:      monday.Add(48 * time.Hour),
+			Currency:     models.CurrencyUSD,
+			ExchangeRate: 15000,
+			Items: []models.RentalItem{{
+				EquipmentID: camera.ID,
+				Quantity:    2,
+				UnitPrice:   models.NewMoney(13.34),
+				Days:        2,
+			}},
+		}
+
+		breakdown, err := engine.PriceExtension(rental, equipment, monday.Add(72*time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.CurrencyUSD, breakdown.Currency)
+		assert.Equal(t, 15000.0, breakdown.ExchangeRate)
+		assert.Equal(t, 1, breakdown.Lines[0].Days)
+		assert.Equal(t, models.NewMoney(13.34), breakdown.Total)
+		mockRates.AssertNotCalled(t, "FindEffective", mock.Anything, mock.Anything)
+	})
+
+	t.Run("items without a snapshot use the current price", func(t *testing.T) {
+		rental := &models.Rental{
+			StartDate: monday,
+			EndDate:   monday.Add(24 * time.Hour),
+			Items:     []models.RentalItem{{EquipmentID: camera.ID, Quantity: 1}},
+		}
+
+		breakdown, err := engine.PriceExtension(rental, equipment, monday.Add(72*time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(300000), breakdown.Total)
+	})
+
+	t.Run("end date not moved", func(t *testing.T) {
+		rental := &models.Rental{StartDate: monday, EndDate: monday.Add(24 * time.Hour)}
+		_, err := engine.PriceExtension(rental, equipment, rental.EndDate)
+		assert.ErrorIs(t, err, ErrInvalidRentalPeriod)
+	})
+}
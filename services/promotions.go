@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PromotionError is returned when a promo code cannot be used on a rental.
+// The message can be shown to the customer.
+type PromotionError struct {
+	Message string
+}
+
+func (e *PromotionError) Error() string {
+	return e.Message
+}
+
+// PromotionService checks promo codes and applies their discounts to rental
+// prices. Usage limits are checked again when the rental is stored.
+type PromotionService struct {
+	repo repositories.PromotionRepository
+	now  func() time.Time
+}
+
+// NewPromotionService creates a new PromotionService
+func NewPromotionService(repo repositories.PromotionRepository) *PromotionService {
+	return &PromotionService{repo: repo, now: time.Now}
+}
+
+// Apply takes the discount of the promo code off the breakdown's total and
+// records the promotion on it. The equipment map must contain the equipment
+// of every line.
+func (s *PromotionService) Apply(code string, userID uuid.UUID, breakdown *models.PriceBreakdown, equipment map[uuid.UUID]*models.Equipment) error {
+	promotion, err := s.repo.FindByCode(code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &PromotionError{Message: "Promo code not found"}
+	}
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if !promotion.IsActive || (promotion.StartsAt != nil && now.Before(*promotion.StartsAt)) {
+		return &PromotionError{Message: "Promo code is not active"}
+	}
+	if promotion.EndsAt != nil && !now.Before(*promotion.EndsAt) {
+		return &PromotionError{Message: "Promo code has expired"}
+	}
+	if minOrder := breakdown.FromDefaultCurrency(promotion.MinOrderAmount); breakdown.Subtotal < minOrder {
+		return &PromotionError{Message: fmt.Sprintf("Promo code requires a minimum order of %s", minOrder.Format(breakdown.Currency))}
+	}
+
+	total, byUser, err := s.repo.CountRedemptions(promotion.ID, userID)
+	if err != nil {
+		return err
+	}
+	if promotion.UsageLimit > 0 && total >= int64(promotion.UsageLimit) {
+		return &PromotionError{Message: "Promo code has been used up"}
+	}
+	if promotion.PerUserLimit > 0 && byUser >= int64(promotion.PerUserLimit) {
+		return &PromotionError{Message: "You have already used this promo code"}
+	}
+
+	discount := PromotionDiscount(promotion, breakdown, equipment)
+	if discount <= 0 {
+		return &PromotionError{Message: "Promo code does not apply to these items"}
+	}
+
+	breakdown.Discount = discount
+	breakdown.Total = breakdown.Subtotal - discount
+	breakdown.PromotionID = &promotion.ID
+	breakdown.PromoCode = promotion.Code
+	return nil
+}
+
+// ApplyToExtension takes the discount of the rental's promotion off the price
+// of its extension. Only percentage discounts apply again, a fixed amount was
+// taken off once with the booking and a maximum discount covers both. The
+// promotion was checked when the rental was booked.
+func (s *PromotionService) ApplyToExtension(rental *models.Rental, breakdown *models.PriceBreakdown, equipment map[uuid.UUID]*models.Equipment) error {
+	if rental.PromoCode == "" {
+		return nil
+	}
+	promotion, err := s.repo.FindByCode(rental.PromoCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if promotion.DiscountType != models.DiscountTypePercentage {
+		return nil
+	}
+
+	discount := PromotionDiscount(promotion, breakdown, equipment)
+	if maxDiscount := breakdown.FromDefaultCurrency(promotion.MaxDiscount); maxDiscount > 0 {
+		discount = min(discount, max(maxDiscount-rental.DiscountAmount, 0))
+	}
+	if discount <= 0 {
+		return nil
+	}
+
+	breakdown.Discount = discount
+	breakdown.Total = breakdown.Subtotal - discount
+	breakdown.PromotionID = &promotion.ID
+	breakdown.PromoCode = promotion.Code
+	return nil
+}
+
+// PromotionDiscount is the discount the promotion gives on the lines it
+// applies to. It never exceeds the price of those lines. Fixed amounts and
+// limits of the promotion are in DefaultCurrency.
+func PromotionDiscount(promotion *models.Promotion, breakdown *models.PriceBreakdown, equipment map[uuid.UUID]*models.Equipment) models.Money {
+	var eligible models.Money
+	for _, line := range breakdown.Lines {
+		if promotion.EquipmentID != nil && *promotion.EquipmentID != line.EquipmentID {
+			continue
+		}
+		if promotion.CategoryID != nil {
+			eq, ok := equipment[line.EquipmentID]
+			if !ok || eq.CategoryID != *promotion.CategoryID {
+				continue
+			}
+		}
+		eligible += line.LineTotal
+	}
+
+	var discount models.Money
+	switch promotion.DiscountType {
+	case models.DiscountTypePercentage:
+		discount = eligible.Mul(promotion.DiscountValue / 100).Round(breakdown.Currency)
+		if maxDiscount := breakdown.FromDefaultCurrency(promotion.MaxDiscount); maxDiscount > 0 && discount > maxDiscount {
+			discount = maxDiscount
+		}
+	case models.DiscountTypeFixed:
+		discount = breakdown.FromDefaultCurrency(models.NewMoney(promotion.DiscountValue).Round(models.DefaultCurrency))
+	}
+	if discount > eligible {
+		discount = eligible
+	}
+	return discount
+}
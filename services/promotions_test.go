@@ -0,0 +1,196 @@
+package services
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPromotionDiscount(t *testing.T) {
+	categoryID := uuid.New()
+	camera := &models.Equipment{ID: uuid.New(), CategoryID: categoryID}
+	tent := &models.Equipment{ID: uuid.New(), CategoryID: uuid.New()}
+	equipment := map[uuid.UUID]*models.Equipment{camera.ID: camera, tent.ID: tent}
+	breakdown := &models.PriceBreakdown{
+		Lines: []models.PriceLine{
+			{EquipmentID: camera.ID, LineTotal: models.NewMoney(300000)},
+			{EquipmentID: tent.ID, LineTotal: models.NewMoney(200000)},
+		},
+		Subtotal: models.NewMoney(500000),
+	}
+
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		want      float64
+	}{
+		{"percentage of the whole order", models.Promotion{DiscountType: models.DiscountTypePercentage, DiscountValue: 10}, 50000},
+		{"percentage capped", models.Promotion{DiscountType: models.DiscountTypePercentage, DiscountValue: 10, MaxDiscount: models.NewMoney(25000)}, 25000},
+		{"percentage of one category", models.Promotion{DiscountType: models.DiscountTypePercentage, DiscountValue: 10, CategoryID: &categoryID}, 30000},
+		{"fixed on one item", models.Promotion{DiscountType: models.DiscountTypeFixed, DiscountValue: 50000, EquipmentID: &tent.ID}, 50000},
+		{"fixed limited to the eligible lines", models.Promotion{DiscountType: models.DiscountTypeFixed, DiscountValue: 250000, EquipmentID: &tent.ID}, 200000},
+		{"no eligible lines", models.Promotion{DiscountType: models.DiscountTypeFixed, DiscountValue: 50000, EquipmentID: &uuid.Nil}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, models.NewMoney(tt.want), PromotionDiscount(&tt.promotion, breakdown, equipment))
+		})
+	}
+}
+
+func TestPromotionService_Apply(t *testing.T) {
+	mockRepo := new(repositories.MockPromotionRepository)
+	service := NewPromotionService(mockRepo)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	userID := uuid.New()
+	started := now.Add(-24 * time.Hour)
+	ended := now.Add(-time.Hour)
+	equipmentID := uuid.New()
+	equipment := map[uuid.UUID]*models.Equipment{equipmentID: {ID: equipmentID}}
+	newBreakdown := func() *models.PriceBreakdown {
+		return &models.PriceBreakdown{
+			Lines:    []models.PriceLine{{EquipmentID: equipmentID, LineTotal: models.NewMoney(400000)}},
+			Subtotal: models.NewMoney(400000),
+			Total:    models.NewMoney(400000),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		promotion   *models.Promotion
+		redemptions [2]int64
+		wantErr     string
+		wantTotal   float64
+	}{
+		{
+			name:      "applied",
+			promotion: &models.Promotion{ID: uuid.New(), Code: "WEDDING10", DiscountType: models.DiscountTypePercentage, DiscountValue: 10, IsActive: true, StartsAt: &started, PerUserLimit: 1},
+			wantTotal: 360000,
+		},
+		{
+			name:      "inactive",
+			promotion: &models.Promotion{ID: uuid.New(), DiscountType: models.DiscountTypeFixed, DiscountValue: 1000},
+			wantErr:   "Promo code is not active",
+		},
+		{
+			name:      "expired",
+			promotion: &models.Promotion{ID: uuid.New(), DiscountType: models.DiscountTypeFixed, DiscountValue: 1000, IsActive: true, EndsAt: &ended},
+			wantErr:   "Promo code has expired",
+		},
+		{
+			name:      "below minimum order",
+			promotion: &models.Promotion{ID: uuid.New(), DiscountType: models.DiscountTypeFixed, DiscountValue: 1000, IsActive: true, MinOrderAmount: models.NewMoney(500000)},
+			wantErr:   "Promo code requires a minimum order of IDR 500,000",
+		},
+		{
+			name:        "used up",
+			promotion:   &models.Promotion{ID: uuid.New(), DiscountType: models.DiscountTypeFixed, DiscountValue: 1000, IsActive: true, UsageLimit: 100},
+			redemptions: [2]int64{100, 0},
+			wantErr:     "Promo code has been used up",
+		},
+		{
+			name:        "already used by the user",
+			promotion:   &models.Promotion{ID: uuid.New(), DiscountType: models.DiscountTypeFixed, DiscountValue: 1000, IsActive: true, PerUserLimit: 1},
+			redemptions: [2]int64{5, 1},
+			wantErr:     "You have already used this promo code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("FindByCode", "CODE").Return(tt.promotion, nil)
+			mockRepo.On("CountRedemptions", tt.promotion.ID, userID).Return(tt.redemptions[0], tt.redemptions[1], nil)
+
+			breakdown := newBreakdown()
+			err := service.Apply("CODE", userID, breakdown, equipment)
+			if tt.wantErr != "" {
+				var promotionErr *PromotionError
+				assert.ErrorAs(t, err, &promotionErr)
+				assert.Equal(t, tt.wantErr, err.Error())
+				assert.Equal(t, models.NewMoney(400000), breakdown.Total)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, models.NewMoney(tt.wantTotal), breakdown.Total)
+			assert.Equal(t, tt.promotion.Code, breakdown.PromoCode)
+			assert.Equal(t, tt.promotion.ID, *breakdown.PromotionID)
+		})
+	}
+
+	t.Run("unknown code", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		mockRepo.On("FindByCode", "NOPE").Return(nil, gorm.ErrRecordNotFound)
+
+		err := service.Apply("NOPE", userID, newBreakdown(), equipment)
+		assert.EqualError(t, err, "Promo code not found")
+	})
+}
+
+func TestPromotionService_ApplyToExtension(t *testing.T) {
+	mockRepo := new(repositories.MockPromotionRepository)
+	service := NewPromotionService(mockRepo)
+
+	equipmentID := uuid.New()
+	equipment := map[uuid.UUID]*models.Equipment{equipmentID: {ID: equipmentID}}
+	newBreakdown := func() *models.PriceBreakdown {
+		return &models.PriceBreakdown{
+			Lines:    []models.PriceLine{{EquipmentID: equipmentID, LineTotal: models.NewMoney(200000)}},
+			Subtotal: models.NewMoney(200000),
+			Total:    models.NewMoney(200000),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		promotion *models.Promotion
+		discount  float64
+		wantTotal float64
+	}{
+		{
+			name:      "percentage applies to the extra days",
+			promotion: &models.Promotion{ID: uuid.New(), Code: "CODE", DiscountType: models.DiscountTypePercentage, DiscountValue: 10},
+			discount:  40000,
+			wantTotal: 180000,
+		},
+		{
+			name:      "maximum discount shared with the booking",
+			promotion: &models.Promotion{ID: uuid.New(), Code: "CODE", DiscountType: models.DiscountTypePercentage, DiscountValue: 10, MaxDiscount: models.NewMoney(50000)},
+			discount:  40000,
+			wantTotal: 190000,
+		},
+		{
+			name:      "fixed amount given once",
+			promotion: &models.Promotion{ID: uuid.New(), Code: "CODE", DiscountType: models.DiscountTypeFixed, DiscountValue: 40000},
+			discount:  40000,
+			wantTotal: 200000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.On("FindByCode", "CODE").Return(tt.promotion, nil)
+
+			rental := &models.Rental{PromoCode: "CODE", DiscountAmount: models.NewMoney(tt.discount)}
+			breakdown := newBreakdown()
+			assert.NoError(t, service.ApplyToExtension(rental, breakdown, equipment))
+			assert.Equal(t, models.NewMoney(tt.wantTotal), breakdown.Total)
+		})
+	}
+
+	t.Run("rental without a promo code", func(t *testing.T) {
+		mockRepo.ExpectedCalls = nil
+		breakdown := newBreakdown()
+		assert.NoError(t, service.ApplyToExtension(&models.Rental{}, breakdown, equipment))
+		assert.Equal(t, models.NewMoney(200000), breakdown.Total)
+	})
+}
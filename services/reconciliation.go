@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultReconciliationPageSize is how many records are loaded per request
+// while reconciling
+const defaultReconciliationPageSize = 100
+
+// Kinds of discrepancies the reconciler cannot resolve on its own
+const (
+	// DiscrepancyUnknownTransaction is a gateway payment that matches no
+	// payment of ours
+	DiscrepancyUnknownTransaction = "UNKNOWN_TRANSACTION"
+	// DiscrepancyUnderpaid is a gateway payment of less than the amount due
+	DiscrepancyUnderpaid = "UNDERPAID"
+	// DiscrepancyAmountMismatch is a recorded payment whose paid amount
+	// differs from the gateway's
+	DiscrepancyAmountMismatch = "AMOUNT_MISMATCH"
+	// DiscrepancyPaidButFailed is money received for a payment we marked as
+	// FAILED
+	DiscrepancyPaidButFailed = "PAID_BUT_FAILED"
+	// DiscrepancyNotPaidAtGateway is a recorded payment the gateway reports as
+	// failed, voided or reversed
+	DiscrepancyNotPaidAtGateway = "NOT_PAID_AT_GATEWAY"
+	// DiscrepancyMissingTransaction is a recorded payment with no gateway
+	// payment in the window
+	DiscrepancyMissingTransaction = "MISSING_TRANSACTION"
+	// DiscrepancyDuplicateTransaction is a second successful gateway payment
+	// for the same payment
+	DiscrepancyDuplicateTransaction = "DUPLICATE_TRANSACTION"
+)
+
+// ReconciliationFix is a payment whose status was corrected from the gateway
+type ReconciliationFix struct {
+	PaymentID     uuid.UUID `json:"payment_id"`
+	TransactionID string    `json:"transaction_id"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+}
+
+// Discrepancy is a mismatch that needs to be looked at by hand
+type Discrepancy struct {
+	Kind              string       `json:"kind"`
+	PaymentID         *uuid.UUID   `json:"payment_id,omitempty"`
+	TransactionID     string       `json:"transaction_id,omitempty"`
+	PaymentStatus     string       `json:"payment_status,omitempty"`
+	TransactionStatus string       `json:"transaction_status,omitempty"`
+	ExpectedAmount    models.Money `json:"expected_amount"`
+	GatewayAmount     models.Money `json:"gateway_amount"`
+	Detail            string       `json:"detail"`
+}
+
+// ReconciliationReport is the outcome of a reconciliation run
+type ReconciliationReport struct {
+	From          time.Time           `json:"from"`
+	To            time.Time           `json:"to"`
+	Transactions  int                 `json:"transactions"`
+	Matched       int                 `json:"matched"`
+	Fixes         []ReconciliationFix `json:"fixes"`
+	Discrepancies []Discrepancy       `json:"discrepancies"`
+}
+
+// Reconciler compares the payments the gateway received with our payments.
+// Payments that are still PENDING or EXPIRED here are settled or failed from
+// the gateway's status. Everything else that does not agree is reported.
+type Reconciler struct {
+	paymentRepo repositories.PaymentRepository
+	settlement  *PaymentSettlement
+	gateway     gateways.PaymentGateway
+	pageSize    int
+}
+
+// NewReconciler creates a new Reconciler
+func NewReconciler(paymentRepo repositories.PaymentRepository, rentalRepo repositories.RentalRepository, userRepo repositories.UserRepository, gateway gateways.PaymentGateway) *Reconciler {
+	return &Reconciler{
+		paymentRepo: paymentRepo,
+		settlement:  NewPaymentSettlement(paymentRepo, rentalRepo, userRepo),
+		gateway:     gateway,
+		pageSize:    defaultReconciliationPageSize,
+	}
+}
+
+// Run reconciles the gateway payments created within the window, then
+// reports payments paid within the window that the gateway does not know of
+func (r *Reconciler) Run(ctx context.Context, from, to time.Time) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{
+		From:          from,
+		To:            to,
+		Fixes:         []ReconciliationFix{},
+		Discrepancies: []Discrepancy{},
+	}
+	seen := make(map[uuid.UUID]bool)
+
+	afterID := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		page, err := r.gateway.ListTransactions(ctx, gateways.TransactionListRequest{
+			Types:       []string{gateways.TransactionTypePayment},
+			CreatedFrom: from,
+			CreatedTo:   to,
+			Limit:       r.pageSize,
+			AfterID:     afterID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list gateway transactions: %w", err)
+		}
+
+		for _, transaction := range page.Data {
+			report.Transactions++
+			if err := r.reconcileTransaction(transaction, report, seen); err != nil {
+				return nil, err
+			}
+			afterID = transaction.ID
+		}
+		if !page.HasMore || len(page.Data) == 0 {
+			break
+		}
+	}
+
+	if err := r.findMissing(from, to, report, seen); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *Reconciler) reconcileTransaction(transaction gateways.Transaction, report *ReconciliationReport, seen map[uuid.UUID]bool) error {
+	payment, err := r.findPayment(transaction)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		if transaction.Status == gateways.TransactionStatusSuccess {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:              DiscrepancyUnknownTransaction,
+				TransactionID:     transaction.ID,
+				TransactionStatus: transaction.Status,
+				GatewayAmount:     models.NewMoney(transaction.Amount),
+				Detail:            fmt.Sprintf("no payment with invoice %q or reference %q", transaction.ProductID, transaction.ReferenceID),
+			})
+		}
+		return nil
+	}
+	report.Matched++
+
+	switch transaction.Status {
+	case gateways.TransactionStatusSuccess:
+		if seen[payment.ID] {
+			report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyDuplicateTransaction, payment, transaction, "payment was already received in another transaction"))
+			return nil
+		}
+		seen[payment.ID] = true
+		return r.reconcilePaid(payment, transaction, report)
+
+	case gateways.TransactionStatusFailed, gateways.TransactionStatusVoided:
+		return r.reconcileFailed(payment, transaction, report)
+
+	case gateways.TransactionStatusReversed:
+		if isPaid(payment) {
+			report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyNotPaidAtGateway, payment, transaction, "payment was reversed at the gateway"))
+		}
+	}
+	// Pending transactions are left for the callback
+	return nil
+}
+
+// reconcilePaid handles money the gateway received for the payment
+func (r *Reconciler) reconcilePaid(payment *models.Payment, transaction gateways.Transaction, report *ReconciliationReport) error {
+	switch payment.PaymentStatus {
+	case models.PaymentStatusPending, models.PaymentStatusExpired:
+		fromStatus := payment.PaymentStatus
+		settlement, err := r.settlement.Record(payment, PaidDetails{
+			Amount:    models.NewMoney(transaction.Amount),
+			PaymentID: transaction.ProductID,
+			Channel:   transaction.ChannelCode,
+			PaidAt:    transaction.Created,
+		})
+		if errors.Is(err, ErrUnderpaid) {
+			report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyUnderpaid, payment, transaction, "gateway received less than the amount due"))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to settle payment %s: %w", payment.ID, err)
+		}
+		if settlement.Duplicate {
+			// The callback recorded it while we were looking
+			return nil
+		}
+		report.Fixes = append(report.Fixes, ReconciliationFix{
+			PaymentID:     payment.ID,
+			TransactionID: transaction.ID,
+			FromStatus:    fromStatus,
+			ToStatus:      settlement.Payment.PaymentStatus,
+		})
+
+	case models.PaymentStatusUnderpaid:
+		report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyUnderpaid, payment, transaction,
+			fmt.Sprintf("recorded as underpaid with %s paid, waiting for review", payment.PaidAmount())))
+
+	case models.PaymentStatusFailed:
+		report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyPaidButFailed, payment, transaction, "gateway received a payment we marked as failed"))
+
+	default:
+		if received := models.NewMoney(transaction.Amount); payment.PaidAmount() != received {
+			report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyAmountMismatch, payment, transaction,
+				fmt.Sprintf("recorded %s paid, gateway received %s", payment.PaidAmount(), received)))
+		}
+	}
+	return nil
+}
+
+// reconcileFailed handles a payment the gateway reports as failed or voided
+func (r *Reconciler) reconcileFailed(payment *models.Payment, transaction gateways.Transaction, report *ReconciliationReport) error {
+	if isPaid(payment) {
+		report.Discrepancies = append(report.Discrepancies, discrepancy(DiscrepancyNotPaidAtGateway, payment, transaction, "gateway reports the payment as "+transaction.Status))
+		return nil
+	}
+	if payment.PaymentStatus != models.PaymentStatusPending {
+		return nil
+	}
+
+	if err := r.paymentRepo.MarkFailed(payment); err != nil {
+		// Paid or expired in the meantime, the next run looks at it again
+		if errors.Is(err, repositories.ErrPaymentNotPending) {
+			return nil
+		}
+		return fmt.Errorf("failed to mark payment %s as failed: %w", payment.ID, err)
+	}
+	report.Fixes = append(report.Fixes, ReconciliationFix{
+		PaymentID:     payment.ID,
+		TransactionID: transaction.ID,
+		FromStatus:    models.PaymentStatusPending,
+		ToStatus:      models.PaymentStatusFailed,
+	})
+	return nil
+}
+
+// findMissing reports payments paid within the window that no gateway
+// payment was seen for
+func (r *Reconciler) findMissing(from, to time.Time, report *ReconciliationReport, seen map[uuid.UUID]bool) error {
+	filter := repositories.PaymentFilter{PaidFrom: from, PaidTo: to}
+	for offset := 0; ; offset += r.pageSize {
+		payments, total, err := r.paymentRepo.FindWithFilter(filter, r.pageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to load paid payments: %w", err)
+		}
+		for i := range payments {
+			payment := &payments[i]
+			if seen[payment.ID] || !isPaid(payment) {
+				continue
+			}
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:           DiscrepancyMissingTransaction,
+				PaymentID:      &payment.ID,
+				PaymentStatus:  payment.PaymentStatus,
+				ExpectedAmount: payment.PaidAmount(),
+				Detail:         "no successful gateway payment found",
+			})
+		}
+		if len(payments) == 0 || int64(offset+len(payments)) >= total {
+			return nil
+		}
+	}
+}
+
+// findPayment matches a transaction by the ID of its charge, falling back to
+// the reference we sent. Virtual account and QR code transactions name the
+// payment rather than the account or QR code, so they match by reference.
+func (r *Reconciler) findPayment(transaction gateways.Transaction) (*models.Payment, error) {
+	if transaction.ProductID != "" {
+		payment, err := r.paymentRepo.FindByInvoiceID(transaction.ProductID)
+		if err == nil {
+			return payment, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load payment of transaction %s: %w", transaction.ID, err)
+		}
+	}
+	if transaction.ReferenceID != "" {
+		payment, err := r.paymentRepo.FindByExternalID(transaction.ReferenceID)
+		if err == nil {
+			return payment, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load payment of transaction %s: %w", transaction.ID, err)
+		}
+	}
+	return nil, nil
+}
+
+func discrepancy(kind string, payment *models.Payment, transaction gateways.Transaction, detail string) Discrepancy {
+	return Discrepancy{
+		Kind:              kind,
+		PaymentID:         &payment.ID,
+		TransactionID:     transaction.ID,
+		PaymentStatus:     payment.PaymentStatus,
+		TransactionStatus: transaction.Status,
+		ExpectedAmount:    payment.Amount,
+		GatewayAmount:     models.NewMoney(transaction.Amount),
+		Detail:            detail,
+	}
+}
+
+// isPaid reports whether we recorded money for the payment, including
+// payments that were refunded since
+func isPaid(payment *models.Payment) bool {
+	switch payment.PaymentStatus {
+	case models.PaymentStatusCompleted, models.PaymentStatusRefundPending,
+		models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestReconciler_Run(t *testing.T) {
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	mockRentalRepo := new(repositories.MockRentalRepository)
+	mockUserRepo := new(repositories.MockUserRepository)
+	gateway := gateways.NewFakeGateway()
+
+	reconciler := NewReconciler(mockPaymentRepo, mockRentalRepo, mockUserRepo, gateway)
+	reconciler.pageSize = 2
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	created := from.Add(time.Hour)
+
+	rental := &models.Rental{ID: uuid.New(), Status: models.RentalStatusPaid}
+	unsettled := &models.Payment{ID: uuid.New(), RentalID: rental.ID, Amount: models.NewMoney(150000), PaymentStatus: models.PaymentStatusPending, XenditInvoiceID: "ewc-1"}
+	failed := &models.Payment{ID: uuid.New(), Amount: models.NewMoney(50000), PaymentStatus: models.PaymentStatusPending, XenditInvoiceID: "ewc-2"}
+	mismatched := &models.Payment{ID: uuid.New(), Amount: models.NewMoney(100000), XenditPaidAmount: models.NewMoney(100000), PaymentStatus: models.PaymentStatusCompleted, XenditExternalID: "payment-3"}
+	missing := models.Payment{ID: uuid.New(), Amount: models.NewMoney(75000), PaymentStatus: models.PaymentStatusCompleted}
+
+	gateway.Transactions = []gateways.Transaction{
+		{ID: "txn-1", ProductID: "ewc-1", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 150000, ChannelCode: "ID_DANA", Created: created},
+		{ID: "txn-2", ProductID: "ewc-2", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusFailed, Amount: 50000, Created: created},
+		{ID: "txn-3", Type: gateways.TransactionTypeRefund, Status: gateways.TransactionStatusSuccess, Amount: 10000, Created: created},
+		{ID: "txn-4", ProductID: "qrpy-3", ReferenceID: "payment-3", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 90000, Created: created},
+		{ID: "txn-5", ProductID: "ewc-9", ReferenceID: "payment-9", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 20000, Created: created},
+		{ID: "txn-6", ProductID: "ewc-1", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 150000, Created: to.Add(time.Hour)},
+	}
+
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-1").Return(unsettled, nil)
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-2").Return(failed, nil)
+	mockPaymentRepo.On("FindByInvoiceID", "qrpy-3").Return(nil, gorm.ErrRecordNotFound)
+	mockPaymentRepo.On("FindByExternalID", "payment-3").Return(mismatched, nil)
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-9").Return(nil, gorm.ErrRecordNotFound)
+	mockPaymentRepo.On("FindByExternalID", "payment-9").Return(nil, gorm.ErrRecordNotFound)
+
+	mockPaymentRepo.On("MarkPaid", mock.MatchedBy(func(payment *models.Payment) bool {
+		return payment.ID == unsettled.ID && payment.XenditPaidAmount == models.NewMoney(150000) && payment.PaidAt.Equal(created)
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.Payment).PaymentStatus = models.PaymentStatusCompleted
+	}).Return(nil)
+	mockRentalRepo.On("FindByID", rental.ID).Return(rental, nil)
+	mockPaymentRepo.On("MarkFailed", failed).Return(nil)
+	mockPaymentRepo.On("FindWithFilter", repositories.PaymentFilter{PaidFrom: from, PaidTo: to}, 2, 0).
+		Return([]models.Payment{*unsettled, missing}, int64(2), nil)
+
+	report, err := reconciler.Run(context.Background(), from, to)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Transactions)
+	assert.Equal(t, 3, report.Matched)
+	assert.Equal(t, []ReconciliationFix{
+		{PaymentID: unsettled.ID, TransactionID: "txn-1", FromStatus: models.PaymentStatusPending, ToStatus: models.PaymentStatusCompleted},
+		{PaymentID: failed.ID, TransactionID: "txn-2", FromStatus: models.PaymentStatusPending, ToStatus: models.PaymentStatusFailed},
+	}, report.Fixes)
+
+	kinds := make([]string, 0, len(report.Discrepancies))
+	for _, discrepancy := range report.Discrepancies {
+		kinds = append(kinds, discrepancy.Kind)
+	}
+	assert.Equal(t, []string{DiscrepancyAmountMismatch, DiscrepancyUnknownTransaction, DiscrepancyMissingTransaction}, kinds)
+	assert.Equal(t, missing.ID, *report.Discrepancies[2].PaymentID)
+
+	// Two full pages, the second one pointing after the last transaction seen
+	assert.Len(t, gateway.TransactionListRequests, 2)
+	assert.Equal(t, "txn-2", gateway.TransactionListRequests[1].AfterID)
+	mockPaymentRepo.AssertExpectations(t)
+}
+
+func TestReconciler_RunReportsUnderpaidAndDuplicates(t *testing.T) {
+	mockPaymentRepo := new(repositories.MockPaymentRepository)
+	gateway := gateways.NewFakeGateway()
+	reconciler := NewReconciler(mockPaymentRepo, new(repositories.MockRentalRepository), new(repositories.MockUserRepository), gateway)
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	underpaid := &models.Payment{ID: uuid.New(), Amount: models.NewMoney(150000), PaymentStatus: models.PaymentStatusPending, XenditInvoiceID: "ewc-1"}
+	paid := &models.Payment{ID: uuid.New(), Amount: models.NewMoney(50000), PaymentStatus: models.PaymentStatusCompleted, XenditInvoiceID: "ewc-2", XenditPaidAmount: models.NewMoney(50000)}
+	gateway.Transactions = []gateways.Transaction{
+		{ID: "txn-1", ProductID: "ewc-1", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 100000, Created: from},
+		{ID: "txn-2", ProductID: "ewc-2", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 50000, Created: from},
+		{ID: "txn-3", ProductID: "ewc-2", Type: gateways.TransactionTypePayment, Status: gateways.TransactionStatusSuccess, Amount: 50000, Created: from},
+	}
+
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-1").Return(underpaid, nil)
+	mockPaymentRepo.On("FindByInvoiceID", "ewc-2").Return(paid, nil)
+	mockPaymentRepo.On("MarkUnderpaid", underpaid).Return(nil)
+	mockPaymentRepo.On("FindWithFilter", mock.Anything, defaultReconciliationPageSize, 0).
+		Return([]models.Payment{*paid}, int64(1), nil)
+
+	report, err := reconciler.Run(context.Background(), from, to)
+
+	assert.NoError(t, err)
+	assert.Empty(t, report.Fixes)
+	assert.Len(t, report.Discrepancies, 2)
+	assert.Equal(t, DiscrepancyUnderpaid, report.Discrepancies[0].Kind)
+	assert.Equal(t, DiscrepancyDuplicateTransaction, report.Discrepancies[1].Kind)
+	assert.Equal(t, "txn-3", report.Discrepancies[1].TransactionID)
+	mockPaymentRepo.AssertNotCalled(t, "MarkPaid", mock.Anything)
+	assert.Equal(t, models.NewMoney(100000), underpaid.XenditPaidAmount)
+}
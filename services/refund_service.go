@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"invitified-go/gateways"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"log"
+	"strings"
+)
+
+// ErrRefundNotSupported is returned for payments the gateway cannot refund.
+// Virtual account transfers have to be returned by bank transfer.
+var ErrRefundNotSupported = errors.New("payment method cannot be refunded through the payment gateway")
+
+// ErrRefundNotAccepted is returned when the gateway could not be reached or
+// rejected the refund
+var ErrRefundNotAccepted = errors.New("payment gateway did not accept the refund")
+
+// refundReferencePrefix starts the reference ID that ties a gateway refund and
+// its callbacks back to our refund
+const refundReferencePrefix = "refund-"
+
+// RefundService sends refunds to the payment gateway and records the status
+// the gateway reports for them.
+type RefundService struct {
+	refundRepo repositories.RefundRepository
+	userRepo   repositories.UserRepository
+	gateway    gateways.PaymentGateway
+}
+
+// NewRefundService creates a new RefundService
+func NewRefundService(refundRepo repositories.RefundRepository, userRepo repositories.UserRepository, gateway gateways.PaymentGateway) *RefundService {
+	return &RefundService{
+		refundRepo: refundRepo,
+		userRepo:   userRepo,
+		gateway:    gateway,
+	}
+}
+
+// RefundReferenceID returns the reference ID sent to the gateway for a refund
+func RefundReferenceID(refund *models.Refund) string {
+	return refundReferencePrefix + refund.ID.String()
+}
+
+// ParseRefundReferenceID returns the refund ID inside a gateway reference ID
+func ParseRefundReferenceID(referenceID string) (string, bool) {
+	if !strings.HasPrefix(referenceID, refundReferencePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(referenceID, refundReferencePrefix), true
+}
+
+// Refund reserves the refund's amount of the payment and sends it to the
+// gateway. The refund and payment are updated with the outcome. If the
+// gateway rejects the refund it is marked FAILED; if the gateway cannot be
+// reached it stays PENDING until a callback settles it. Both return
+// ErrRefundNotAccepted.
+func (s *RefundService) Refund(ctx context.Context, payment *models.Payment, refund *models.Refund) error {
+	reason := gateways.RefundReasonRequestedByCustomer
+	if payment.PaymentStatus == models.PaymentStatusRefundPending {
+		reason = gateways.RefundReasonCancellation
+	}
+	return s.refund(ctx, payment, refund, reason)
+}
+
+// RefundCancellation refunds part of a payment because its rental was
+// cancelled. It works like Refund.
+func (s *RefundService) RefundCancellation(ctx context.Context, payment *models.Payment, refund *models.Refund) error {
+	return s.refund(ctx, payment, refund, gateways.RefundReasonCancellation)
+}
+
+func (s *RefundService) refund(ctx context.Context, payment *models.Payment, refund *models.Refund, reason string) error {
+	if payment.PaymentMethod == models.PaymentMethodVirtualAccount {
+		return ErrRefundNotSupported
+	}
+
+	refund.PaymentID = payment.ID
+	if err := s.refundRepo.Create(refund); err != nil {
+		return err
+	}
+
+	req := gateways.RefundRequest{
+		ReferenceID: RefundReferenceID(refund),
+		Amount:      refund.Amount.Float64(),
+		Reason:      reason,
+	}
+	if payment.PaymentMethod == models.PaymentMethodQRCode {
+		req.QRPaymentID = payment.XenditPaymentID
+	} else {
+		req.InvoiceID = payment.XenditInvoiceID
+	}
+
+	result, err := s.gateway.CreateRefund(ctx, req)
+	if err != nil {
+		var apiErr *gateways.APIError
+		if errors.As(err, &apiErr) {
+			refund.FailureCode = apiErr.ErrorCode
+			if err := s.refundRepo.MarkFailed(refund); err != nil {
+				log.Printf("Failed to mark refund %s as failed: %v", refund.ID, err)
+			}
+		}
+		return fmt.Errorf("%w: refund %s: %v", ErrRefundNotAccepted, refund.ID, err)
+	}
+
+	refund.XenditRefundID = result.ID
+	return s.ApplyStatus(refund, payment, result.Status, result.FailureCode)
+}
+
+// ApplyStatus records the status the gateway reports for a refund. Once the
+// refund succeeded the payment is updated and the customer gets a receipt.
+// It returns repositories.ErrRefundNotPending for refunds that were settled
+// before.
+func (s *RefundService) ApplyStatus(refund *models.Refund, payment *models.Payment, status, failureCode string) error {
+	switch status {
+	case gateways.RefundStatusSucceeded:
+		if err := s.refundRepo.MarkSucceeded(refund, payment); err != nil {
+			return err
+		}
+		s.sendReceipt(refund, payment)
+		return nil
+	case gateways.RefundStatusFailed:
+		refund.FailureCode = failureCode
+		return s.refundRepo.MarkFailed(refund)
+	}
+	return s.refundRepo.SetXenditRefundID(refund)
+}
+
+func (s *RefundService) sendReceipt(refund *models.Refund, payment *models.Payment) {
+	user, err := s.userRepo.FindByID(refund.UserID)
+	if err != nil {
+		log.Printf("Failed to load user %s for refund email: %v", refund.UserID, err)
+		return
+	}
+	subject := "Refund Processed"
+	htmlBody := utils.GetRefundReceiptEmail(
+		payment.RentalID.String(),
+		refund.Amount.Format(payment.Currency),
+		payment.RefundedAmount.Format(payment.Currency),
+		refund.PointsReturned,
+		refund.PointsClawback,
+	)
+	if err := utils.SendHTMLEmail(user.Email, subject, htmlBody); err != nil {
+		log.Println("Failed to send email:", err)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"time"
+)
+
+// TransitionError is returned when a rental cannot move to the requested status
+type TransitionError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("cannot move rental from %s to %s: %s", e.From, e.To, e.Reason)
+	}
+	return fmt.Sprintf("cannot move rental from %s to %s", e.From, e.To)
+}
+
+// RentalLifecycle moves rentals between statuses following the transition
+// table in models and the guard conditions of each status.
+type RentalLifecycle struct {
+	repo repositories.RentalRepository
+	now  func() time.Time
+}
+
+// NewRentalLifecycle creates a new RentalLifecycle
+func NewRentalLifecycle(repo repositories.RentalRepository) *RentalLifecycle {
+	return &RentalLifecycle{repo, time.Now}
+}
+
+// Transition moves the rental to the given status and stores it together
+// with any extra column changes. The rental is updated in place on success.
+func (l *RentalLifecycle) Transition(rental *models.Rental, to string, changes map[string]interface{}) error {
+	if !rental.CanTransitionTo(to) {
+		return &TransitionError{From: rental.Status, To: to}
+	}
+
+	now := l.now()
+	if err := l.guard(rental, to, now); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"status": to}
+	for column, value := range changes {
+		updates[column] = value
+	}
+	switch to {
+	case models.RentalStatusPickedUp:
+		updates["picked_up_at"] = now
+	case models.RentalStatusReturned:
+		updates["returned_at"] = now
+	case models.RentalStatusComplete:
+		updates["completed_at"] = now
+	case models.RentalStatusCancelled:
+		updates["cancelled_at"] = now
+	}
+
+	if err := l.repo.Transition(rental.ID, rental.Status, updates); err != nil {
+		return err
+	}
+
+	rental.Status = to
+	switch to {
+	case models.RentalStatusPickedUp:
+		rental.PickedUpAt = &now
+	case models.RentalStatusReturned:
+		rental.ReturnedAt = &now
+	case models.RentalStatusComplete:
+		rental.CompletedAt = &now
+	case models.RentalStatusCancelled:
+		rental.CancelledAt = &now
+	}
+	return nil
+}
+
+func (l *RentalLifecycle) guard(rental *models.Rental, to string, now time.Time) error {
+	switch to {
+	case models.RentalStatusPickedUp:
+		// Equipment can be collected from the start of the first rental day
+		if now.Before(rental.StartDate.Truncate(24 * time.Hour)) {
+			return &TransitionError{From: rental.Status, To: to, Reason: "the rental period has not started yet"}
+		}
+	case models.RentalStatusOverdue:
+		if !now.After(rental.EndDate) {
+			return &TransitionError{From: rental.Status, To: to, Reason: "the rental period has not ended yet"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+	"invitified-go/models"
+	"log"
+	"os"
+	"strconv"
+)
+
+const defaultTaxName = "PPN"
+
+// TaxPolicy is the sales tax charged on rentals, such as Indonesian PPN.
+// Inclusive prices already contain the tax, exclusive prices have it added
+// on top.
+type TaxPolicy struct {
+	Name      string
+	Rate      float64
+	Inclusive bool
+}
+
+// TaxPolicyFromEnv reads TAX_NAME, TAX_RATE and TAX_INCLUSIVE. The rate is a
+// fraction, 0.11 for 11% PPN. No tax is charged unless TAX_RATE is set.
+func TaxPolicyFromEnv() TaxPolicy {
+	policy := TaxPolicy{
+		Name: os.Getenv("TAX_NAME"),
+		Rate: nonNegativeFloatFromEnv("TAX_RATE", 0),
+	}
+	if policy.Name == "" {
+		policy.Name = defaultTaxName
+	}
+	if value := os.Getenv("TAX_INCLUSIVE"); value != "" {
+		inclusive, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Invalid TAX_INCLUSIVE %q, using exclusive prices", value)
+		}
+		policy.Inclusive = inclusive
+	}
+	return policy
+}
+
+// Apply works out the tax of the breakdown and its total. Lines of tax exempt
+// categories are not taxed and the discount lowers the taxable amount in
+// proportion to the lines it was taken from.
+func (p TaxPolicy) Apply(breakdown *models.PriceBreakdown) {
+	var taxable models.Money
+	for _, line := range breakdown.Lines {
+		if !line.TaxExempt {
+			taxable += line.LineTotal
+		}
+	}
+	if breakdown.Discount > 0 {
+		taxable -= breakdown.Discount.Prorate(taxable, breakdown.Subtotal)
+	}
+
+	breakdown.TaxName = p.Name
+	breakdown.TaxRate = p.Rate
+	breakdown.TaxInclusive = p.Inclusive
+	breakdown.Total = breakdown.Subtotal - breakdown.Discount
+	if p.Inclusive {
+		breakdown.Tax = taxable.Mul(p.Rate / (1 + p.Rate)).Round(breakdown.Currency)
+		return
+	}
+	breakdown.Tax = taxable.Mul(p.Rate).Round(breakdown.Currency)
+	breakdown.Total += breakdown.Tax
+}
+
+// TaxLabel describes the tax of a breakdown for receipts, such as
+// "PPN 11% (included)"
+func TaxLabel(breakdown *models.PriceBreakdown) string {
+	if breakdown == nil || breakdown.TaxRate == 0 {
+		return ""
+	}
+	label := fmt.Sprintf("%s %s%%", breakdown.TaxName, strconv.FormatFloat(breakdown.TaxRate*100, 'f', -1, 64))
+	if breakdown.TaxInclusive {
+		label += " (included)"
+	}
+	return label
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"invitified-go/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func taxTestBreakdown() *models.PriceBreakdown {
+	return &models.PriceBreakdown{
+		Lines: []models.PriceLine{
+			{LineTotal: models.NewMoney(100000)},
+			{LineTotal: models.NewMoney(50000), TaxExempt: true},
+		},
+		Subtotal: models.NewMoney(150000),
+		Total:    models.NewMoney(150000),
+	}
+}
+
+func TestTaxPolicy_Apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    TaxPolicy
+		discount  float64
+		wantTax   float64
+		wantTotal float64
+	}{
+		{
+			name:      "Exclusive tax is added to exempt and taxed lines",
+			policy:    TaxPolicy{Name: "PPN", Rate: 0.11},
+			wantTax:   11000,
+			wantTotal: 161000,
+		},
+		{
+			name:      "Inclusive tax is contained in the total",
+			policy:    TaxPolicy{Name: "PPN", Rate: 0.11, Inclusive: true},
+			wantTax:   9910,
+			wantTotal: 150000,
+		},
+		{
+			name:      "Discount lowers the taxable amount in proportion",
+			policy:    TaxPolicy{Name: "PPN", Rate: 0.11},
+			discount:  30000,
+			wantTax:   8800,
+			wantTotal: 128800,
+		},
+		{
+			name:      "No rate charges no tax",
+			policy:    TaxPolicy{Name: "PPN"},
+			wantTax:   0,
+			wantTotal: 150000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakdown := taxTestBreakdown()
+			breakdown.Discount = models.NewMoney(tt.discount)
+
+			tt.policy.Apply(breakdown)
+
+			assert.Equal(t, models.NewMoney(tt.wantTax), breakdown.Tax)
+			assert.Equal(t, models.NewMoney(tt.wantTotal), breakdown.Total)
+			assert.Equal(t, tt.policy.Rate, breakdown.TaxRate)
+			assert.Equal(t, tt.policy.Inclusive, breakdown.TaxInclusive)
+		})
+	}
+}
+
+func TestTaxPolicyFromEnv(t *testing.T) {
+	t.Setenv("TAX_RATE", "0.11")
+	t.Setenv("TAX_INCLUSIVE", "true")
+
+	policy := TaxPolicyFromEnv()
+	assert.Equal(t, TaxPolicy{Name: "PPN", Rate: 0.11, Inclusive: true}, policy)
+
+	breakdown := taxTestBreakdown()
+	policy.Apply(breakdown)
+	assert.Equal(t, "PPN 11% (included)", TaxLabel(breakdown))
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"invitified-go/utils"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired or revoked
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+
+// ErrRefreshTokenReused is returned when a refresh token is used after it was
+// rotated. The session it belongs to is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// TokenPair is what a client needs to call the API and to stay logged in
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenService issues short-lived access tokens and the rotating refresh
+// tokens of login sessions
+type TokenService struct {
+	repo       repositories.TokenRepository
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTokenService creates a new TokenService with the lifetimes read from
+// ACCESS_TOKEN_TTL (15m by default) and REFRESH_TOKEN_TTL (720h by default)
+func NewTokenService(repo repositories.TokenRepository) *TokenService {
+	return &TokenService{
+		repo:       repo,
+		accessTTL:  utils.DurationFromEnv("ACCESS_TOKEN_TTL", defaultAccessTokenTTL),
+		refreshTTL: utils.DurationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL),
+		now:        time.Now,
+	}
+}
+
+// Login starts a new session for the user
+func (s *TokenService) Login(userID uuid.UUID) (*TokenPair, error) {
+	pair, token, err := s.issue(userID, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveToken(token); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. The refresh token can be
+// used once, using it again revokes the whole session because either the
+// client or an attacker holds a stolen copy.
+func (s *TokenService) Refresh(refreshToken string) (*TokenPair, error) {
+	current, err := s.repo.FindToken(hashToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current.RotatedAt != nil {
+		return nil, s.revokeReused(current)
+	}
+	if !current.IsValid || !current.ExpiresAt.After(s.now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, next, err := s.issue(current.UserID, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Rotate(current, next); err != nil {
+		if errors.Is(err, repositories.ErrTokenNotActive) {
+			// Another request rotated or revoked it since it was loaded
+			return nil, s.revokeReused(current)
+		}
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Logout revokes the session
+func (s *TokenService) Logout(sessionID uuid.UUID) error {
+	return s.repo.RevokeFamily(sessionID)
+}
+
+// LogoutAll revokes every session of the user
+func (s *TokenService) LogoutAll(userID uuid.UUID) error {
+	return s.repo.RevokeUser(userID)
+}
+
+func (s *TokenService) revokeReused(token *models.Tokens) error {
+	log.Printf("Refresh token %s of user %s was reused, revoking session %s", token.ID, token.UserID, token.FamilyID)
+	if err := s.repo.RevokeFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issue creates an access token and the refresh token stored for it
+func (s *TokenService) issue(userID, sessionID uuid.UUID) (*TokenPair, *models.Tokens, error) {
+	now := s.now()
+	pair := &TokenPair{
+		ExpiresAt:        now.Add(s.accessTTL),
+		RefreshExpiresAt: now.Add(s.refreshTTL),
+	}
+	var err error
+	if pair.AccessToken, err = utils.GenerateJWT(userID, sessionID, pair.ExpiresAt); err != nil {
+		return nil, nil, err
+	}
+	if pair.RefreshToken, err = newRefreshToken(); err != nil {
+		return nil, nil, err
+	}
+
+	token := &models.Tokens{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Token:     hashToken(pair.RefreshToken),
+		FamilyID:  sessionID,
+		ExpiresAt: pair.RefreshExpiresAt,
+		IsValid:   true,
+		CreatedAt: now,
+	}
+	return pair, token, nil
+}
+
+// newRefreshToken returns 256 random bits, URL safe
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is what is stored of a refresh token, so a copy of the database
+// does not let anyone log in
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
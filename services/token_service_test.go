@@ -0,0 +1,123 @@
+package services
+
+import (
+	"invitified-go/models"
+	"invitified-go/repositories"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+func TestTokenService_Refresh(t *testing.T) {
+	mockRepo := new(repositories.MockTokenRepository)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := NewTokenService(mockRepo)
+	service.now = func() time.Time { return now }
+
+	userID := uuid.New()
+	familyID := uuid.New()
+	rotatedAt := now.Add(-time.Hour)
+	stored := func(modify func(token *models.Tokens)) *models.Tokens {
+		token := &models.Tokens{
+			ID:        uuid.New(),
+			UserID:    userID,
+			FamilyID:  familyID,
+			Token:     hashToken("refresh-1"),
+			ExpiresAt: now.Add(24 * time.Hour),
+			IsValid:   true,
+		}
+		if modify != nil {
+			modify(token)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		setupMocks func()
+		wantErr    error
+	}{
+		{
+			name: "rotates into a token of the same session",
+			setupMocks: func() {
+				current := stored(nil)
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(current, nil)
+				mockRepo.On("Rotate", current, mock.MatchedBy(func(next *models.Tokens) bool {
+					return next.FamilyID == familyID && next.UserID == userID && next.IsValid &&
+						next.Token != current.Token && next.ExpiresAt.Equal(now.Add(defaultRefreshTokenTTL))
+				})).Return(nil)
+			},
+		},
+		{
+			name: "reusing a rotated token revokes the session",
+			setupMocks: func() {
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(stored(func(token *models.Tokens) {
+					token.IsValid = false
+					token.RotatedAt = &rotatedAt
+				}), nil)
+				mockRepo.On("RevokeFamily", familyID).Return(nil)
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "losing a race to rotate counts as reuse",
+			setupMocks: func() {
+				current := stored(nil)
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(current, nil)
+				mockRepo.On("Rotate", current, mock.Anything).Return(repositories.ErrTokenNotActive)
+				mockRepo.On("RevokeFamily", familyID).Return(nil)
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "logged out",
+			setupMocks: func() {
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(stored(func(token *models.Tokens) {
+					token.IsValid = false
+					token.RevokedAt = &rotatedAt
+				}), nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired",
+			setupMocks: func() {
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(stored(func(token *models.Tokens) {
+					token.ExpiresAt = now.Add(-time.Minute)
+				}), nil)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name: "unknown",
+			setupMocks: func() {
+				mockRepo.On("FindToken", hashToken("refresh-1")).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.ExpectedCalls = nil
+			mockRepo.Calls = nil
+			tt.setupMocks()
+
+			pair, err := service.Refresh("refresh-1")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, pair)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, pair.AccessToken)
+				assert.NotEqual(t, "refresh-1", pair.RefreshToken)
+				assert.Equal(t, now.Add(defaultAccessTokenTTL), pair.ExpiresAt)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
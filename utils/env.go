@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DurationFromEnv reads a positive duration such as "15m" from the
+// environment. An unset or invalid value gives the fallback.
+func DurationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// HoursFromEnv reads a number of hours such as "1.5" from the environment as
+// a duration. Zero is allowed; an unset, negative or invalid value gives the
+// fallback.
+func HoursFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	hours, err := strconv.ParseFloat(value, 64)
+	if err != nil || hours < 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
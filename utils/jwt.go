@@ -12,15 +12,22 @@ var jwtKey = []byte(os.Getenv("JWT_SECRET"))
 
 type Claims struct {
 	UserID string `json:"user_id"`
+	// SessionID is the family of refresh tokens the access token was issued
+	// for. Revoking the family revokes the access token.
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uuid.UUID) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateJWT creates an access token of the user's login session that
+// expires at the given time
+func GenerateJWT(userID, sessionID uuid.UUID, expiresAt time.Time) (string, error) {
 	claims := &Claims{
-		UserID: userID.String(),
+		UserID:    userID.String(),
+		SessionID: sessionID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
 
@@ -28,18 +35,20 @@ func GenerateJWT(userID uuid.UUID) (string, error) {
 	return token.SignedString(jwtKey)
 }
 
+// ValidateJWT checks the signature and expiry of an access token. Expired
+// tokens return an error matching jwt.ErrTokenExpired.
 func ValidateJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return jwtKey, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
 	}
 
 	if !token.Valid {
-		return nil, err
+		return nil, jwt.ErrTokenUnverifiable
 	}
 
 	return claims, nil
@@ -47,7 +47,46 @@ func SendHTMLEmail(to string, subject string, htmlBody string) error {
 	return nil
 }
 
-func GetOrderConfirmationEmail(orderNumber string, amount string) string {
+// OrderConfirmation holds the formatted amounts shown in the order
+// confirmation email. The promotion, tax, deposit and charged lines are left
+// out when PromoCode, TaxLabel, Deposit or Charged is empty.
+type OrderConfirmation struct {
+	OrderNumber string
+	Amount      string
+	PromoCode   string
+	Discount    string
+	Subtotal    string
+	TaxLabel    string
+	Tax         string
+	Deposit     string
+	// Charged is the amount charged in the settlement currency when it
+	// differs from the currency of the order
+	Charged string
+}
+
+func GetOrderConfirmationEmail(order OrderConfirmation) string {
+	promotion := ""
+	if order.PromoCode != "" {
+		promotion = `<br>
+                                    <strong>Promo Code:</strong> ` + order.PromoCode + `<br>
+                                    <strong>Discount:</strong> ` + order.Discount
+	}
+	taxes := ""
+	if order.TaxLabel != "" {
+		taxes = `<br>
+                                    <strong>Subtotal:</strong> ` + order.Subtotal + `<br>
+                                    <strong>` + order.TaxLabel + `:</strong> ` + order.Tax
+	}
+	securityDeposit := ""
+	if order.Deposit != "" {
+		securityDeposit = `<br>
+                                    <strong>Refundable Deposit:</strong> ` + order.Deposit
+	}
+	settlement := ""
+	if order.Charged != "" {
+		settlement = `<br>
+                                    <strong>Charged:</strong> ` + order.Charged
+	}
 	return `
 <!DOCTYPE html>
 <html>
@@ -70,8 +109,8 @@ func GetOrderConfirmationEmail(orderNumber string, amount string) string {
 
                             <div style="background-color: #f8f9fa; border-radius: 6px; padding: 20px; margin: 30px 0;">
                                 <p style="margin: 0; color: #333333; font-size: 16px;">
-                                    <strong>Order Number:</strong> ` + orderNumber + `<br>
-                                    <strong>Amount Paid:</strong> ` + amount + `
+                                    <strong>Order Number:</strong> ` + order.OrderNumber + `<br>
+                                    <strong>Amount Paid:</strong> ` + order.Amount + promotion + taxes + securityDeposit + settlement + `
                                 </p>
                             </div>
 
@@ -99,3 +138,114 @@ func GetOrderConfirmationEmail(orderNumber string, amount string) string {
 </body>
 </html>`
 }
+
+func GetRefundReceiptEmail(orderNumber string, amount string, totalRefunded string, pointsReturned int, pointsDeducted int) string {
+	points := ""
+	if pointsReturned > 0 {
+		points += `<br>
+                                    <strong>Points Returned:</strong> ` + strconv.Itoa(pointsReturned)
+	}
+	if pointsDeducted > 0 {
+		points += `<br>
+                                    <strong>Earned Points Deducted:</strong> ` + strconv.Itoa(pointsDeducted)
+	}
+	return `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="margin: 0; padding: 0; font-family: Arial, sans-serif; background-color: #f4f4f4;">
+    <table role="presentation" style="width: 100%; border-collapse: collapse;">
+        <tr>
+            <td align="center" style="padding: 40px 0;">
+                <table role="presentation" style="width: 600px; border-collapse: collapse; background-color: #ffffff; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="padding: 40px;">
+                            <h1 style="color: #333333; margin-bottom: 30px; text-align: center;">Refund Processed</h1>
+
+                            <p style="color: #666666; font-size: 16px; line-height: 24px; margin-bottom: 20px;">
+                                We have refunded part or all of your payment for your Invitified order. Depending on your payment provider it may take a few days before the money shows up in your account.
+                            </p>
+
+                            <div style="background-color: #f8f9fa; border-radius: 6px; padding: 20px; margin: 30px 0;">
+                                <p style="margin: 0; color: #333333; font-size: 16px;">
+                                    <strong>Order Number:</strong> ` + orderNumber + `<br>
+                                    <strong>Amount Refunded:</strong> ` + amount + `<br>
+                                    <strong>Total Refunded:</strong> ` + totalRefunded + points + `
+                                </p>
+                            </div>
+
+                            <p style="color: #666666; font-size: 16px; line-height: 24px;">
+                                If you have any questions about this refund, please don't hesitate to contact our support team.
+                            </p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="background-color: #f8f9fa; padding: 20px; text-align: center; border-radius: 0 0 8px 8px;">
+                            <p style="color: #999999; font-size: 14px; margin: 0;">
+                                This is an automated message, please do not reply directly to this email.<br>
+                                © 2024 Invitified. All rights reserved.
+                            </p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>`
+}
+
+func GetLateFeeEmail(orderNumber string, endDate string, daysLate int, dailyFee string, amount string, outstanding string) string {
+	return `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="margin: 0; padding: 0; font-family: Arial, sans-serif; background-color: #f4f4f4;">
+    <table role="presentation" style="width: 100%; border-collapse: collapse;">
+        <tr>
+            <td align="center" style="padding: 40px 0;">
+                <table role="presentation" style="width: 600px; border-collapse: collapse; background-color: #ffffff; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="padding: 40px;">
+                            <h1 style="color: #333333; margin-bottom: 30px; text-align: center;">Rental Overdue</h1>
+
+                            <p style="color: #666666; font-size: 16px; line-height: 24px; margin-bottom: 20px;">
+                                Your Invitified rental was due back on ` + endDate + ` and has not been returned yet. A late fee is charged for every day the equipment is late until it is returned.
+                            </p>
+
+                            <div style="background-color: #f8f9fa; border-radius: 6px; padding: 20px; margin: 30px 0;">
+                                <p style="margin: 0; color: #333333; font-size: 16px;">
+                                    <strong>Order Number:</strong> ` + orderNumber + `<br>
+                                    <strong>Days Late:</strong> ` + strconv.Itoa(daysLate) + `<br>
+                                    <strong>Fee Per Day:</strong> ` + dailyFee + `<br>
+                                    <strong>Late Fee:</strong> ` + amount + `<br>
+                                    <strong>Amount Due:</strong> ` + outstanding + `
+                                </p>
+                            </div>
+
+                            <p style="color: #666666; font-size: 16px; line-height: 24px;">
+                                Please return the equipment as soon as possible and pay the late fee from your rental in the app. If you have already returned it or have any questions, please contact our support team.
+                            </p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="background-color: #f8f9fa; padding: 20px; text-align: center; border-radius: 0 0 8px 8px;">
+                            <p style="color: #999999; font-size: 14px; margin: 0;">
+                                This is an automated message, please do not reply directly to this email.<br>
+                                © 2024 Invitified. All rights reserved.
+                            </p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>`
+}